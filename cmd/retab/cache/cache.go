@@ -0,0 +1,120 @@
+//go:build !js
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/retab/v2/pkg/cache"
+	"gitlab.com/tozd/go/errors"
+)
+
+func NewCacheCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "inspect and clean the format cache",
+	}
+
+	cmd.AddCommand(newStatsCommand())
+	cmd.AddCommand(newCleanCommand())
+
+	return cmd
+}
+
+func openCache() (*cache.Cache, error) {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return cache.New(dir), nil
+}
+
+func newStatsCommand() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "show where the format cache lives and how big it is",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the stats as json")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		c, err := openCache()
+		if err != nil {
+			return err
+		}
+
+		stats, err := c.Stats(cmd.Context())
+		if err != nil {
+			return errors.Errorf("reading cache stats: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+
+		if asJSON {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "\t")
+			return enc.Encode(stats)
+		}
+
+		fmt.Fprintf(out, "dir:     %s\n", stats.Dir)
+		fmt.Fprintf(out, "entries: %d\n", stats.Entries)
+		fmt.Fprintf(out, "size:    %s\n", humanBytes(stats.Bytes))
+		if stats.Entries > 0 {
+			fmt.Fprintf(out, "oldest:  %s\n", stats.Oldest.Format(time.RFC3339))
+			fmt.Fprintf(out, "newest:  %s\n", stats.Newest.Format(time.RFC3339))
+		}
+
+		return nil
+	}
+
+	return cmd
+}
+
+func newCleanCommand() *cobra.Command {
+	var olderThan time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "remove cached format results",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Flags().DurationVar(&olderThan, "older-than", 0, "only remove entries written longer ago than this (default all)")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		c, err := openCache()
+		if err != nil {
+			return err
+		}
+
+		removed, err := c.Clean(cmd.Context(), olderThan)
+		if err != nil {
+			return errors.Errorf("cleaning cache: %w", err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "removed %d entries from %s\n", removed, c.Dir())
+
+		return nil
+	}
+
+	return cmd
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,256 @@
+//go:build !js
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	"github.com/walteh/retab/v2/pkg/editorconfig"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters"
+	"gitlab.com/tozd/go/errors"
+)
+
+func NewConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "inspect the configuration retab uses",
+	}
+
+	cmd.AddCommand(newShowCommand())
+
+	return cmd
+}
+
+type ShowHandler struct {
+	formatter           string
+	editorconfigContent string
+	noEditorconfig      bool
+	json                bool
+
+	stdout io.Writer
+	cfg    *formatters.AutoFormatProvider
+}
+
+// Effective is everything that decides how a file is formatted
+type Effective struct {
+	Path       string                      `json:"path"`
+	Formatter  *EffectiveFormatter         `json:"formatter,omitempty"`
+	Definition *Definition                 `json:"definition,omitempty"`
+	Sources    []*editorconfig.KeySource   `json:"sources"`
+	UseTabs    bool                        `json:"use_tabs"`
+	IndentSize int                         `json:"indent_size"`
+	Keys       []*ProviderKey              `json:"provider_keys"`
+	Warnings   []*formatters.OptionWarning `json:"warnings"`
+}
+
+type EffectiveFormatter struct {
+	Language string `json:"language"`
+	Method   string `json:"method"`
+	Match    string `json:"match"`
+	Provider string `json:"provider"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Definition is the resolved editorconfig definition, without the raw keys that are listed in Sources
+type Definition struct {
+	Charset                string `json:"charset,omitempty"`
+	EndOfLine              string `json:"end_of_line,omitempty"`
+	IndentStyle            string `json:"indent_style,omitempty"`
+	IndentSize             string `json:"indent_size,omitempty"`
+	TabWidth               int    `json:"tab_width,omitempty"`
+	TrimTrailingWhitespace *bool  `json:"trim_trailing_whitespace,omitempty"`
+	InsertFinalNewline     *bool  `json:"insert_final_newline,omitempty"`
+}
+
+// ProviderKey is a Raw() key the detected provider reads, and its value for this file
+type ProviderKey struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Set   bool   `json:"set"`
+}
+
+func newShowCommand() *cobra.Command {
+	me := &ShowHandler{}
+
+	cmd := &cobra.Command{
+		Use:   "show <file>",
+		Short: "print the effective settings for a file and where they come from",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().StringVar(&me.formatter, "formatter", "auto", "the formatter to use")
+	cmd.Flags().StringVar(&me.editorconfigContent, "editorconfig-content", "", "editorconfig content (optional)")
+	cmd.Flags().BoolVar(&me.noEditorconfig, "no-editorconfig", false, "ignore .editorconfig files and use the default configuration")
+	cmd.Flags().BoolVar(&me.json, "json", false, "print the configuration as json")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		me.stdout = cmd.OutOrStdout()
+		me.cfg = fmtcmd.NewAutoFormatConfig()
+		return me.Run(cmd.Context(), args[0])
+	}
+
+	return cmd
+}
+
+func (me *ShowHandler) Run(ctx context.Context, path string) error {
+	effective, err := me.resolve(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if me.json {
+		enc := json.NewEncoder(me.stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(effective); err != nil {
+			return errors.Errorf("writing configuration: %w", err)
+		}
+		return nil
+	}
+
+	return effective.write(me.stdout)
+}
+
+func (me *ShowHandler) resolve(ctx context.Context, path string) (*Effective, error) {
+	effective := &Effective{Path: path, Sources: []*editorconfig.KeySource{}, Keys: []*ProviderKey{}, Warnings: []*formatters.OptionWarning{}}
+
+	// the file does not need to exist, glob detection and editorconfig resolution only need its name
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Errorf("reading file: %w", err)
+	}
+
+	cfgProvider := fmtcmd.NewConfigurationProvider(ctx, me.editorconfigContent, me.noEditorconfig)
+
+	cfg, err := cfgProvider.GetConfigurationForFileType(ctx, path)
+	if err != nil {
+		return nil, errors.Errorf("resolving configuration: %w", err)
+	}
+
+	effective.UseTabs = cfg.UseTabs()
+	effective.IndentSize = cfg.IndentSize()
+
+	if ecfg, ok := cfg.(*editorconfig.EditorConfigConfiguration); ok {
+		def := ecfg.Definition
+		effective.Definition = &Definition{
+			Charset:                def.Charset,
+			EndOfLine:              def.EndOfLine,
+			IndentStyle:            def.IndentStyle,
+			IndentSize:             def.IndentSize,
+			TabWidth:               def.TabWidth,
+			TrimTrailingWhitespace: def.TrimTrailingWhitespace,
+			InsertFinalNewline:     def.InsertFinalNewline,
+		}
+	}
+
+	if ecProvider, ok := cfgProvider.(*editorconfig.EditorConfigConfigurationProvider); ok {
+		effective.Sources, err = ecProvider.Sources(ctx, path)
+		if err != nil {
+			return nil, errors.Errorf("tracing editorconfig sources: %w", err)
+		}
+	}
+
+	raw := cfg.Raw()
+	keys := formatters.CommonConfigKeys
+
+	detection, err := me.cfg.Detect(ctx, me.formatter, path, bytes.NewReader(content))
+	if err != nil {
+		effective.Formatter = &EffectiveFormatter{Error: err.Error()}
+	} else {
+		provider := detection.Provider
+		if lazy, ok := provider.(*format.LazyFormatProvider); ok {
+			provider = lazy.Provider()
+		}
+		effective.Formatter = &EffectiveFormatter{
+			Language: detection.Language,
+			Method:   detection.Method,
+			Match:    detection.Match,
+			Provider: reflect.TypeOf(provider).String(),
+		}
+		if detection.Config.Options != nil {
+			keys = append(append([]string{}, keys...), detection.Config.Options.Keys()...)
+		}
+		effective.Warnings = formatters.CheckOptions(detection, effective.Sources)
+	}
+
+	for _, key := range keys {
+		value, set := raw[key]
+		effective.Keys = append(effective.Keys, &ProviderKey{Key: key, Value: value, Set: set})
+	}
+
+	return effective, nil
+}
+
+func (me *Effective) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "file:\t%s\n", me.Path)
+	if me.Formatter.Error != "" {
+		fmt.Fprintf(tw, "formatter:\tnone (%s)\n", me.Formatter.Error)
+	} else {
+		fmt.Fprintf(tw, "formatter:\t%s (%s match %q)\n", me.Formatter.Language, me.Formatter.Method, me.Formatter.Match)
+		fmt.Fprintf(tw, "provider:\t%s\n", me.Formatter.Provider)
+	}
+	fmt.Fprintf(tw, "use tabs:\t%t\n", me.UseTabs)
+	fmt.Fprintf(tw, "indent size:\t%d\n", me.IndentSize)
+
+	fmt.Fprintln(tw, "\neditorconfig:")
+	if len(me.Sources) == 0 {
+		fmt.Fprintln(tw, "  (no settings apply)")
+	}
+	for _, src := range me.Sources {
+		fmt.Fprintf(tw, "  %s = %s\t%s\t[%s]\n", src.Key, src.Value, src.File, src.Section)
+	}
+
+	fmt.Fprintln(tw, "\nread by the formatter:")
+	for _, key := range me.Keys {
+		value := "(unset)"
+		if key.Set {
+			value = key.Value
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", key.Key, value)
+	}
+
+	if len(me.Warnings) > 0 {
+		fmt.Fprintln(tw, "\nwarnings:")
+		for _, warning := range me.Warnings {
+			fmt.Fprintf(tw, "  %s = %s\t%s\t[%s]\t%s\n", warning.Key, warning.Value, warning.File, warning.Section, warning.Message)
+		}
+	}
+
+	if me.Definition != nil {
+		fmt.Fprintln(tw, "\nresolved definition:")
+		def := me.Definition
+		for _, row := range [][2]string{
+			{"charset", def.Charset},
+			{"end_of_line", def.EndOfLine},
+			{"indent_style", def.IndentStyle},
+			{"indent_size", def.IndentSize},
+			{"tab_width", fmt.Sprint(def.TabWidth)},
+			{"trim_trailing_whitespace", optionalBool(def.TrimTrailingWhitespace)},
+			{"insert_final_newline", optionalBool(def.InsertFinalNewline)},
+		} {
+			if row[1] != "" {
+				fmt.Fprintf(tw, "  %s\t%s\n", row[0], row[1])
+			}
+		}
+	}
+
+	return tw.Flush()
+}
+
+func optionalBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return fmt.Sprint(*b)
+}
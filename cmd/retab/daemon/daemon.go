@@ -0,0 +1,79 @@
+//go:build !js
+
+package daemon
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	"github.com/walteh/retab/v2/pkg/daemon"
+	"github.com/walteh/retab/v2/pkg/formatters"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
+)
+
+type Handler struct {
+	socket      string
+	idleTimeout time.Duration
+	runtime     string
+	version     string
+}
+
+func NewDaemonCommand() *cobra.Command {
+	me := &Handler{}
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "keep formatters warm and serve `retab fmt` over a unix socket",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Flags().StringVar(&me.socket, "socket", daemon.DefaultSocketPath(), "the unix socket to listen on")
+	cmd.Flags().DurationVar(&me.idleTimeout, "idle-timeout", 15*time.Minute, "shut down after no requests for this long (0 to never shut down)")
+	cmd.Flags().StringVar(&me.runtime, "runtime", "", "how external formatters run: auto, native, podman, nerdctl or docker (default $RETAB_RUNTIME or auto)")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		me.version = cmd.Root().Version
+		return me.Run(cmd.Context())
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx = fmtcmd.ContextWithFormatCache(ctx, me.version)
+
+	ln, err := daemon.Listen(ctx, me.socket)
+	if err != nil {
+		return err
+	}
+
+	// one provider set for the daemon's lifetime, this is what keeps lazy providers warm
+	fmts := fmtcmd.NewAutoFormatConfig(cmdfmt.WithRuntime(me.runtime))
+
+	server := daemon.NewServer(func(ctx context.Context, req *daemon.FormatRequest) ([]byte, error) {
+		return formatRequest(ctx, fmts, req)
+	}, me.version, me.idleTimeout)
+
+	zerolog.Ctx(ctx).Info().Str("socket", me.socket).Str("idle_timeout", me.idleTimeout.String()).Msg("daemon listening")
+
+	return server.Serve(ctx, ln)
+}
+
+func formatRequest(ctx context.Context, fmts *formatters.AutoFormatProvider, req *daemon.FormatRequest) ([]byte, error) {
+	formatter := req.Formatter
+	if formatter == "" {
+		formatter = "auto"
+	}
+	// a provider per request, so edits to .editorconfig files are picked up by a long running daemon
+	cfgProvider := fmtcmd.NewConfigurationProvider(ctx, req.Editorconfig, req.NoEditorconfig)
+	return fmtcmd.FormatBytes(ctx, fmts, cfgProvider, formatter, req.Filename, []byte(req.Content))
+}
@@ -0,0 +1,119 @@
+//go:build !js
+
+package explain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
+	"gitlab.com/tozd/go/errors"
+)
+
+type Handler struct {
+	formatter string
+	runtime   string
+	json      bool
+
+	stdout io.Writer
+	cfg    *formatters.AutoFormatProvider
+}
+
+type explanation struct {
+	Path     string                  `json:"path"`
+	Provider string                  `json:"provider,omitempty"`
+	Runtime  *cmdfmt.RuntimeDecision `json:"runtime,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+func NewExplainCommand() *cobra.Command {
+	me := &Handler{}
+
+	cmd := &cobra.Command{
+		Use:   "explain [file]...",
+		Short: "show which formatter and which binary would format each file",
+		Args:  cobra.MinimumNArgs(1),
+	}
+
+	cmd.Flags().StringVar(&me.formatter, "formatter", "auto", "the formatter to use")
+	cmd.Flags().StringVar(&me.runtime, "runtime", "", "how external formatters run: auto, native, podman, nerdctl or docker (default $RETAB_RUNTIME or auto)")
+	cmd.Flags().BoolVar(&me.json, "json", false, "print the explanation as json")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		me.stdout = cmd.OutOrStdout()
+		me.cfg = fmtcmd.NewAutoFormatConfig(cmdfmt.WithRuntime(me.runtime))
+		return me.Run(cmd.Context(), args)
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context, paths []string) error {
+	explanations := make([]*explanation, 0, len(paths))
+	for _, path := range paths {
+		explanations = append(explanations, me.explain(ctx, path))
+	}
+
+	if me.json {
+		enc := json.NewEncoder(me.stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(explanations); err != nil {
+			return errors.Errorf("writing explanation: %w", err)
+		}
+		return nil
+	}
+
+	for _, e := range explanations {
+		switch {
+		case e.Error != "":
+			fmt.Fprintf(me.stdout, "%s: error: %s\n", e.Path, e.Error)
+		case e.Runtime != nil:
+			fmt.Fprintf(me.stdout, "%s: %s\n", e.Path, e.Runtime)
+		default:
+			fmt.Fprintf(me.stdout, "%s: in-process %s\n", e.Path, e.Provider)
+		}
+	}
+
+	return nil
+}
+
+func (me *Handler) explain(ctx context.Context, path string) *explanation {
+	e := &explanation{Path: path}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+
+	fmtr, err := me.cfg.GetFormatter(ctx, me.formatter, path, bytes.NewReader(content))
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+
+	if lazy, ok := fmtr.(*format.LazyFormatProvider); ok {
+		fmtr = lazy.Provider()
+	}
+	e.Provider = reflect.TypeOf(fmtr).String()
+
+	if resolver, ok := fmtr.(cmdfmt.RuntimeResolver); ok {
+		decision, err := resolver.ResolveRuntime(ctx)
+		if err != nil {
+			e.Error = err.Error()
+			return e
+		}
+		e.Runtime = decision
+	}
+
+	return e
+}
@@ -8,28 +8,38 @@ import (
 	"github.com/walteh/retab/v2/pkg/formatters/dockerfmt"
 	"github.com/walteh/retab/v2/pkg/formatters/gofmt"
 	"github.com/walteh/retab/v2/pkg/formatters/hclfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/jsonfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/mdfmt"
 	"github.com/walteh/retab/v2/pkg/formatters/protofmt"
 	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
 	"github.com/walteh/retab/v2/pkg/formatters/swiftfmt"
 	"github.com/walteh/retab/v2/pkg/formatters/terraformfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/tomlfmt"
 	"github.com/walteh/retab/v2/pkg/formatters/yamlfmt"
 )
 
 // currently all formatters are supported by all architectures, if that ever changes we can use this to
-// conditionally create the correct formatters
-func NewAutoFormatConfig() *formatters.AutoFormatProvider {
+// conditionally create the correct formatters. The options are applied to the external formatters.
+func NewAutoFormatConfig(external ...cmdfmt.OptBasicExternalFormatterOptsSetter) *formatters.AutoFormatProvider {
 
 	var cfg = &formatters.AutoFormatProvider{
-		HCLFmt:       format.NewLazyFormatProvider(func() format.Provider { return hclfmt.NewFormatter() }),
 		ProtoFmt:     format.NewLazyFormatProvider(func() format.Provider { return protofmt.NewFormatter() }),
 		YAMLFmt:      format.NewLazyFormatProvider(func() format.Provider { return yamlfmt.NewFormatter() }),
 		ShFmt:        format.NewLazyFormatProvider(func() format.Provider { return shfmt.NewFormatter() }),
 		DockerFmt:    format.NewLazyFormatProvider(func() format.Provider { return dockerfmt.NewFormatter() }),
-		DartFmt:      format.NewLazyFormatProvider(func() format.Provider { return dartfmt.NewDartCmdFormatter(cmdfmt.WithUseDocker(true)) }),
-		TerraformFmt: format.NewLazyFormatProvider(func() format.Provider { return terraformfmt.NewTerraformCmdFormatter(cmdfmt.WithUseDocker(true)) }),
-		SwiftFmt:     format.NewLazyFormatProvider(func() format.Provider { return swiftfmt.NewSwiftCmdFormatter(cmdfmt.WithUseDocker(true)) }),
+		DartFmt:      format.NewLazyFormatProvider(func() format.Provider { return dartfmt.NewDartCmdFormatter(external...) }),
+		TerraformFmt: format.NewLazyFormatProvider(func() format.Provider { return terraformfmt.NewTerraformCmdFormatter(external...) }),
+		SwiftFmt:     format.NewLazyFormatProvider(func() format.Provider { return swiftfmt.NewSwiftCmdFormatter(external...) }),
 		GoFmt:        format.NewLazyFormatProvider(func() format.Provider { return gofmt.NewFormatter() }),
+		JSONFmt:      format.NewLazyFormatProvider(func() format.Provider { return jsonfmt.NewFormatter(jsonfmt.DialectJSON) }),
+		JSONCFmt:     format.NewLazyFormatProvider(func() format.Provider { return jsonfmt.NewFormatter(jsonfmt.DialectJSONC) }),
+		JSON5Fmt:     format.NewLazyFormatProvider(func() format.Provider { return jsonfmt.NewFormatter(jsonfmt.DialectJSON5) }),
+		TOMLFmt:      format.NewLazyFormatProvider(func() format.Provider { return tomlfmt.NewFormatter() }),
 	}
 
+	// hcl formats its heredocs and markdown its fenced code blocks with the other providers
+	cfg.HCLFmt = format.NewLazyFormatProvider(func() format.Provider { return hclfmt.NewFormatterWithLookup(cfg) })
+	cfg.MarkdownFmt = format.NewLazyFormatProvider(func() format.Provider { return mdfmt.NewFormatter(cfg) })
+
 	return cfg
 }
@@ -0,0 +1,43 @@
+package fmt
+
+import "gitlab.com/tozd/go/errors"
+
+const (
+	// ExitCodeNeedsFormatting is returned by --check when at least one file is not formatted
+	ExitCodeNeedsFormatting = 1
+	// ExitCodeFormatterError is returned when a file could not be formatted at all
+	ExitCodeFormatterError = 2
+)
+
+// ExitError carries the process exit code that should be used for an error, so pipelines
+// can tell a style failure apart from a crash.
+type ExitError struct {
+	Code int
+	Err  error
+	// Reported is set when the reporter already printed the failure, so it is not printed again
+	Reported bool
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code attached to err. Any other error, a bad flag or a missing path,
+// is a failure to run and not a style problem, so it is ExitCodeFormatterError.
+func ExitCode(err error) int {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitCodeFormatterError
+}
+
+// reported reports whether the reporter already printed err
+func reported(err error) bool {
+	var exitErr *ExitError
+	return errors.As(err, &exitErr) && exitErr.Reported
+}
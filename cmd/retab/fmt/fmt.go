@@ -6,26 +6,67 @@ package fmt
 // based on the language style guides provided by Hashicorp. This is done using the official hcl2 library.
 
 import (
+	"bytes"
 	"context"
 	"io"
-	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sync"
 
 	"github.com/rs/zerolog"
-	"github.com/samber/oops"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
+	"github.com/walteh/retab/v2/pkg/daemon"
+	"github.com/walteh/retab/v2/pkg/diff"
 	"github.com/walteh/retab/v2/pkg/editorconfig"
+	"github.com/walteh/retab/v2/pkg/filesystem"
 	"github.com/walteh/retab/v2/pkg/format"
 	"github.com/walteh/retab/v2/pkg/formatters"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
+	"github.com/walteh/retab/v2/pkg/git"
 	"gitlab.com/tozd/go/errors"
 )
 
 type Handler struct {
-	filename            string
+	paths               []string
 	formatter           string // auto, hcl, proto, dart, tf
 	ToStdout            bool
 	FromStdin           bool
+	Check               bool
+	Diff                string // unified, pretty
 	editorconfigContent string
+	noEditorconfig      bool
+	include             []string
+	exclude             []string
+	workers             int
+	noDaemon            bool
+	daemonSocket        string
+	runtime             string
+	noCache             bool
+	staged              bool
+	changed             bool
+	since               string
+	linesChangedOnly    bool
+	preCommit           bool
+	noIgnore            bool
+	gitignore           bool
+	verify              bool
+
+	version string
+	ignorer *filesystem.Ignorer
+	git     *git.Repo
+	daemon  *daemon.Client
+
+	// checkedOptions holds a key for every directory, language and extension whose .editorconfig
+	// options were already checked
+	checkedOptions sync.Map
+	// warned holds the text of every .editorconfig warning already reported
+	warned sync.Map
+
+	fs       afero.Fs
+	stdin    io.Reader
+	reporter reporter
 
 	cfg *formatters.AutoFormatProvider
 }
@@ -34,80 +75,511 @@ func NewFmtCommand() *cobra.Command {
 	me := &Handler{}
 
 	cmd := &cobra.Command{
-		Use:   "fmt",
+		Use:   "fmt [file or directory]...",
 		Short: "format files with the hcl golang library, but with tabs",
 	}
 
 	cmd.Flags().StringVar(&me.formatter, "formatter", "auto", "the formatter to use")
 	cmd.Flags().BoolVar(&me.ToStdout, "stdout", false, "write to stdout instead of file")
 	cmd.Flags().BoolVar(&me.FromStdin, "stdin", false, "read from stdin instead of file")
+	cmd.Flags().BoolVar(&me.Check, "check", false, "list files that are not formatted and exit non-zero instead of writing them")
+	cmd.Flags().StringVar(&me.Diff, "diff", "", "print a diff instead of writing files (unified or pretty)")
+	cmd.Flags().Lookup("diff").NoOptDefVal = diffModeUnified
 	cmd.Flags().StringVar(&me.editorconfigContent, "editorconfig-content", "", "editorconfig content (optional)")
-	cmd.Args = cobra.ExactArgs(1)
+	cmd.Flags().BoolVar(&me.noEditorconfig, "no-editorconfig", false, "ignore .editorconfig files and use the default configuration")
+	cmd.Flags().StringSliceVar(&me.include, "include", nil, "when walking a directory, only format the files whose path in it or name matches these globs")
+	cmd.Flags().StringSliceVar(&me.exclude, "exclude", nil, "skip files and directories matching these globs")
+	cmd.Flags().IntVar(&me.workers, "workers", runtime.NumCPU(), "the number of files to format at the same time")
+	cmd.Flags().BoolVar(&me.noDaemon, "no-daemon", false, "always format in-process, even when a daemon is running")
+	cmd.Flags().StringVar(&me.daemonSocket, "daemon-socket", daemon.DefaultSocketPath(), "the socket of a running retab daemon")
+	cmd.Flags().BoolVar(&me.noCache, "no-cache", false, "do not read or write the format cache")
+	cmd.Flags().StringVar(&me.runtime, "runtime", "", "how external formatters run: auto, native, podman, nerdctl or docker (default $RETAB_RUNTIME or auto)")
+	cmd.Flags().BoolVar(&me.staged, "staged", false, "only format the files with staged changes")
+	cmd.Flags().BoolVar(&me.changed, "changed", false, "only format the files changed in the working tree, untracked files included")
+	cmd.Flags().StringVar(&me.since, "since", "", "only format the files changed since this git ref, uncommitted changes included")
+	cmd.Flags().BoolVar(&me.linesChangedOnly, "lines-changed-only", false, "only format the lines touched by the --staged, --changed or --since changes")
+	cmd.Flags().BoolVar(&me.preCommit, "pre-commit", false, "format the staged files and stage them again, for a git pre-commit hook")
+	cmd.Flags().BoolVar(&me.noIgnore, "no-ignore", false, "also format files that .retabignore, .gitattributes or a generated code marker exclude")
+	cmd.Flags().BoolVar(&me.gitignore, "gitignore", false, "also skip the files .gitignore ignores")
+	cmd.Flags().BoolVar(&me.verify, "verify", false, "fail instead of writing a file when formatting changes its syntax tree or formatting it again changes it")
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		// the git flags select the files themselves, paths only narrow them down
+		if me.gitSelection() {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	}
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		me.filename = args[0]
-		return me.Run(cmd.Context())
+		me.paths = args
+		me.version = cmd.Root().Version
+		me.stdin = cmd.InOrStdin()
+		me.reporter = newTextReporter(cmd.OutOrStdout(), cmd.ErrOrStderr())
+		me.cfg = NewAutoFormatConfig(cmdfmt.WithRuntime(me.runtime))
+		err := me.Run(cmd.Context())
+		if reported(err) {
+			// the failed files are already on stderr with their code frames
+			cmd.SilenceErrors = true
+		}
+		return err
 	}
 
-	me.cfg = NewAutoFormatConfig()
+	me.fs = afero.NewOsFs()
 
 	return cmd
 }
 
+type fileStatus string
+
+const (
+	fileStatusFormatted   fileStatus = "formatted"
+	fileStatusUnchanged   fileStatus = "unchanged"
+	fileStatusUnformatted fileStatus = "unformatted"
+	fileStatusSkipped     fileStatus = "skipped"
+	fileStatusFailed      fileStatus = "failed"
+)
+
+const (
+	diffModeUnified = "unified"
+	diffModePretty  = "pretty"
+)
+
+type fileResult struct {
+	path   string
+	status fileStatus
+	reason string
+	diff   string
+	err    error
+}
+
 func (me *Handler) Run(ctx context.Context) error {
 
 	ctx, exit := trackStats(ctx)
 	defer func() { exit(ctx) }()
 
-	ctx = applyValueToContext(ctx, "filename", me.filename)
+	switch me.Diff {
+	case "", diffModeUnified, diffModePretty:
+	default:
+		return errors.Errorf("unknown diff mode %q, expected %q or %q", me.Diff, diffModeUnified, diffModePretty)
+	}
+
+	cfgProvider := NewConfigurationProvider(ctx, me.editorconfigContent, me.noEditorconfig)
 
-	var err error
-	var cfgProvider format.ConfigurationProvider
-	// Setup editorconfig with either raw content or auto-resolution
-	cfgProvider, err = editorconfig.NewRawConfigurationProvider(ctx, me.editorconfigContent)
-	if err != nil {
-		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to parse editorconfig content, using default configuration")
-		cfgProvider = format.NewDefaultConfigurationProvider()
+	if !me.noCache {
+		ctx = ContextWithFormatCache(ctx, me.version)
+	}
+
+	// the daemon was started with its own runtime and cache, so explicit ones are honoured in-process
+	if !me.noDaemon && me.runtime == "" && !me.noCache {
+		me.daemon = me.connectDaemon(ctx)
 	}
 
-	var input io.ReadSeeker
 	if me.FromStdin {
-		input = os.Stdin
-	} else {
-		file, err := os.Open(me.filename)
-		if err != nil {
-			return errors.Errorf("opening file: %w", err)
+		if len(me.paths) != 1 {
+			return errors.New("exactly one filename is required when reading from stdin")
+		}
+		return me.runStdin(ctx, cfgProvider, me.paths[0])
+	}
+
+	if !me.noIgnore {
+		me.ignorer = filesystem.NewIgnorer(me.fs, me.gitignore)
+	}
+
+	files, err := me.resolveFiles(ctx)
+	if err != nil {
+		return errors.Errorf("resolving files: %w", err)
+	}
+
+	if me.ToStdout && (me.Check || me.Diff != "") {
+		return errors.New("--stdout cannot be used with --check or --diff")
+	}
+
+	if me.ToStdout && len(files) != 1 {
+		return errors.Errorf("--stdout requires exactly one file, found %d", len(files))
+	}
+
+	explicit := map[string]bool{}
+	for _, path := range me.paths {
+		explicit[filepath.Clean(path)] = true
+	}
+
+	results := make([]fileResult, len(files))
+	index := map[string]int{}
+	for i, file := range files {
+		index[file] = i
+	}
+
+	mu := sync.Mutex{}
+	err = filesystem.ForEachFile(ctx, files, me.workers, func(ctx context.Context, filename string) error {
+		res := me.formatFile(ctx, cfgProvider, filename, explicit[filename])
+
+		mu.Lock()
+		results[index[filename]] = res
+		mu.Unlock()
+
+		if res.err != nil {
+			return errors.Errorf("formatting '%s': %w", filename, res.err)
+		}
+		return nil
+	})
+
+	// every file that failed is printed below, an error of restaging is not
+	failed := err != nil
+
+	me.printDiffs(results)
+
+	if !me.ToStdout {
+		me.printSummary(results)
+	} else if results[0].status == fileStatusFailed {
+		me.reporter.file(results[0], me.failedSource(results[0]))
+	}
+
+	var checkErr error
+	if me.Check {
+		checkErr = me.checkResults(results)
+	} else if me.preCommit {
+		if serr := me.restage(ctx, results); serr != nil && err == nil {
+			err = serr
 		}
-		defer file.Close()
-		input = file
 	}
 
-	fmtr, err := me.cfg.GetFormatter(ctx, me.formatter, me.filename, input)
 	if err != nil {
-		return err
+		return &ExitError{Code: ExitCodeFormatterError, Err: err, Reported: failed}
 	}
 
+	return checkErr
+}
+
+// checkResults lists every unformatted file on stdout, one per line, and fails if there are any
+func (me *Handler) checkResults(results []fileResult) error {
+	unformatted := 0
+	for _, res := range results {
+		if res.status == fileStatusUnformatted {
+			unformatted++
+			if me.Diff == "" {
+				// the diff already names every file, so only list them when it is not printed
+				me.reporter.unformatted(res.path)
+			}
+		}
+	}
+
+	if unformatted > 0 {
+		return &ExitError{Code: ExitCodeNeedsFormatting, Err: errors.Errorf("%d file(s) need formatting", unformatted), Reported: true}
+	}
+
+	return nil
+}
+
+func (me *Handler) runStdin(ctx context.Context, cfgProvider format.ConfigurationProvider, filename string) error {
+	ctx = applyValueToContext(ctx, "filename", filename)
+
+	content, err := io.ReadAll(me.stdin)
+	if err != nil {
+		return errors.Errorf("reading stdin: %w", err)
+	}
+
+	formatted, err := me.formatContent(ctx, cfgProvider, filename, content)
+	if err != nil {
+		me.reporter.file(fileResult{path: filename, status: fileStatusFailed, err: err}, content)
+		return &ExitError{Code: ExitCodeFormatterError, Err: err, Reported: true}
+	}
+
+	if me.Check || me.Diff != "" {
+		if bytes.Equal(content, formatted) {
+			return nil
+		}
+		res := fileResult{path: filename, status: fileStatusUnformatted, diff: me.buildDiff(filename, content, formatted)}
+		me.printDiffs([]fileResult{res})
+		if me.Check {
+			return me.checkResults([]fileResult{res})
+		}
+		return nil
+	}
+
+	return me.reporter.content(formatted)
+}
+
+func (me *Handler) formatFile(ctx context.Context, cfgProvider format.ConfigurationProvider, filename string, explicit bool) fileResult {
+	ctx = applyValueToContext(ctx, "filename", filename)
+
+	content, err := afero.ReadFile(me.fs, filename)
+	if err != nil {
+		return fileResult{path: filename, status: fileStatusFailed, err: errors.Errorf("reading file: %w", err)}
+	}
+
+	if reason, ok := me.ignored(filename, content); ok {
+		if me.ToStdout {
+			// whoever reads stdout still gets the file
+			if err := me.reporter.content(content); err != nil {
+				return fileResult{path: filename, status: fileStatusFailed, err: errors.Errorf("writing to stdout: %w", err)}
+			}
+		}
+		return fileResult{path: filename, status: fileStatusSkipped, reason: reason}
+	}
+
+	detection, err := me.cfg.Detect(ctx, me.formatter, filename, bytes.NewReader(content))
+	if err != nil {
+		if !explicit {
+			// files found while walking a directory are only formatted when we know how to
+			return fileResult{path: filename, status: fileStatusSkipped, reason: "no formatter"}
+		}
+		return fileResult{path: filename, status: fileStatusFailed, err: err}
+	}
+	fmtr := detection.Provider
+
+	if me.staged {
+		// formatting would also stage the changes that were left out of the commit
+		partial, err := me.git.HasUnstagedChanges(ctx, filename)
+		if err != nil {
+			return fileResult{path: filename, status: fileStatusFailed, err: err}
+		}
+		if partial {
+			return fileResult{path: filename, status: fileStatusSkipped, reason: "partially staged"}
+		}
+	}
+
+	me.warnOptions(ctx, cfgProvider, filename, detection)
+
 	ctx = applyValueToContext(ctx, "formatter", reflect.TypeOf(fmtr).String())
 
-	r, err := format.Format(ctx, fmtr, cfgProvider, me.filename, input)
+	var formatted []byte
+	if me.linesChangedOnly {
+		formatted, err = me.formatChangedLines(ctx, fmtr, cfgProvider, filename, content)
+	} else {
+		formatted, err = me.formatWith(ctx, fmtr, cfgProvider, filename, content)
+	}
 	if err != nil {
-		return oops.Errorf("formatting content: %w", err)
+		return fileResult{path: filename, status: fileStatusFailed, err: err}
 	}
 
-	if me.ToStdout || me.FromStdin {
-		_, err = io.Copy(os.Stdout, r)
-		return err
+	if err := me.verifyFormatted(ctx, fmtr, cfgProvider, filename, content, formatted); err != nil {
+		return fileResult{path: filename, status: fileStatusFailed, err: err}
+	}
+
+	if me.ToStdout {
+		if err := me.reporter.content(formatted); err != nil {
+			return fileResult{path: filename, status: fileStatusFailed, err: errors.Errorf("writing to stdout: %w", err)}
+		}
+		return fileResult{path: filename, status: fileStatusFormatted}
 	}
 
-	rBytes, err := io.ReadAll(r)
+	if bytes.Equal(content, formatted) {
+		return fileResult{path: filename, status: fileStatusUnchanged}
+	}
+
+	if me.Check || me.Diff != "" {
+		return fileResult{path: filename, status: fileStatusUnformatted, diff: me.buildDiff(filename, content, formatted)}
+	}
+
+	err = afero.WriteFile(me.fs, filename, formatted, 0644)
+	if err != nil {
+		return fileResult{path: filename, status: fileStatusFailed, err: errors.Errorf("writing formatted file: %w", err)}
+	}
+
+	return fileResult{path: filename, status: fileStatusFormatted}
+}
+
+// formatChangedLines formats the syntactic units around the lines git reports as changed, in-process
+// since the daemon only formats whole files
+func (me *Handler) formatChangedLines(ctx context.Context, fmtr format.Provider, cfgProvider format.ConfigurationProvider, filename string, content []byte) ([]byte, error) {
+	ranges, err := me.git.ChangedLines(ctx, me.selection(), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := cfgProvider.GetConfigurationForFileType(ctx, filename)
+	if err != nil {
+		return nil, errors.Errorf("failed to get editorconfig: %w", err)
+	}
+
+	edits, err := format.FormatRanges(ctx, fmtr, cfg, content, ranges)
+	if err != nil {
+		return nil, errors.Errorf("formatting changed lines: %w", err)
+	}
+
+	return format.ApplyEdits(content, edits), nil
+}
+
+func (me *Handler) formatContent(ctx context.Context, cfgProvider format.ConfigurationProvider, filename string, content []byte) ([]byte, error) {
+	fmtr, err := me.cfg.GetFormatter(ctx, me.formatter, filename, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = applyValueToContext(ctx, "formatter", reflect.TypeOf(fmtr).String())
+
+	formatted, err := me.formatWith(ctx, fmtr, cfgProvider, filename, content)
 	if err != nil {
-		return errors.Errorf("reading formatted content: %w", err)
+		return nil, err
+	}
+
+	if err := me.verifyFormatted(ctx, fmtr, cfgProvider, filename, content, formatted); err != nil {
+		return nil, err
+	}
+
+	return formatted, nil
+}
+
+// verifyFormatted checks with --verify that formatted has the syntax tree of content, and that
+// formatting it again changes nothing. A file formatted only around its changed lines is not
+// expected to stay the same when formatted again.
+func (me *Handler) verifyFormatted(ctx context.Context, fmtr format.Provider, cfgProvider format.ConfigurationProvider, filename string, content []byte, formatted []byte) error {
+	if !me.verify || bytes.Equal(content, formatted) {
+		return nil
 	}
 
-	err = os.WriteFile(me.filename, rBytes, 0644)
+	cfg, err := cfgProvider.GetConfigurationForFileType(ctx, filename)
 	if err != nil {
-		return errors.Errorf("writing formatted file: %w", err)
+		return errors.Errorf("failed to get editorconfig: %w", err)
+	}
+
+	if err := format.VerifyEquivalent(ctx, fmtr, cfg, content, formatted); err != nil {
+		return errors.Errorf("verifying: %w", err)
+	}
+
+	if !me.linesChangedOnly {
+		if err := format.VerifyIdempotent(ctx, fmtr, cfg, formatted); err != nil {
+			return errors.Errorf("verifying: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// formatWith hands the file to the daemon when one is connected, and formats in-process
+// when there is none or it cannot be reached
+func (me *Handler) formatWith(ctx context.Context, fmtr format.Provider, cfgProvider format.ConfigurationProvider, filename string, content []byte) ([]byte, error) {
+	if me.daemon != nil {
+		formatted, err := me.formatWithDaemon(ctx, filename, content)
+		if err == nil {
+			return formatted, nil
+		}
+
+		var remoteErr *daemon.RemoteError
+		if errors.As(err, &remoteErr) {
+			return nil, errors.Errorf("formatting with daemon: %w", err)
+		}
+
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("daemon unavailable, formatting in-process")
+	}
+
+	return formatWithProvider(ctx, fmtr, cfgProvider, filename, content)
+}
+
+func (me *Handler) formatWithDaemon(ctx context.Context, filename string, content []byte) ([]byte, error) {
+	// the daemon runs in another working directory
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, errors.Errorf("resolving absolute path: %w", err)
+	}
+
+	return me.daemon.Format(ctx, &daemon.FormatRequest{
+		Filename:       abs,
+		Content:        string(content),
+		Formatter:      me.formatter,
+		Editorconfig:   me.editorconfigContent,
+		NoEditorconfig: me.noEditorconfig,
+	})
+}
+
+func (me *Handler) connectDaemon(ctx context.Context) *daemon.Client {
+	client, err := daemon.Dial(ctx, me.daemonSocket, me.version)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("socket", me.daemonSocket).Msg("no daemon, formatting in-process")
+		return nil
+	}
+
+	zerolog.Ctx(ctx).Debug().Str("socket", me.daemonSocket).Msg("formatting with daemon")
+	return client
+}
+
+func (me *Handler) buildDiff(filename string, before []byte, after []byte) string {
+	if me.Diff == "" {
+		return ""
+	}
+
+	patch := diff.ConvertToPatchString(filepath.ToSlash(filename), string(before), string(after))
+	if me.Diff != diffModePretty || patch == "" {
+		return patch
+	}
+
+	ud, err := diff.ParseUnifiedDiff(patch)
+	if err != nil {
+		// the raw patch is still useful if it cannot be made pretty
+		return patch
+	}
+
+	return ud.PrettyPatch()
+}
+
+// printDiffs writes the diffs in file order once all workers are done, so they never interleave
+func (me *Handler) printDiffs(results []fileResult) {
+	for _, res := range results {
+		if res.diff != "" {
+			me.reporter.diff(res.diff)
+		}
+	}
+}
+
+func (me *Handler) printSummary(results []fileResult) {
+	counts := map[fileStatus]int{}
+	for _, res := range results {
+		counts[res.status]++
+		me.reporter.file(res, me.failedSource(res))
+	}
+
+	me.reporter.summary(counts, len(results))
+}
+
+// failedSource is the content of a file that failed with diagnostics, for their code frames. The
+// file was not written so it is read again.
+func (me *Handler) failedSource(res fileResult) []byte {
+	var diags format.Diagnostics
+	if res.status != fileStatusFailed || !errors.As(res.err, &diags) {
+		return nil
+	}
+	content, err := afero.ReadFile(me.fs, res.path)
+	if err != nil {
+		return nil
+	}
+	return content
+}
+
+// ignored reports why a file is left alone: an ignore file or .gitattributes names it, or it
+// was generated
+func (me *Handler) ignored(filename string, content []byte) (string, bool) {
+	if me.noIgnore {
+		return "", false
+	}
+	if reason, ok := me.ignorer.Ignored(filename, false); ok {
+		return reason, true
+	}
+	return formatters.Generated(filename, content)
+}
+
+// warnOptions logs the .editorconfig settings for filename that look like mistakes, once per
+// directory and language and once per warning
+func (me *Handler) warnOptions(ctx context.Context, cfgProvider format.ConfigurationProvider, filename string, detection *formatters.Detection) {
+	ecProvider, ok := cfgProvider.(*editorconfig.EditorConfigConfigurationProvider)
+	if !ok {
+		return
+	}
+
+	key := filepath.Dir(filename) + "\x00" + detection.Language + "\x00" + filepath.Ext(filename)
+	if _, loaded := me.checkedOptions.LoadOrStore(key, true); loaded {
+		return
+	}
+
+	sources, err := ecProvider.Sources(ctx, filename)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("tracing editorconfig sources")
+		return
+	}
+
+	for _, warning := range formatters.CheckOptions(detection, sources) {
+		if _, loaded := me.warned.LoadOrStore(warning.String(), true); loaded {
+			continue
+		}
+		me.reporter.warning(warning.String())
+	}
+}
@@ -0,0 +1,142 @@
+//go:build !js
+
+package fmt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	"github.com/walteh/retab/v2/pkg/diff"
+)
+
+// run runs retab fmt with args and returns everything written to the process stdout, so output
+// that bypasses the command's writers is caught too
+func run(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err, "creating a pipe should succeed")
+
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	stdout := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		stdout <- out
+	}()
+
+	var stderr bytes.Buffer
+	cmd := fmtcmd.NewFmtCommand()
+	cmd.SetErr(&stderr)
+	cmd.SilenceUsage = true
+	cmd.SetArgs(append([]string{"--no-daemon", "--no-cache", "--no-editorconfig"}, args...))
+	runErr := cmd.ExecuteContext(context.Background())
+
+	os.Stdout = orig
+	require.NoError(t, w.Close(), "closing the pipe should succeed")
+
+	return string(<-stdout), stderr.String(), runErr
+}
+
+// TestStdoutIsOnlyTheFormattedFile formats every sample twice, once in place and once with
+// --stdout, and checks stdout holds exactly the bytes written to the file
+func TestStdoutIsOnlyTheFormattedFile(t *testing.T) {
+	samples, err := os.ReadDir("../../../samples")
+	require.NoError(t, err, "reading the samples should succeed")
+
+	for _, sample := range samples {
+		t.Run(sample.Name(), func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("../../../samples", sample.Name()))
+			require.NoError(t, err, "reading the sample should succeed")
+
+			dir := t.TempDir()
+			inPlace := filepath.Join(dir, "in-place", sample.Name())
+			toStdout := filepath.Join(dir, "stdout", sample.Name())
+			for _, path := range []string{inPlace, toStdout} {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755), "creating the sample dir should succeed")
+				require.NoError(t, os.WriteFile(path, src, 0o644), "copying the sample should succeed")
+			}
+
+			_, stderr, err := run(t, inPlace)
+			if err != nil {
+				t.Skipf("the formatter of %s cannot run here: %s", sample.Name(), stderr)
+			}
+
+			want, err := os.ReadFile(inPlace)
+			require.NoError(t, err, "reading the formatted sample should succeed")
+
+			got, _, err := run(t, "--stdout", toStdout)
+			require.NoError(t, err, "formatting to stdout should succeed")
+
+			diff.Require(t).Want(string(want)).Got(got).Equals()
+		})
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	unformatted := filepath.Join(dir, "a.hcl")
+	require.NoError(t, os.WriteFile(unformatted, []byte("a  =  1\n"), 0o644), "writing the file should succeed")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "needs_formatting", args: []string{"--check", unformatted}, want: fmtcmd.ExitCodeNeedsFormatting},
+		{name: "missing_path", args: []string{filepath.Join(dir, "missing.hcl")}, want: fmtcmd.ExitCodeFormatterError},
+		{name: "unknown_diff_mode", args: []string{"--diff=bogus", unformatted}, want: fmtcmd.ExitCodeFormatterError},
+		{name: "stdout_with_check", args: []string{"--stdout", "--check", unformatted}, want: fmtcmd.ExitCodeFormatterError},
+		{name: "unknown_flag", args: []string{"--bogus", unformatted}, want: fmtcmd.ExitCodeFormatterError},
+		{name: "no_paths", args: []string{}, want: fmtcmd.ExitCodeFormatterError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := run(t, tt.args...)
+			require.Error(t, err, "the run should fail")
+			assert.Equal(t, tt.want, fmtcmd.ExitCode(err), "the exit code should tell a style failure from a failure to run")
+		})
+	}
+}
+
+func TestInvalidOptionWarns(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = true\n\n[*.yaml]\nindent_style = space\npad_line_comments = two\n"), 0o644), "writing the editorconfig should succeed")
+	file := filepath.Join(dir, "a.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("a:   1   # c\n"), 0o644), "writing the file should succeed")
+
+	_, stderr, err := run(t, "--no-editorconfig=false", file)
+	require.NoError(t, err, "an invalid option should not fail formatting")
+	assert.Contains(t, stderr, `invalid pad_line_comments "two"`, "the invalid option should be reported")
+
+	got, err := os.ReadFile(file)
+	require.NoError(t, err, "reading the formatted file should succeed")
+	assert.Equal(t, "a: 1 # c\n", string(got), "the option should fall back to its default")
+}
+
+func TestFailureIsPrintedOnce(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "a.hcl")
+	require.NoError(t, os.WriteFile(broken, []byte("a {\n  b = 1 c = 2\n}\n"), 0o644), "writing the file should succeed")
+
+	_, stderr, err := run(t, broken)
+	require.Error(t, err, "formatting a broken file should fail")
+	assert.Equal(t, fmtcmd.ExitCodeFormatterError, fmtcmd.ExitCode(err), "a broken file should be a formatter error")
+	assert.Equal(t, 1, strings.Count(stderr, "Missing newline after argument"), "the failure should be printed once, in its code frame")
+	assert.NotContains(t, stderr, "Error:", "cobra should not print the failure again")
+
+	_, stderr, err = run(t, filepath.Join(dir, "missing.hcl"))
+	require.Error(t, err, "formatting a missing file should fail")
+	assert.Contains(t, stderr, "Error: resolving files", "an error the reporter never saw should still be printed")
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/walteh/retab/v2/pkg/editorconfig"
 	"github.com/walteh/retab/v2/pkg/format"
 	"github.com/walteh/retab/v2/pkg/formatters"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
 	"gitlab.com/tozd/go/errors"
 )
 
@@ -23,7 +24,8 @@ var (
 var cfg *formatters.AutoFormatProvider
 
 func init() {
-	cfg = NewAutoFormatConfig()
+	// commands are run by the host page, which only knows docker
+	cfg = NewAutoFormatConfig(cmdfmt.WithRuntime(cmdfmt.RuntimeDocker))
 }
 
 func Fmt(ctx context.Context, this js.Value, args []js.Value) (string, error) {
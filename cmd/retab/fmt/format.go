@@ -0,0 +1,82 @@
+package fmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/oops"
+	"github.com/walteh/retab/v2/pkg/cache"
+	"github.com/walteh/retab/v2/pkg/editorconfig"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters"
+	"gitlab.com/tozd/go/errors"
+)
+
+// NewConfigurationProvider parses the raw editorconfig content when it is given. Otherwise the
+// .editorconfig files above each formatted file are used, unless noEditorconfig is set, in which
+// case (and when the content cannot be parsed) the default configuration applies.
+func NewConfigurationProvider(ctx context.Context, editorconfigContent string, noEditorconfig bool) format.ConfigurationProvider {
+	if editorconfigContent == "" {
+		if noEditorconfig {
+			return format.NewDefaultConfigurationProvider()
+		}
+		return editorconfig.NewHierarchicalConfigurationProvider(ctx)
+	}
+
+	cfgProvider, err := editorconfig.NewRawConfigurationProvider(ctx, editorconfigContent)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to parse editorconfig content, using default configuration")
+		return format.NewDefaultConfigurationProvider()
+	}
+	return cfgProvider
+}
+
+// ContextWithFormatCache enables the on-disk format cache. Development builds (no version, or one
+// built from a dirty tree) do not identify their formatters, so they never cache.
+func ContextWithFormatCache(ctx context.Context, version string) context.Context {
+	if version == "" || version == "(devel)" || version == "unknown" || strings.HasSuffix(version, "+dirty") {
+		zerolog.Ctx(ctx).Debug().Str("version", version).Msg("format cache disabled for development build")
+		return ctx
+	}
+
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("format cache disabled")
+		return ctx
+	}
+
+	return format.ContextWithCache(ctx, cache.New(dir), version)
+}
+
+// FormatBytes formats content the same way `retab fmt` does in-process, it is what the daemon runs
+// for every request
+func FormatBytes(ctx context.Context, fmts *formatters.AutoFormatProvider, cfgProvider format.ConfigurationProvider, formatter string, filename string, content []byte) ([]byte, error) {
+	ctx = applyValueToContext(ctx, "filename", filename)
+
+	fmtr, err := fmts.GetFormatter(ctx, formatter, filename, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = applyValueToContext(ctx, "formatter", reflect.TypeOf(fmtr).String())
+
+	return formatWithProvider(ctx, fmtr, cfgProvider, filename, content)
+}
+
+func formatWithProvider(ctx context.Context, fmtr format.Provider, cfgProvider format.ConfigurationProvider, filename string, content []byte) ([]byte, error) {
+	r, err := format.Format(ctx, fmtr, cfgProvider, filename, bytes.NewReader(content))
+	if err != nil {
+		return nil, oops.Errorf("formatting content: %w", err)
+	}
+
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("reading formatted content: %w", err)
+	}
+
+	return formatted, nil
+}
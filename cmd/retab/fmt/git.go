@@ -0,0 +1,111 @@
+//go:build !js
+
+package fmt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/walteh/retab/v2/pkg/filesystem"
+	"github.com/walteh/retab/v2/pkg/git"
+	"gitlab.com/tozd/go/errors"
+)
+
+// gitSelection reports whether the files to format come from git
+func (me *Handler) gitSelection() bool {
+	return me.staged || me.changed || me.since != "" || me.preCommit
+}
+
+func (me *Handler) selection() git.Selection {
+	return git.Selection{Staged: me.staged, Since: me.since}
+}
+
+// resolveFiles expands the paths, or with a git flag lists the changed files under them
+func (me *Handler) resolveFiles(ctx context.Context) ([]string, error) {
+	if !me.gitSelection() {
+		if me.linesChangedOnly {
+			return nil, errors.New("--lines-changed-only needs --staged, --changed, --since or --pre-commit")
+		}
+		return filesystem.ExpandPaths(ctx, me.fs, me.paths, me.include, me.exclude, me.ignorer)
+	}
+
+	if me.preCommit {
+		me.staged = true
+	}
+
+	selected := 0
+	for _, set := range []bool{me.staged, me.changed, me.since != ""} {
+		if set {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return nil, errors.New("only one of --staged, --changed, --since and --pre-commit can be used")
+	}
+
+	repo, err := git.Open(ctx, ".")
+	if err != nil {
+		return nil, err
+	}
+	me.git = repo
+
+	changed, err := repo.Files(ctx, me.selection())
+	if err != nil {
+		return nil, err
+	}
+
+	roots := me.paths
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	for i, root := range roots {
+		if roots[i], err = filepath.Abs(root); err != nil {
+			return nil, errors.Errorf("resolving '%s': %w", root, err)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, errors.Errorf("getting working directory: %w", err)
+	}
+
+	files := []string{}
+	for _, file := range changed {
+		if !under(file, roots) {
+			continue
+		}
+		// a changed submodule is listed as its directory
+		if isDir, _ := afero.IsDir(me.fs, file); isDir {
+			continue
+		}
+		if rel, err := filepath.Rel(cwd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+		files = append(files, file)
+	}
+
+	return filesystem.ExpandPaths(ctx, me.fs, files, nil, me.exclude, me.ignorer)
+}
+
+// restage stages the files that were formatted again, so the commit has the formatted version
+func (me *Handler) restage(ctx context.Context, results []fileResult) error {
+	formatted := []string{}
+	for _, res := range results {
+		if res.status == fileStatusFormatted {
+			formatted = append(formatted, res.path)
+		}
+	}
+	return me.git.Add(ctx, formatted...)
+}
+
+func under(file string, roots []string) bool {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, file); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
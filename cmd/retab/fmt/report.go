@@ -0,0 +1,94 @@
+//go:build !js
+
+package fmt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+// reporter receives everything a run prints. The formatted content, the diffs and the list of
+// unformatted files are what a run produces, so the text reporter writes them to stdout and keeps
+// stdout clean of anything else: progress, warnings and errors go to stderr.
+type reporter interface {
+	// content is a formatted file of --stdout or --stdin
+	content(content []byte) error
+	diff(patch string)
+	unformatted(path string)
+	// file is the result of one file, source is its content when it failed with diagnostics
+	file(res fileResult, source []byte)
+	summary(counts map[fileStatus]int, total int)
+	warning(message string)
+}
+
+type textReporter struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func newTextReporter(stdout io.Writer, stderr io.Writer) *textReporter {
+	return &textReporter{stdout: stdout, stderr: stderr}
+}
+
+func (me *textReporter) content(content []byte) error {
+	_, err := me.stdout.Write(content)
+	return err
+}
+
+func (me *textReporter) diff(patch string) {
+	fmt.Fprint(me.stdout, patch)
+}
+
+func (me *textReporter) unformatted(path string) {
+	fmt.Fprintln(me.stdout, path)
+}
+
+func (me *textReporter) file(res fileResult, source []byte) {
+	switch res.status {
+	case fileStatusSkipped:
+		fmt.Fprintf(me.stderr, "%-12s %s (%s)\n", res.status, res.path, res.reason)
+	case fileStatusFailed:
+		if frames := codeFrames(res.path, source, res.err); frames != "" {
+			// the frames carry the messages
+			fmt.Fprintf(me.stderr, "%-12s %s\n%s", res.status, res.path, frames)
+			return
+		}
+		fmt.Fprintf(me.stderr, "%-12s %s: %v\n", res.status, res.path, res.err)
+	default:
+		fmt.Fprintf(me.stderr, "%-12s %s\n", res.status, res.path)
+	}
+}
+
+func (me *textReporter) summary(counts map[fileStatus]int, total int) {
+	fmt.Fprintf(me.stderr, "%d files: %d formatted, %d unchanged, %d unformatted, %d skipped, %d failed\n",
+		total,
+		counts[fileStatusFormatted],
+		counts[fileStatusUnchanged],
+		counts[fileStatusUnformatted],
+		counts[fileStatusSkipped],
+		counts[fileStatusFailed],
+	)
+}
+
+func (me *textReporter) warning(message string) {
+	fmt.Fprintf(me.stderr, "%-12s %s\n", "warning", message)
+}
+
+// codeFrames renders a code frame for each diagnostic of err, or nothing when err has none
+func codeFrames(filename string, source []byte, err error) string {
+	var diags format.Diagnostics
+	if source == nil || !errors.As(err, &diags) {
+		return ""
+	}
+	var out strings.Builder
+	for _, diag := range diags {
+		// the daemon reports absolute paths, the frame uses the path the file was given as
+		diag.File = filename
+		out.WriteString(diag.Frame(source))
+	}
+	return out.String()
+}
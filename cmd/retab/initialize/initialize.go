@@ -0,0 +1,107 @@
+//go:build !js
+
+package initialize
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/filesystem"
+	"github.com/walteh/retab/v2/pkg/formatters"
+	"gitlab.com/tozd/go/errors"
+)
+
+type Handler struct {
+	write   bool
+	force   bool
+	exclude []string
+
+	fs     afero.Fs
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func NewInitCommand() *cobra.Command {
+	me := &Handler{}
+
+	cmd := &cobra.Command{
+		Use:   "init [dir]",
+		Short: "write an .editorconfig for the languages and indentation found in a directory",
+		Long: `init walks dir (the current directory by default), detects the language of every file like
+retab fmt does and measures the indentation the files of each language already use. It prints the
+.editorconfig it would write as a diff, and writes it with --write.`,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	cmd.Flags().BoolVar(&me.write, "write", false, "write the .editorconfig instead of printing the diff")
+	cmd.Flags().BoolVar(&me.force, "force", false, "replace an existing .editorconfig")
+	cmd.Flags().StringSliceVar(&me.exclude, "exclude", nil, "skip files and directories matching these globs")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		me.fs = afero.NewOsFs()
+		me.stdout = cmd.OutOrStdout()
+		me.stderr = cmd.ErrOrStderr()
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		return me.Run(cmd.Context(), dir)
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context, dir string) error {
+	files, err := filesystem.ExpandPaths(ctx, me.fs, []string{dir}, nil, me.exclude, filesystem.NewIgnorer(me.fs, true))
+	if err != nil {
+		return errors.Errorf("resolving files: %w", err)
+	}
+
+	survey := formatters.NewSurvey(fmtcmd.NewAutoFormatConfig())
+	for _, file := range files {
+		content, err := afero.ReadFile(me.fs, file)
+		if err != nil {
+			return errors.Errorf("reading '%s': %w", file, err)
+		}
+		if _, generated := formatters.Generated(file, content); generated {
+			continue
+		}
+		survey.Add(ctx, file, content)
+	}
+
+	for _, lang := range survey.Languages() {
+		fmt.Fprintf(me.stderr, "found %d %s file(s)\n", lang.Files, lang.Config.LangIds[0])
+	}
+
+	path := filepath.Join(dir, ".editorconfig")
+	proposed := survey.EditorConfig()
+
+	existing, err := afero.ReadFile(me.fs, path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Errorf("reading '%s': %w", path, err)
+	}
+
+	if !me.write {
+		fmt.Fprint(me.stdout, diff.ConvertToPatchString(filepath.ToSlash(path), string(existing), proposed))
+		fmt.Fprintln(me.stderr, "run again with --write to write it")
+		return nil
+	}
+
+	if existing != nil && !me.force {
+		return errors.Errorf("%s already exists, pass --force to replace it", path)
+	}
+
+	if err := afero.WriteFile(me.fs, path, []byte(proposed), 0644); err != nil {
+		return errors.Errorf("writing '%s': %w", path, err)
+	}
+	fmt.Fprintf(me.stderr, "wrote %s\n", path)
+
+	return nil
+}
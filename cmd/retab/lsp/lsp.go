@@ -0,0 +1,29 @@
+//go:build !js
+
+package lsp
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	retablsp "github.com/walteh/retab/v2/pkg/lsp"
+)
+
+func NewLspCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lsp",
+		Short: "run a language server over stdio that formats documents with retab",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		// stdout belongs to the protocol, logs are written to stderr so they never end up in it
+		ctx := zerolog.Ctx(cmd.Context()).Output(zerolog.ConsoleWriter{Out: cmd.ErrOrStderr()}).WithContext(cmd.Context())
+
+		server := retablsp.NewServer(fmtcmd.NewAutoFormatConfig(), cmd.Root().Version)
+
+		return server.Serve(ctx, cmd.InOrStdin(), cmd.OutOrStdout())
+	}
+
+	return cmd
+}
@@ -6,20 +6,49 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
 
+	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
+	cachecmd "github.com/walteh/retab/v2/cmd/retab/cache"
+	configcmd "github.com/walteh/retab/v2/cmd/retab/config"
+	daemoncmd "github.com/walteh/retab/v2/cmd/retab/daemon"
+	explaincmd "github.com/walteh/retab/v2/cmd/retab/explain"
 	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	initcmd "github.com/walteh/retab/v2/cmd/retab/initialize"
+	lspcmd "github.com/walteh/retab/v2/cmd/retab/lsp"
+	optionscmd "github.com/walteh/retab/v2/cmd/retab/options"
+	yamlnormalizecmd "github.com/walteh/retab/v2/cmd/retab/yamlnormalize"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
 )
 
 func main() {
-	ctx := context.Background()
+	// cancelling on a signal stops running formatters, so the containers below are still removed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// logs go to stderr, stdout only carries what a command outputs
+	level := zerolog.WarnLevel
+	if parsed, err := zerolog.ParseLevel(os.Getenv("RETAB_LOG_LEVEL")); err == nil && parsed != zerolog.NoLevel {
+		level = parsed
+	}
+	ctx = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level).With().Timestamp().Logger().WithContext(ctx)
 
 	cmd := &cobra.Command{
 		Use: "retab",
 	}
 
 	cmd.AddCommand(fmtcmd.NewFmtCommand())
+	cmd.AddCommand(lspcmd.NewLspCommand())
+	cmd.AddCommand(daemoncmd.NewDaemonCommand())
+	cmd.AddCommand(explaincmd.NewExplainCommand())
+	cmd.AddCommand(cachecmd.NewCacheCommand())
+	cmd.AddCommand(configcmd.NewConfigCommand())
+	cmd.AddCommand(optionscmd.NewOptionsCommand())
+	cmd.AddCommand(initcmd.NewInitCommand())
+	cmd.AddCommand(yamlnormalizecmd.NewYAMLNormalizeCommand())
 
 	info, ok := debug.ReadBuildInfo()
 	if !ok {
@@ -40,11 +69,16 @@ func main() {
 
 	cmd.InitDefaultVersionFlag()
 
-	// cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
-	if err := cmd.ExecuteContext(ctx); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	err := cmd.ExecuteContext(ctx)
+
+	if rerr := cmdfmt.RemoveContainers(context.Background()); rerr != nil {
+		fmt.Fprintln(os.Stderr, "failed to remove formatter containers:", rerr)
+	}
+
+	if err != nil {
+		// cobra, or the reporter of fmt, has already printed the error to stderr
+		os.Exit(fmtcmd.ExitCode(err))
 	}
 }
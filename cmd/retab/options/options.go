@@ -0,0 +1,145 @@
+//go:build !js
+
+package options
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+
+	// the providers register their options when they are linked in
+	_ "github.com/walteh/retab/v2/pkg/formatters"
+)
+
+func NewOptionsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "options",
+		Short: "list the .editorconfig options retab reads",
+	}
+
+	cmd.AddCommand(newListCommand())
+	cmd.AddCommand(newSchemaCommand())
+
+	return cmd
+}
+
+type ListHandler struct {
+	json     bool
+	markdown bool
+
+	stdout io.Writer
+}
+
+// listedOption is an option as printed by `retab options list --json`
+type listedOption struct {
+	Provider string   `json:"provider"`
+	Key      string   `json:"key"`
+	Type     string   `json:"type"`
+	Default  string   `json:"default,omitempty"`
+	Values   []string `json:"values,omitempty"`
+	Doc      string   `json:"doc"`
+}
+
+func newListCommand() *cobra.Command {
+	me := &ListHandler{}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list every option with its type, default and documentation",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Flags().BoolVar(&me.json, "json", false, "print the options as json")
+	cmd.Flags().BoolVar(&me.markdown, "markdown", false, "print the options as markdown tables, for the docs")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		me.stdout = cmd.OutOrStdout()
+		return me.Run(cmd.Context())
+	}
+
+	return cmd
+}
+
+func (me *ListHandler) Run(ctx context.Context) error {
+	sets := format.RegisteredOptions()
+
+	switch {
+	case me.json:
+		listed := []*listedOption{}
+		for _, set := range sets {
+			for _, opt := range set.Options {
+				listed = append(listed, &listedOption{Provider: set.Provider, Key: opt.Key, Type: string(opt.Type), Default: opt.Default, Values: opt.Values, Doc: opt.Doc})
+			}
+		}
+		enc := json.NewEncoder(me.stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(listed); err != nil {
+			return errors.Errorf("writing options: %w", err)
+		}
+		return nil
+	case me.markdown:
+		return writeMarkdown(me.stdout, sets)
+	}
+
+	tw := tabwriter.NewWriter(me.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tKEY\tTYPE\tDEFAULT\tDESCRIPTION")
+	for _, set := range sets {
+		for _, opt := range set.Options {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", set.Provider, opt.Key, typeName(opt), opt.Default, opt.Doc)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeMarkdown(w io.Writer, sets []*format.OptionSet) error {
+	for i, set := range sets {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "#### %s\n\n", set.Provider)
+		fmt.Fprintln(w, "| key | type | default | description |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- |")
+		for _, opt := range set.Options {
+			def := ""
+			if opt.Default != "" {
+				def = "`" + opt.Default + "`"
+			}
+			fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", opt.Key, strings.ReplaceAll(typeName(opt), "|", `\|`), def, opt.Doc)
+		}
+	}
+	return nil
+}
+
+// typeName is the type with the values an enum or list allows, or the words an int accepts
+func typeName(opt *format.Option) string {
+	if len(opt.Values) == 0 {
+		return string(opt.Type)
+	}
+	return fmt.Sprintf("%s (%s)", opt.Type, strings.Join(opt.Values, "|"))
+}
+
+func newSchemaCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "print a JSON Schema of the keys of an .editorconfig section",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(format.OptionsJSONSchema(format.RegisteredOptions())); err != nil {
+			return errors.Errorf("writing schema: %w", err)
+		}
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,126 @@
+//go:build !js
+
+package yamlnormalize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	fmtcmd "github.com/walteh/retab/v2/cmd/retab/fmt"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/yamlfmt"
+	"gitlab.com/tozd/go/errors"
+)
+
+const (
+	toSpaces = "spaces"
+	toTabs   = "tabs"
+)
+
+type Handler struct {
+	to                  string
+	check               bool
+	stdout              bool
+	editorconfigContent string
+	noEditorconfig      bool
+
+	out io.Writer
+}
+
+func NewYAMLNormalizeCommand() *cobra.Command {
+	me := &Handler{}
+
+	cmd := &cobra.Command{
+		Use:   "yaml-normalize [file]...",
+		Short: "convert yaml indentation between visual tabs (yaml_tabs = visual) and spaces",
+		Long: `yaml-normalize converts the leading tabs of yaml files written with yaml_tabs = visual to the
+spaces yaml tools expect, or back. A tab stands for indent_size spaces of the file's editorconfig.`,
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	cmd.Flags().StringVar(&me.to, "to", toSpaces, "the indentation to convert to: spaces or tabs")
+	cmd.Flags().BoolVar(&me.check, "check", false, "list the files that are not converted yet and fail, without writing them")
+	cmd.Flags().BoolVar(&me.stdout, "stdout", false, "print the converted files instead of writing them")
+	cmd.Flags().StringVar(&me.editorconfigContent, "editorconfig-content", "", "editorconfig content (optional)")
+	cmd.Flags().BoolVar(&me.noEditorconfig, "no-editorconfig", false, "ignore .editorconfig files and use the default configuration")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		me.out = cmd.OutOrStdout()
+		return me.Run(cmd.Context(), args)
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context, paths []string) error {
+	if me.to != toSpaces && me.to != toTabs {
+		return errors.Errorf("unknown --to %q, expected %s or %s", me.to, toSpaces, toTabs)
+	}
+
+	cfgProvider := fmtcmd.NewConfigurationProvider(ctx, me.editorconfigContent, me.noEditorconfig)
+
+	unconverted := 0
+	for _, path := range paths {
+		changed, err := me.convert(ctx, cfgProvider, path)
+		if err != nil {
+			return &fmtcmd.ExitError{Code: fmtcmd.ExitCodeFormatterError, Err: errors.Errorf("converting %s: %w", path, err)}
+		}
+		if changed && me.check {
+			unconverted++
+			fmt.Fprintln(me.out, path)
+		}
+	}
+
+	if unconverted > 0 {
+		return &fmtcmd.ExitError{Code: fmtcmd.ExitCodeNeedsFormatting, Err: errors.Errorf("%d file(s) are not indented with %s", unconverted, me.to)}
+	}
+
+	return nil
+}
+
+// convert converts one file and reports whether its content changed
+func (me *Handler) convert(ctx context.Context, cfgProvider format.ConfigurationProvider, path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, errors.Errorf("reading file: %w", err)
+	}
+
+	cfg, err := cfgProvider.GetConfigurationForFileType(ctx, path)
+	if err != nil {
+		return false, errors.Errorf("resolving configuration: %w", err)
+	}
+	width := yamlfmt.VisualWidth(cfg)
+
+	converted := yamlfmt.ExpandTabs(content, width)
+	if me.to == toTabs {
+		// start from spaces so files that mix both end up with tabs only
+		converted, err = yamlfmt.ToVisualTabs(converted, width)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	changed := !bytes.Equal(content, converted)
+
+	switch {
+	case me.check:
+	case me.stdout:
+		if _, err := me.out.Write(converted); err != nil {
+			return false, errors.Errorf("writing output: %w", err)
+		}
+	case changed:
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, errors.Errorf("reading file mode: %w", err)
+		}
+		if err := os.WriteFile(path, converted, info.Mode().Perm()); err != nil {
+			return false, errors.Errorf("writing file: %w", err)
+		}
+	}
+
+	return changed, nil
+}
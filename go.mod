@@ -19,6 +19,7 @@ require (
 	github.com/pmezard/go-difflib v1.0.0
 	github.com/rs/xid v1.6.0
 	github.com/rs/zerolog v1.34.0
+	github.com/sabhiram/go-gitignore v0.0.0-20210923224102-525f6e181f06
 	github.com/samber/oops v1.17.0
 	github.com/sergi/go-diff v1.3.1
 	github.com/sourcegraph/go-diff v0.7.0
@@ -27,6 +28,7 @@ require (
 	github.com/stretchr/testify v1.10.0
 	github.com/walteh/goimports-reviser/v3 v3.9.2
 	github.com/walteh/yaml v0.0.0-20250409173318-a722555a2a54
+	github.com/zclconf/go-cty v1.13.0
 	gitlab.com/tozd/go/errors v0.10.0
 	go.uber.org/multierr v1.11.0
 	mvdan.cc/sh/v3 v3.11.0
@@ -49,11 +51,9 @@ require (
 	github.com/petermattis/goid v0.0.0-20250319124200-ccd6737f222a // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/planetscale/vtprotobuf v0.6.1-0.20240319094008-0393e58bdf10 // indirect
-	github.com/sabhiram/go-gitignore v0.0.0-20210923224102-525f6e181f06 // indirect
 	github.com/samber/lo v1.49.1 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
-	github.com/zclconf/go-cty v1.13.0 // indirect
 	go.opentelemetry.io/otel v1.31.0 // indirect
 	go.opentelemetry.io/otel/trace v1.31.0 // indirect
 	golang.org/x/exp v0.0.0-20250210185358-939b2ce775ac // indirect
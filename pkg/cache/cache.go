@@ -0,0 +1,169 @@
+// Package cache keeps formatted output on disk, keyed by format.CacheKey, so unchanged files are
+// not sent through a formatter again.
+package cache
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+// DirEnvVar overrides the cache directory
+const DirEnvVar = "RETAB_CACHE_DIR"
+
+type Cache struct {
+	dir string
+}
+
+var _ format.Cache = (*Cache)(nil)
+
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// DefaultDir is $RETAB_CACHE_DIR, or retab/format under the user cache dir
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(DirEnvVar); dir != "" {
+		return dir, nil
+	}
+
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Errorf("finding user cache dir: %w", err)
+	}
+
+	return filepath.Join(base, "retab", "format"), nil
+}
+
+func (me *Cache) Dir() string {
+	return me.dir
+}
+
+// entries are sharded by the first two characters of the key to keep directories small
+func (me *Cache) path(key string) string {
+	return filepath.Join(me.dir, key[:2], key)
+}
+
+func (me *Cache) Get(ctx context.Context, key string) ([]byte, bool) {
+	data, err := os.ReadFile(me.path(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			zerolog.Ctx(ctx).Debug().Err(err).Str("key", key).Msg("reading cache entry")
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+// Put writes through a temp file and a rename, so concurrent runs never read a partial entry
+func (me *Cache) Put(ctx context.Context, key string, formatted []byte) error {
+	path := me.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Errorf("creating cache dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return errors.Errorf("creating cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(formatted); err != nil {
+		tmp.Close()
+		return errors.Errorf("writing cache entry: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Errorf("closing cache entry: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Errorf("storing cache entry: %w", err)
+	}
+
+	return nil
+}
+
+type Stats struct {
+	Dir     string    `json:"dir"`
+	Entries int       `json:"entries"`
+	Bytes   int64     `json:"bytes"`
+	Oldest  time.Time `json:"oldest,omitzero"`
+	Newest  time.Time `json:"newest,omitzero"`
+}
+
+func (me *Cache) Stats(ctx context.Context) (*Stats, error) {
+	stats := &Stats{Dir: me.dir}
+
+	err := me.walk(func(path string, info fs.FileInfo) error {
+		stats.Entries++
+		stats.Bytes += info.Size()
+		if stats.Oldest.IsZero() || info.ModTime().Before(stats.Oldest) {
+			stats.Oldest = info.ModTime()
+		}
+		if info.ModTime().After(stats.Newest) {
+			stats.Newest = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Clean removes entries last written before now minus olderThan, or every entry when it is zero.
+// It returns how many entries were removed.
+func (me *Cache) Clean(ctx context.Context, olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+
+	removed := 0
+	err := me.walk(func(path string, info fs.FileInfo) error {
+		if olderThan > 0 && info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return errors.Errorf("removing cache entry: %w", err)
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	zerolog.Ctx(ctx).Debug().Int("removed", removed).Str("dir", me.dir).Msg("cleaned format cache")
+
+	return removed, nil
+}
+
+func (me *Cache) walk(fn func(path string, info fs.FileInfo) error) error {
+	err := filepath.WalkDir(me.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == me.dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+	if err != nil {
+		return errors.Errorf("walking cache dir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/cache"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+type countingProvider struct {
+	calls int
+	key   string
+}
+
+func (me *countingProvider) Format(ctx context.Context, cfg format.Configuration, r io.Reader) (io.Reader, error) {
+	me.calls++
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(strings.ToUpper(string(data))), nil
+}
+
+func (me *countingProvider) CacheKey(ctx context.Context) string {
+	return me.key
+}
+
+func formatString(t *testing.T, ctx context.Context, provider format.Provider, tabs bool, input string) string {
+	t.Helper()
+
+	r, err := format.FormatSimple(ctx, provider, "a.txt", tabs, 4, strings.NewReader(input))
+	require.NoError(t, err, "formatting should succeed")
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err, "reading formatted output should succeed")
+
+	return string(out)
+}
+
+func TestFormatUsesCache(t *testing.T) {
+	c := cache.New(t.TempDir())
+	ctx := format.ContextWithCache(context.Background(), c, "v1.0.0")
+
+	provider := &countingProvider{key: "upper"}
+
+	assert.Equal(t, "ABC", formatString(t, ctx, provider, true, "abc"), "a miss should format")
+	assert.Equal(t, "ABC", formatString(t, ctx, provider, true, "abc"), "a hit should return the cached output")
+	assert.Equal(t, 1, provider.calls, "the second format should be served from the cache")
+
+	formatString(t, ctx, provider, true, "abd")
+	assert.Equal(t, 2, provider.calls, "other input should miss")
+
+	formatString(t, ctx, provider, false, "abc")
+	assert.Equal(t, 3, provider.calls, "other configuration should miss")
+
+	formatString(t, ctx, &countingProvider{key: "other"}, true, "abc")
+	assert.Equal(t, 3, provider.calls, "the other provider should be called instead")
+
+	other := &countingProvider{key: "upper"}
+	formatString(t, format.ContextWithCache(context.Background(), c, "v1.0.1"), other, true, "abc")
+	assert.Equal(t, 1, other.calls, "another retab version should miss")
+
+	uncached := &countingProvider{key: "upper"}
+	formatString(t, context.Background(), uncached, true, "abc")
+	assert.Equal(t, 1, uncached.calls, "formatting without a cache should always call the provider")
+}
+
+func TestGetPut(t *testing.T) {
+	ctx := context.Background()
+	c := cache.New(t.TempDir())
+
+	_, ok := c.Get(ctx, "abcdef")
+	assert.False(t, ok, "an unknown key should miss")
+
+	require.NoError(t, c.Put(ctx, "abcdef", []byte("formatted")), "putting should succeed")
+
+	data, ok := c.Get(ctx, "abcdef")
+	assert.True(t, ok, "a stored key should hit")
+	assert.Equal(t, "formatted", string(data), "the stored output should be returned")
+
+	require.NoError(t, c.Put(ctx, "abcdef", []byte("again")), "overwriting should succeed")
+	data, _ = c.Get(ctx, "abcdef")
+	assert.Equal(t, "again", string(data), "the latest output should be returned")
+}
+
+func TestStatsAndClean(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "format")
+	c := cache.New(dir)
+
+	stats, err := c.Stats(ctx)
+	require.NoError(t, err, "stats of a missing cache dir should succeed")
+	assert.Equal(t, 0, stats.Entries, "a missing cache should be empty")
+
+	require.NoError(t, c.Put(ctx, "aa01", bytes.Repeat([]byte("x"), 10)), "putting should succeed")
+	require.NoError(t, c.Put(ctx, "bb02", bytes.Repeat([]byte("y"), 5)), "putting should succeed")
+
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "aa", "aa01"), old, old), "aging an entry should succeed")
+
+	stats, err = c.Stats(ctx)
+	require.NoError(t, err, "stats should succeed")
+	assert.Equal(t, 2, stats.Entries, "both entries should be counted")
+	assert.Equal(t, int64(15), stats.Bytes, "the entry sizes should be summed")
+	assert.True(t, stats.Oldest.Before(stats.Newest), "the oldest entry should be before the newest")
+
+	removed, err := c.Clean(ctx, 24*time.Hour)
+	require.NoError(t, err, "cleaning old entries should succeed")
+	assert.Equal(t, 1, removed, "only the old entry should be removed")
+
+	_, ok := c.Get(ctx, "bb02")
+	assert.True(t, ok, "the recent entry should be kept")
+
+	removed, err = c.Clean(ctx, 0)
+	require.NoError(t, err, "cleaning everything should succeed")
+	assert.Equal(t, 1, removed, "the remaining entry should be removed")
+
+	stats, err = c.Stats(ctx)
+	require.NoError(t, err, "stats should succeed")
+	assert.Equal(t, 0, stats.Entries, "the cache should be empty")
+}
@@ -0,0 +1,95 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+type Client struct {
+	socketPath string
+	nextID     atomic.Int64
+}
+
+// Dial checks that a daemon of the same version is answering on socketPath. Callers should
+// treat any error as "no daemon" and format in-process instead.
+func Dial(ctx context.Context, socketPath string, version string) (*Client, error) {
+	// a socket another user could have put there would write their output into our files
+	if err := checkSocketDir(filepath.Dir(socketPath)); err != nil {
+		return nil, err
+	}
+
+	client := &Client{socketPath: socketPath}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	ping := &PingResponse{}
+	if err := client.call(ctx, methodPing, nil, ping); err != nil {
+		return nil, errors.Errorf("pinging daemon: %w", err)
+	}
+
+	if ping.Version != version {
+		// an older daemon would silently format with outdated providers
+		return nil, errors.Errorf("daemon version %q does not match %q", ping.Version, version)
+	}
+
+	return client, nil
+}
+
+// Format sends one file to the daemon. Errors reported by the formatter are returned as *RemoteError.
+func (me *Client) Format(ctx context.Context, req *FormatRequest) ([]byte, error) {
+	resp := &FormatResponse{}
+	if err := me.call(ctx, methodFormat, req, resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Content), nil
+}
+
+// call uses a fresh connection for every request, unix sockets are cheap and it lets
+// many workers share a single client without coordinating
+func (me *Client) call(ctx context.Context, method string, params any, result any) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "unix", me.socketPath)
+	if err != nil {
+		return errors.Errorf("connecting to daemon: %w", err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &request{JSONRPC: "2.0", ID: me.nextID.Add(1), Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return errors.Errorf("marshalling params: %w", err)
+		}
+		req.Params = raw
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return errors.Errorf("sending request: %w", err)
+	}
+
+	resp := &response{}
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(resp); err != nil {
+		return errors.Errorf("reading response: %w", err)
+	}
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return errors.Errorf("decoding result: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package daemon_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/daemon"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+func socketPath(t *testing.T) string {
+	t.Helper()
+
+	// unix socket paths are limited to ~100 bytes, so t.TempDir can be too long on some systems
+	dir, err := os.MkdirTemp("", "rtd")
+	require.NoError(t, err, "creating socket dir should succeed")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, "d.sock")
+}
+
+func startServer(t *testing.T, socket string, idle time.Duration, fn daemon.FormatFunc) chan error {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	ln, err := daemon.Listen(ctx, socket)
+	require.NoError(t, err, "listening should succeed")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- daemon.NewServer(fn, "v1", idle).Serve(ctx, ln)
+	}()
+
+	return done
+}
+
+func upper(ctx context.Context, req *daemon.FormatRequest) ([]byte, error) {
+	if strings.HasSuffix(req.Filename, ".bad") {
+		return nil, errors.New("cannot parse")
+	}
+	if strings.HasSuffix(req.Filename, ".broken") {
+		return nil, errors.Errorf("formatting: %w", format.Diagnostics{{Line: 1, Column: 2, Severity: format.SeverityError, Message: "unexpected b", Provider: "upper"}})
+	}
+	return []byte(strings.ToUpper(req.Content)), nil
+}
+
+func TestFormat(t *testing.T) {
+	socket := socketPath(t)
+	startServer(t, socket, 0, upper)
+
+	client, err := daemon.Dial(context.Background(), socket, "v1")
+	require.NoError(t, err, "dialing a running daemon should succeed")
+
+	out, err := client.Format(context.Background(), &daemon.FormatRequest{Filename: "a.hcl", Content: "abc"})
+	require.NoError(t, err, "formatting should succeed")
+	assert.Equal(t, "ABC", string(out), "the daemon's formatter should be used")
+
+	_, err = client.Format(context.Background(), &daemon.FormatRequest{Filename: "a.bad", Content: "abc"})
+	require.Error(t, err, "formatter errors should be returned")
+
+	var remoteErr *daemon.RemoteError
+	assert.True(t, errors.As(err, &remoteErr), "formatter errors should be remote errors")
+	assert.Contains(t, err.Error(), "cannot parse", "the formatter message should be kept")
+
+	_, err = client.Format(context.Background(), &daemon.FormatRequest{Filename: "a.broken", Content: "abc"})
+	require.Error(t, err, "formatter errors should be returned")
+
+	var diags format.Diagnostics
+	require.True(t, errors.As(err, &diags), "the diagnostics of a formatter error should be kept")
+	assert.Equal(t, format.Diagnostics{{Line: 1, Column: 2, Severity: format.SeverityError, Message: "unexpected b", Provider: "upper"}}, diags, "the diagnostics should be the formatter's")
+}
+
+func TestDialVersionMismatch(t *testing.T) {
+	socket := socketPath(t)
+	startServer(t, socket, 0, upper)
+
+	_, err := daemon.Dial(context.Background(), socket, "v2")
+	require.Error(t, err, "a daemon of another version should not be used")
+}
+
+func TestDialWithoutDaemon(t *testing.T) {
+	_, err := daemon.Dial(context.Background(), socketPath(t), "v1")
+	require.Error(t, err, "dialing without a daemon should fail")
+}
+
+func TestListenTwice(t *testing.T) {
+	socket := socketPath(t)
+	startServer(t, socket, 0, upper)
+
+	_, err := daemon.Listen(context.Background(), socket)
+	require.Error(t, err, "a second daemon should not steal the socket")
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	socket := socketPath(t)
+	require.NoError(t, os.WriteFile(socket, nil, 0o600), "writing stale socket should succeed")
+
+	ln, err := daemon.Listen(context.Background(), socket)
+	require.NoError(t, err, "a stale socket should be replaced")
+	ln.Close()
+}
+
+func TestIdleTimeout(t *testing.T) {
+	socket := socketPath(t)
+
+	var calls atomic.Int32
+	done := startServer(t, socket, 200*time.Millisecond, func(ctx context.Context, req *daemon.FormatRequest) ([]byte, error) {
+		calls.Add(1)
+		return []byte(req.Content), nil
+	})
+
+	client, err := daemon.Dial(context.Background(), socket, "v1")
+	require.NoError(t, err, "dialing should succeed")
+
+	_, err = client.Format(context.Background(), &daemon.FormatRequest{Filename: "a", Content: "a"})
+	require.NoError(t, err, "formatting should succeed")
+
+	select {
+	case err := <-done:
+		require.NoError(t, err, "an idle daemon should stop cleanly")
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not stop after the idle timeout")
+	}
+
+	assert.Equal(t, int32(1), calls.Load(), "the formatter should have been called once")
+
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err), "the socket should be removed on shutdown")
+}
+
+func TestTinyIdleTimeout(t *testing.T) {
+	done := startServer(t, socketPath(t), time.Nanosecond, func(ctx context.Context, req *daemon.FormatRequest) ([]byte, error) {
+		return []byte(req.Content), nil
+	})
+
+	select {
+	case err := <-done:
+		require.NoError(t, err, "a daemon with a tiny idle timeout should stop cleanly")
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not stop after the idle timeout")
+	}
+}
+
+func TestSocketDirectoryChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, dir string) string
+		wantErr string
+	}{
+		{
+			name:    "owned_and_private",
+			prepare: func(t *testing.T, dir string) string { return dir },
+		},
+		{
+			name: "loose_permissions",
+			prepare: func(t *testing.T, dir string) string {
+				require.NoError(t, os.Chmod(dir, 0o755), "loosening the directory should succeed")
+				return dir
+			},
+			wantErr: "has mode 755, expected 700",
+		},
+		{
+			name: "owned_by_someone_else",
+			prepare: func(t *testing.T, dir string) string {
+				if os.Getuid() != 0 {
+					t.Skip("changing the owner of a directory needs root")
+				}
+				require.NoError(t, os.Chown(dir, 65534, 65534), "giving the directory away should succeed")
+				return dir
+			},
+			wantErr: "is not owned by the current user",
+		},
+		{
+			name: "symlink",
+			prepare: func(t *testing.T, dir string) string {
+				link := dir + "-link"
+				require.NoError(t, os.Symlink(dir, link), "linking the directory should succeed")
+				t.Cleanup(func() { os.Remove(link) })
+				return link
+			},
+			wantErr: "is not a directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket := filepath.Join(tt.prepare(t, filepath.Dir(socketPath(t))), "d.sock")
+
+			ln, err := daemon.Listen(context.Background(), socket)
+			if tt.wantErr == "" {
+				require.NoError(t, err, "listening in a private directory should succeed")
+				ln.Close()
+				return
+			}
+			require.Error(t, err, "listening should be refused")
+			assert.Contains(t, err.Error(), tt.wantErr, "the error should say what is wrong with the directory")
+
+			_, err = daemon.Dial(context.Background(), socket, "v1")
+			require.Error(t, err, "dialing should be refused")
+			assert.Contains(t, err.Error(), tt.wantErr, "the error should say what is wrong with the directory")
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// the daemon speaks newline delimited json-rpc 2.0, one request per connection line
+
+const (
+	methodPing   = "ping"
+	methodFormat = "format"
+
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeFormatFailed   = 1
+)
+
+type FormatRequest struct {
+	Filename     string `json:"filename"`
+	Content      string `json:"content"`
+	Formatter    string `json:"formatter"`
+	Editorconfig string `json:"editorconfig"`
+	// NoEditorconfig skips .editorconfig files when Editorconfig is empty
+	NoEditorconfig bool `json:"no_editorconfig,omitempty"`
+}
+
+type FormatResponse struct {
+	Content string `json:"content"`
+}
+
+type PingResponse struct {
+	Version string `json:"version"`
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RemoteError    `json:"error,omitempty"`
+}
+
+// RemoteError is an error returned by the daemon itself, as opposed to a failure to reach it.
+// A formatter error is a RemoteError, so callers should not retry it in-process.
+type RemoteError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Diagnostics are the diagnostics of a formatter error, so they survive the trip back
+	Diagnostics format.Diagnostics `json:"data,omitempty"`
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("daemon: %s", e.Message)
+}
+
+func (e *RemoteError) Unwrap() error {
+	if len(e.Diagnostics) == 0 {
+		return nil
+	}
+	return e.Diagnostics
+}
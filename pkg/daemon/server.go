@@ -0,0 +1,212 @@
+// Package daemon keeps formatters warm in a long running process and serves format requests
+// over a unix socket, so editors and repeated cli runs skip process and provider start-up.
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gitlab.com/tozd/go/errors"
+)
+
+// FormatFunc formats a single request, it is called concurrently
+type FormatFunc func(ctx context.Context, req *FormatRequest) ([]byte, error)
+
+type Server struct {
+	format      FormatFunc
+	version     string
+	idleTimeout time.Duration
+
+	active       atomic.Int64
+	lastActivity atomic.Int64
+}
+
+func NewServer(format FormatFunc, version string, idleTimeout time.Duration) *Server {
+	return &Server{
+		format:      format,
+		version:     version,
+		idleTimeout: idleTimeout,
+	}
+}
+
+// DefaultSocketPath is in a directory of the user, $XDG_RUNTIME_DIR or else the user cache
+// directory, so daemons of different users never share providers. RETAB_DAEMON_SOCKET overrides it.
+func DefaultSocketPath() string {
+	if path := os.Getenv("RETAB_DAEMON_SOCKET"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "retab", "daemon.sock")
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "retab", "daemon.sock")
+	}
+	// checkSocketDir refuses the directory when another user created it first
+	return filepath.Join(os.TempDir(), "retab-"+strconv.Itoa(os.Getuid()), "daemon.sock")
+}
+
+// Listen creates the unix socket, replacing a stale socket file left behind by a daemon that
+// did not shut down cleanly. It fails if another daemon is still answering on it.
+func Listen(ctx context.Context, socketPath string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0o700); err != nil {
+		return nil, errors.Errorf("creating socket directory: %w", err)
+	}
+	if err := checkSocketDir(filepath.Dir(socketPath)); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(socketPath); err == nil {
+		conn, err := net.DialTimeout("unix", socketPath, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil, errors.Errorf("a daemon is already listening on %s", socketPath)
+		}
+		zerolog.Ctx(ctx).Debug().Str("socket", socketPath).Msg("removing stale socket")
+		if err := os.Remove(socketPath); err != nil {
+			return nil, errors.Errorf("removing stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, errors.Errorf("listening on %s: %w", socketPath, err)
+	}
+
+	return ln, nil
+}
+
+// Serve accepts connections until ctx is done or no request has arrived for the idle timeout.
+func (me *Server) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	me.touch()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	if me.idleTimeout > 0 {
+		go me.watchIdle(ctx, cancel)
+	}
+
+	conns := sync.WaitGroup{}
+	defer conns.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				zerolog.Ctx(ctx).Info().Msg("daemon stopped")
+				return nil
+			}
+			return errors.Errorf("accepting connection: %w", err)
+		}
+
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			me.handleConn(ctx, conn)
+		}()
+	}
+}
+
+func (me *Server) touch() {
+	me.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (me *Server) watchIdle(ctx context.Context, stop func()) {
+	// a tiny timeout would give a zero interval, which the ticker does not accept
+	ticker := time.NewTicker(max(min(me.idleTimeout/4, time.Second), time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			idle := time.Since(time.Unix(0, me.lastActivity.Load()))
+			if me.active.Load() == 0 && idle >= me.idleTimeout {
+				zerolog.Ctx(ctx).Info().Str("idle", idle.String()).Msg("shutting down idle daemon")
+				stop()
+				return
+			}
+		}
+	}
+}
+
+func (me *Server) handleConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	// unblock the decoder below when the daemon stops while the client is idle
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+
+		me.active.Add(1)
+		resp := me.handle(ctx, &req)
+		me.touch()
+		me.active.Add(-1)
+
+		if err := enc.Encode(resp); err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Msg("writing daemon response")
+			return
+		}
+	}
+}
+
+func (me *Server) handle(ctx context.Context, req *request) *response {
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+
+	var result any
+	switch req.Method {
+	case methodPing:
+		result = &PingResponse{Version: me.version}
+	case methodFormat:
+		params := &FormatRequest{}
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			resp.Error = &RemoteError{Code: codeInvalidParams, Message: err.Error()}
+			return resp
+		}
+
+		ctx := zerolog.Ctx(ctx).With().Str("path", params.Filename).Logger().WithContext(ctx)
+
+		out, err := me.format(ctx, params)
+		if err != nil {
+			resp.Error = &RemoteError{Code: codeFormatFailed, Message: err.Error()}
+			errors.As(err, &resp.Error.Diagnostics)
+			return resp
+		}
+		result = &FormatResponse{Content: string(out)}
+	default:
+		resp.Error = &RemoteError{Code: codeMethodNotFound, Message: "unknown method: " + req.Method}
+		return resp
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &RemoteError{Code: codeFormatFailed, Message: err.Error()}
+		return resp
+	}
+	resp.Result = raw
+
+	return resp
+}
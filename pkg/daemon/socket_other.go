@@ -0,0 +1,9 @@
+//go:build !unix
+
+package daemon
+
+// checkSocketDir does nothing where files have no unix owner and mode, the socket directory is
+// in the profile of the user there
+func checkSocketDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package daemon
+
+import (
+	"os"
+	"syscall"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// checkSocketDir fails unless dir is a directory, not a link to one, that only the current user
+// can use. Otherwise another user could have created it and put a socket of their own in it.
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return errors.Errorf("checking socket directory: %w", err)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("socket directory %s is not a directory", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != os.Getuid() {
+		return errors.Errorf("socket directory %s is not owned by the current user", dir)
+	}
+	if info.Mode().Perm() != 0o700 {
+		return errors.Errorf("socket directory %s has mode %o, expected 700", dir, info.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package diff - Patch implementation
+// This file contains the functionality for producing patch-applicable unified diffs
+package diff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const noNewlineMarker = "\\ No newline at end of file"
+
+// ConvertToPatchString creates a unified diff between two versions of a file that can be
+// applied with `patch -p1` or `git apply`. Unlike ConvertToRawUnifiedDiffString it uses
+// real file names, three lines of context and marks a missing trailing newline.
+// An empty string is returned when both versions are equal.
+func ConvertToPatchString(filename string, before string, after string) string {
+	if before == after {
+		return ""
+	}
+
+	a := splitPatchLines(before)
+	b := splitPatchLines(after)
+
+	filename = patchPath(filename)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n", filename)
+	fmt.Fprintf(&out, "+++ b/%s\n", filename)
+
+	matcher := difflib.NewMatcherWithJunk(a, b, false, nil)
+	for _, group := range matcher.GetGroupedOpCodes(3) {
+		first, last := group[0], group[len(group)-1]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", formatPatchRange(first.I1, last.I2), formatPatchRange(first.J1, last.J2))
+
+		for _, op := range group {
+			switch op.Tag {
+			case 'e':
+				writePatchLines(&out, " ", a[op.I1:op.I2])
+			case 'r', 'd':
+				writePatchLines(&out, "-", a[op.I1:op.I2])
+			}
+			if op.Tag == 'r' || op.Tag == 'i' {
+				writePatchLines(&out, "+", b[op.J1:op.J2])
+			}
+		}
+	}
+
+	return out.String()
+}
+
+// patchPath is filename relative to the working directory, where `git apply` and `patch -p1` run.
+// A path outside of it keeps its slashes without the leading one, so the header is still a/<path>.
+func patchPath(filename string) string {
+	path := filepath.FromSlash(filename)
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+		}
+	}
+	return strings.TrimLeft(filepath.ToSlash(filepath.Clean(path)), "/")
+}
+
+// splitPatchLines splits s into lines that keep their trailing newline, so a
+// missing newline at the end of the file is still visible to the matcher
+func splitPatchLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func writePatchLines(out *strings.Builder, prefix string, lines []string) {
+	for _, line := range lines {
+		out.WriteString(prefix)
+		out.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n" + noNewlineMarker + "\n")
+		}
+	}
+}
+
+// formatPatchRange converts a zero-based half-open range into the unified diff "start,length" form
+func formatPatchRange(start, stop int) string {
+	beginning := start + 1
+	length := stop - start
+	if length == 1 {
+		return fmt.Sprintf("%d", beginning)
+	}
+	if length == 0 {
+		beginning--
+	}
+	return fmt.Sprintf("%d,%d", beginning, length)
+}
+
+// PrettyPatch renders the unified diff for a terminal. It keeps the -/+ markers of a
+// regular patch but makes every space and tab visible, so indentation changes that
+// would otherwise look like empty hunks can be seen.
+func (ud *UnifiedDiff) PrettyPatch() string {
+	if ud == nil || ud.FileDiff == nil {
+		return ""
+	}
+
+	var out strings.Builder
+
+	out.WriteString(color.New(color.Bold).Sprintf("--- %s\n", ud.FileDiff.OrigName))
+	out.WriteString(color.New(color.Bold).Sprintf("+++ %s\n", ud.FileDiff.NewName))
+
+	removed := color.New(color.FgRed)
+	added := color.New(color.FgGreen)
+	context := color.New(color.Faint)
+
+	for _, hunk := range ud.FileDiff.Hunks {
+		out.WriteString(color.New(color.FgCyan).Sprintf("@@ -%d,%d +%d,%d @@%s\n",
+			hunk.OrigStartLine, hunk.OrigLines,
+			hunk.NewStartLine, hunk.NewLines,
+			hunk.Section))
+
+		for _, line := range strings.Split(strings.TrimSuffix(string(hunk.Body), "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			switch line[0] {
+			case '-':
+				out.WriteString(removed.Sprint("-") + applyWhitespaceColor(line[1:], removed))
+			case '+':
+				out.WriteString(added.Sprint("+") + applyWhitespaceColor(line[1:], added))
+			case '\\':
+				out.WriteString(context.Sprint(line))
+			default:
+				out.WriteString(context.Sprint(" ") + applyWhitespaceColor(line[1:], context))
+			}
+			out.WriteString("\n")
+		}
+	}
+
+	return out.String()
+}
@@ -0,0 +1,106 @@
+package diff_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/diff"
+)
+
+func TestConvertToPatchString(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		expected string
+	}{
+		{
+			name:     "equal_content_has_no_patch",
+			before:   "a\nb\n",
+			after:    "a\nb\n",
+			expected: "",
+		},
+		{
+			name:   "indentation_change",
+			before: "block {\n  a = 1\n}\n",
+			after:  "block {\n\ta = 1\n}\n",
+			expected: "--- a/main.hcl\n" +
+				"+++ b/main.hcl\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" block {\n" +
+				"-  a = 1\n" +
+				"+\ta = 1\n" +
+				" }\n",
+		},
+		{
+			name:   "missing_trailing_newline",
+			before: "a\nb",
+			after:  "a\nb\n",
+			expected: "--- a/main.hcl\n" +
+				"+++ b/main.hcl\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				" a\n" +
+				"-b\n" +
+				"\\ No newline at end of file\n" +
+				"+b\n",
+		},
+		{
+			name:   "only_nearby_context_is_kept",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			after:  "1\n2\n3\n4\n5\n6\n7\n8\nnine\n",
+			expected: "--- a/main.hcl\n" +
+				"+++ b/main.hcl\n" +
+				"@@ -6,4 +6,4 @@\n" +
+				" 6\n" +
+				" 7\n" +
+				" 8\n" +
+				"-9\n" +
+				"+nine\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diff.ConvertToPatchString("main.hcl", tt.before, tt.after)
+			assert.Equal(t, tt.expected, got, "patch should match")
+		})
+	}
+}
+
+func TestPrettyPatchShowsWhitespace(t *testing.T) {
+	patch := diff.ConvertToPatchString("main.hcl", "a {\n  b = 1\n}\n", "a {\n\tb = 1\n}\n")
+
+	ud, err := diff.ParseUnifiedDiff(patch)
+	require.NoError(t, err, "generated patch should parse")
+
+	pretty := ud.PrettyPatch()
+	assert.True(t, strings.Contains(pretty, "→"), "tabs should be visible in the pretty patch")
+	assert.True(t, strings.Contains(pretty, "∙"), "spaces should be visible in the pretty patch")
+	assert.Contains(t, pretty, "a/main.hcl", "original file name should be shown")
+}
+
+func TestPatchPathIsRelative(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err, "getting the working directory should succeed")
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{name: "relative", filename: "./dir/main.hcl", want: "--- a/dir/main.hcl\n+++ b/dir/main.hcl\n"},
+		{name: "absolute_in_working_directory", filename: filepath.ToSlash(filepath.Join(wd, "dir", "main.hcl")), want: "--- a/dir/main.hcl\n+++ b/dir/main.hcl\n"},
+		{name: "absolute_outside_working_directory", filename: "/elsewhere/main.hcl", want: "--- a/elsewhere/main.hcl\n+++ b/elsewhere/main.hcl\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diff.ConvertToPatchString(tt.filename, "a\n", "b\n")
+			assert.True(t, strings.HasPrefix(got, tt.want), "the header should use a path git apply understands, got %q", got)
+		})
+	}
+}
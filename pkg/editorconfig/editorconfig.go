@@ -2,11 +2,15 @@ package editorconfig
 
 import (
 	"context"
+	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/editorconfig/editorconfig-core-go/v2"
+	"github.com/rs/zerolog"
 	"github.com/walteh/retab/v2/pkg/format"
 	"gitlab.com/tozd/go/errors"
 )
@@ -18,6 +22,11 @@ type EditorConfigConfiguration struct {
 
 type EditorConfigConfigurationProvider struct {
 	definitions *editorconfig.Editorconfig
+
+	// hierarchy is set when .editorconfig files are resolved from disk, the library's loader is not
+	// safe for concurrent use so loads are serialized
+	hierarchy   *editorconfig.Config
+	hierarchyMu sync.Mutex
 }
 
 // ConfigOptions represents options for editorconfig resolution
@@ -49,7 +58,56 @@ func NewDynamicConfigurationProvider(ctx context.Context, rawContent string) (*E
 		return &EditorConfigConfigurationProvider{definitions: x}, nil
 	}
 
-	return &EditorConfigConfigurationProvider{}, nil
+	return NewHierarchicalConfigurationProvider(ctx), nil
+}
+
+// NewHierarchicalConfigurationProvider resolves the .editorconfig files from each target file's
+// directory upwards, stopping at the first one with root = true. Every directory is read at most
+// once (including ones without an .editorconfig), so a provider should be shared by a whole run.
+func NewHierarchicalConfigurationProvider(ctx context.Context) *EditorConfigConfigurationProvider {
+	return &EditorConfigConfigurationProvider{
+		hierarchy: &editorconfig.Config{
+			Name:   editorconfig.ConfigNameDefault,
+			Parser: newDirCachedParser(),
+		},
+	}
+}
+
+// dirCachedParser adds caching of missing files to the library's cached parser, which only
+// caches the files it found. Most directories of a run have no .editorconfig.
+type dirCachedParser struct {
+	*editorconfig.CachedParser
+	missing map[string]error
+}
+
+var _ editorconfig.Parser = (*dirCachedParser)(nil)
+
+func newDirCachedParser() *dirCachedParser {
+	return &dirCachedParser{
+		CachedParser: editorconfig.NewCachedParser(),
+		missing:      map[string]error{},
+	}
+}
+
+func (me *dirCachedParser) ParseIni(filename string) (*editorconfig.Editorconfig, error) {
+	ec, warning, err := me.ParseIniGraceful(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ec, warning
+}
+
+func (me *dirCachedParser) ParseIniGraceful(filename string) (*editorconfig.Editorconfig, error, error) {
+	if err, ok := me.missing[filename]; ok {
+		return nil, nil, err
+	}
+
+	ec, warning, err := me.CachedParser.ParseIniGraceful(filename)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		me.missing[filename] = err
+	}
+
+	return ec, warning, err
 }
 
 func (me *EditorConfigConfigurationProvider) GetConfigurationForFileType(ctx context.Context, targetFile string) (format.Configuration, error) {
@@ -62,8 +120,7 @@ func (me *EditorConfigConfigurationProvider) GetConfigurationForFileType(ctx con
 			return nil, errors.Errorf("getting editorconfig definition: %w", err)
 		}
 	} else {
-		// Otherwise, let the library handle auto-resolution
-		def, err = editorconfig.GetDefinitionForFilenameWithConfigname(targetFile, ".editorconfig")
+		def, err = me.loadHierarchy(ctx, targetFile)
 		if err != nil {
 			return nil, errors.Errorf("getting editorconfig definition: %w", err)
 		}
@@ -73,6 +130,14 @@ func (me *EditorConfigConfigurationProvider) GetConfigurationForFileType(ctx con
 		def.IndentSize = "4"
 	}
 
+	// indent_size = tab means the indent is tab_width wide
+	if def.IndentSize == "tab" {
+		def.IndentSize = "4"
+		if def.TabWidth > 0 {
+			def.IndentSize = strconv.Itoa(def.TabWidth)
+		}
+	}
+
 	id, err := strconv.Atoi(def.IndentSize)
 	if err != nil {
 		return nil, errors.Errorf("parsing indent size: %w", err)
@@ -84,6 +149,26 @@ func (me *EditorConfigConfigurationProvider) GetConfigurationForFileType(ctx con
 	}, nil
 }
 
+func (me *EditorConfigConfigurationProvider) loadHierarchy(ctx context.Context, targetFile string) (*editorconfig.Definition, error) {
+	if me.hierarchy == nil {
+		// a zero provider resolves without caching
+		return editorconfig.GetDefinitionForFilenameWithConfigname(targetFile, editorconfig.ConfigNameDefault)
+	}
+
+	me.hierarchyMu.Lock()
+	defer me.hierarchyMu.Unlock()
+
+	def, warning, err := me.hierarchy.LoadGraceful(targetFile)
+	if err != nil {
+		return nil, err
+	}
+	if warning != nil {
+		zerolog.Ctx(ctx).Debug().Err(warning).Str("path", targetFile).Msg("editorconfig warnings")
+	}
+
+	return def, nil
+}
+
 var _ format.Configuration = &EditorConfigConfiguration{}
 
 func (x *EditorConfigConfiguration) IndentSize() int {
@@ -109,3 +194,109 @@ func (x *EditorConfigConfiguration) Raw() map[string]string {
 	}
 	return raw
 }
+
+// ContentSource is the File of keys that come from raw editorconfig content
+const ContentSource = "(editorconfig content)"
+
+// KeySource is the .editorconfig file and section a setting came from
+type KeySource struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	File    string `json:"file"`
+	Section string `json:"section"`
+}
+
+// Sources explains GetConfigurationForFileType: for every key that applies to targetFile it returns
+// the file and section that set it, following the same precedence (nearest file first, and the last
+// matching section within a file).
+func (me *EditorConfigConfigurationProvider) Sources(ctx context.Context, targetFile string) ([]*KeySource, error) {
+	found := map[string]*KeySource{}
+
+	if me.definitions != nil {
+		if err := collectSources(me.definitions, ContentSource, "/"+filepath.Base(targetFile), found); err != nil {
+			return nil, err
+		}
+		return sortedSources(found), nil
+	}
+
+	abs, err := filepath.Abs(targetFile)
+	if err != nil {
+		return nil, errors.Errorf("resolving absolute path: %w", err)
+	}
+
+	dir := abs
+	for dir != filepath.Dir(dir) {
+		dir = filepath.Dir(dir)
+
+		path := filepath.Join(dir, editorconfig.ConfigNameDefault)
+		ec, err := editorconfig.ParseFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, errors.Errorf("parsing %s: %w", path, err)
+		}
+
+		if err := collectSources(ec, path, filepath.ToSlash(abs[len(dir):]), found); err != nil {
+			return nil, err
+		}
+
+		if ec.Root {
+			break
+		}
+	}
+
+	return sortedSources(found), nil
+}
+
+func collectSources(ec *editorconfig.Editorconfig, file string, name string, found map[string]*KeySource) error {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+
+	// the last section has precedence, like in the library
+	for i := len(ec.Definitions) - 1; i >= 0; i-- {
+		def := ec.Definitions[i]
+
+		ok, err := SectionMatches(def.Selector, name)
+		if err != nil {
+			return errors.Errorf("matching section [%s] of %s: %w", def.Selector, file, err)
+		}
+		if !ok {
+			continue
+		}
+
+		for k, v := range def.Raw {
+			if _, ok := found[k]; !ok {
+				found[k] = &KeySource{Key: k, Value: v, File: file, Section: def.Selector}
+			}
+		}
+	}
+
+	return nil
+}
+
+// SectionMatches reports whether the section [selector] applies to name, a slash separated path
+// relative to the directory of the .editorconfig file
+func SectionMatches(selector string, name string) (bool, error) {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	if !strings.HasPrefix(selector, "/") {
+		if strings.ContainsRune(selector, '/') {
+			selector = "/" + selector
+		} else {
+			selector = "/**/" + selector
+		}
+	}
+	return editorconfig.FnmatchCase(selector, name)
+}
+
+func sortedSources(found map[string]*KeySource) []*KeySource {
+	sources := make([]*KeySource, 0, len(found))
+	for _, src := range found {
+		sources = append(sources, src)
+	}
+	slices.SortFunc(sources, func(a, b *KeySource) int { return strings.Compare(a.Key, b.Key) })
+	return sources
+}
@@ -0,0 +1,196 @@
+package editorconfig_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/editorconfig"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755), "creating dir should succeed")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644), "writing %s should succeed", name)
+	}
+	return dir
+}
+
+func TestHierarchicalConfigurationProvider(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		target     string
+		useTabs    bool
+		indentSize int
+	}{
+		{
+			name: "nearest_file_wins",
+			files: map[string]string{
+				"repo/.editorconfig":     "root = true\n[*]\nindent_style = space\nindent_size = 2\n",
+				"repo/sub/.editorconfig": "[*.hcl]\nindent_size = 8\n",
+			},
+			target:     "repo/sub/a.hcl",
+			useTabs:    false,
+			indentSize: 8,
+		},
+		{
+			name: "parent_applies_when_child_does_not_match",
+			files: map[string]string{
+				"repo/.editorconfig":     "root = true\n[*]\nindent_style = space\nindent_size = 2\n",
+				"repo/sub/.editorconfig": "[*.hcl]\nindent_size = 8\n",
+			},
+			target:     "repo/sub/a.proto",
+			useTabs:    false,
+			indentSize: 2,
+		},
+		{
+			name: "stops_at_root",
+			files: map[string]string{
+				".editorconfig":      "[*]\nindent_style = space\nindent_size = 3\n",
+				"repo/.editorconfig": "root = true\n[*.go]\nindent_style = tab\n",
+			},
+			target:     "repo/a.hcl",
+			useTabs:    true,
+			indentSize: 4,
+		},
+		{
+			name: "relative_section_globs",
+			files: map[string]string{
+				"repo/.editorconfig": "root = true\n[sub/**.hcl]\nindent_style = space\nindent_size = 5\n",
+			},
+			target:     "repo/sub/deep/a.hcl",
+			useTabs:    false,
+			indentSize: 5,
+		},
+		{
+			name: "indent_size_tab_uses_tab_width",
+			files: map[string]string{
+				"repo/.editorconfig": "root = true\n[*]\nindent_style = tab\nindent_size = tab\ntab_width = 2\n",
+			},
+			target:     "repo/a.hcl",
+			useTabs:    true,
+			indentSize: 2,
+		},
+		{
+			name: "no_editorconfig",
+			files: map[string]string{
+				"repo/.editorconfig": "root = true\n",
+			},
+			target:     "repo/a.hcl",
+			useTabs:    true,
+			indentSize: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			provider := editorconfig.NewHierarchicalConfigurationProvider(context.Background())
+
+			cfg, err := provider.GetConfigurationForFileType(context.Background(), filepath.Join(dir, tt.target))
+			require.NoError(t, err, "resolving configuration should succeed")
+
+			assert.Equal(t, tt.useTabs, cfg.UseTabs(), "unexpected indent style")
+			assert.Equal(t, tt.indentSize, cfg.IndentSize(), "unexpected indent size")
+		})
+	}
+}
+
+func TestHierarchicalConfigurationProviderCachesDirectories(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"repo/.editorconfig": "root = true\n[*]\nindent_style = space\nindent_size = 2\n",
+	})
+	ctx := context.Background()
+	target := filepath.Join(dir, "repo", "a.hcl")
+
+	provider := editorconfig.NewHierarchicalConfigurationProvider(ctx)
+
+	_, err := provider.GetConfigurationForFileType(ctx, target)
+	require.NoError(t, err, "resolving configuration should succeed")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "repo", ".editorconfig"), []byte("root = true\n[*]\nindent_size = 7\n"), 0o644), "rewriting should succeed")
+
+	cfg, err := provider.GetConfigurationForFileType(ctx, target)
+	require.NoError(t, err, "resolving configuration should succeed")
+	assert.Equal(t, 2, cfg.IndentSize(), "a provider should read each directory once")
+
+	cfg, err = editorconfig.NewHierarchicalConfigurationProvider(ctx).GetConfigurationForFileType(ctx, target)
+	require.NoError(t, err, "resolving configuration should succeed")
+	assert.Equal(t, 7, cfg.IndentSize(), "a new provider should see the change")
+}
+
+func TestHierarchicalConfigurationProviderConcurrent(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"repo/.editorconfig":   "root = true\n[*]\nindent_style = space\nindent_size = 2\n",
+		"repo/a/.editorconfig": "[*]\nindent_size = 6\n",
+	})
+	ctx := context.Background()
+	provider := editorconfig.NewHierarchicalConfigurationProvider(ctx)
+
+	wg := sync.WaitGroup{}
+	for i := range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sub, want := "b", 2
+			if i%2 == 0 {
+				sub, want = "a", 6
+			}
+
+			cfg, err := provider.GetConfigurationForFileType(ctx, filepath.Join(dir, "repo", sub, fmt.Sprintf("%d.hcl", i)))
+			if assert.NoError(t, err, "resolving configuration should succeed") {
+				assert.Equal(t, want, cfg.IndentSize(), "unexpected indent size for %s", sub)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSources(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"repo/.editorconfig":     "root = true\n[*]\nindent_style = space\nindent_size = 2\n[*.sh]\nshell_dialect = bash\nindent_size = 3\n",
+		"repo/sub/.editorconfig": "[*.sh]\nindent_size = 8\n",
+	})
+	ctx := context.Background()
+	target := filepath.Join(dir, "repo", "sub", "a.sh")
+
+	provider := editorconfig.NewHierarchicalConfigurationProvider(ctx)
+
+	sources, err := provider.Sources(ctx, target)
+	require.NoError(t, err, "tracing sources should succeed")
+
+	root := filepath.Join(dir, "repo", ".editorconfig")
+	sub := filepath.Join(dir, "repo", "sub", ".editorconfig")
+
+	assert.Equal(t, []*editorconfig.KeySource{
+		{Key: "indent_size", Value: "8", File: sub, Section: "*.sh"},
+		{Key: "indent_style", Value: "space", File: root, Section: "*"},
+		{Key: "shell_dialect", Value: "bash", File: root, Section: "*.sh"},
+	}, sources, "every key should point at the file and section that won")
+
+	cfg, err := provider.GetConfigurationForFileType(ctx, target)
+	require.NoError(t, err, "resolving configuration should succeed")
+	for _, src := range sources {
+		assert.Equal(t, cfg.Raw()[src.Key], src.Value, "the traced value of %s should match the resolved one", src.Key)
+	}
+
+	raw, err := editorconfig.NewRawConfigurationProvider(ctx, "[*]\nindent_size = 2\n[*.sh]\nindent_size = 5\n")
+	require.NoError(t, err, "parsing content should succeed")
+
+	sources, err = raw.Sources(ctx, target)
+	require.NoError(t, err, "tracing sources should succeed")
+	assert.Equal(t, []*editorconfig.KeySource{
+		{Key: "indent_size", Value: "5", File: editorconfig.ContentSource, Section: "*.sh"},
+	}, sources, "raw content should be reported as the source")
+}
@@ -2,11 +2,12 @@ package filesystem
 
 import (
 	"context"
-	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/hashicorp/go-multierror"
 	"github.com/rs/zerolog"
 	"github.com/spf13/afero"
@@ -68,41 +69,141 @@ func GetFileOrGlobDir(ctx context.Context, fs afero.Fs, fle afero.File, glob str
 	return fles, nil
 }
 
-func ForAllFilesAtSameTime(ctx context.Context, fls afero.Fs, files []string, cb func(ctx context.Context, fle afero.File) (io.Reader, error)) error {
+// ForEachFile runs cb for every file using at most workers goroutines at once.
+// All errors are collected and returned together once every file has been processed.
+func ForEachFile(ctx context.Context, files []string, workers int, cb func(ctx context.Context, filename string) error) error {
+	if workers < 1 {
+		workers = 1
+	}
 
 	grp := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	sem := make(chan struct{}, workers)
 
 	var formatErrors *multierror.Error
 	for _, filename := range files {
 		grp.Add(1)
+		sem <- struct{}{}
 		go func(filename string) {
 			defer grp.Done()
+			defer func() { <-sem }()
 
-			fle, err := fls.Open(filename)
-			if err != nil {
-				formatErrors = multierror.Append(formatErrors, errors.Errorf("failed to open file '%s': %w", filename, err))
-				return
+			if err := cb(ctx, filename); err != nil {
+				mu.Lock()
+				formatErrors = multierror.Append(formatErrors, err)
+				mu.Unlock()
 			}
+		}(filename)
+	}
+
+	grp.Wait()
+
+	return formatErrors.ErrorOrNil()
+}
+
+// ExpandPaths resolves paths into a sorted, de-duplicated list of files.
+// Directories are walked recursively and their files are kept when they match one of
+// the include globs (or when no include globs are given). Files passed explicitly are
+// always kept unless they match an exclude glob. Globs are matched against both the
+// path relative to the walked directory and the base name. Files and directories the
+// ignorer ignores are skipped while walking, a nil ignorer ignores nothing.
+func ExpandPaths(ctx context.Context, fs afero.Fs, paths []string, include []string, exclude []string, ignorer *Ignorer) ([]string, error) {
+	seen := map[string]bool{}
+	files := []string{}
+
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, root := range paths {
+		root = filepath.Clean(root)
+
+		isDir, err := afero.IsDir(fs, root)
+		if err != nil {
+			return nil, errors.Errorf("checking path '%s': %w", root, err)
+		}
 
-			defer fle.Close()
+		if !isDir {
+			if matchesAny(exclude, root, filepath.Base(root)) {
+				zerolog.Ctx(ctx).Debug().Str("path", root).Msg("excluded")
+				continue
+			}
+			add(root)
+			continue
+		}
 
-			r, err := cb(ctx, fle)
+		err = afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
-				formatErrors = multierror.Append(formatErrors, errors.Errorf("failed to format file '%s': %w", filename, err))
-				return
+				return err
 			}
 
-			err = afero.WriteReader(fls, filename, r)
+			rel, err := filepath.Rel(root, path)
 			if err != nil {
-				formatErrors = multierror.Append(formatErrors, errors.Errorf("failed to write formatted file '%s': %w", filename, err))
-				return
+				return errors.Errorf("resolving relative path: %w", err)
+			}
+			rel = filepath.ToSlash(rel)
+
+			if info.IsDir() {
+				if path != root && (skippedDirs[info.Name()] || matchesAny(exclude, rel, info.Name())) {
+					zerolog.Ctx(ctx).Debug().Str("path", path).Msg("excluded directory")
+					return filepath.SkipDir
+				}
+				if reason, ok := ignorer.Ignored(path, true); ok && path != root {
+					zerolog.Ctx(ctx).Debug().Str("path", path).Str("reason", reason).Msg("ignored directory")
+					return filepath.SkipDir
+				}
+				return nil
 			}
 
-			zerolog.Ctx(ctx).Info().Str("path", filename).Msg("formatted")
-		}(filename)
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			if matchesAny(exclude, rel, info.Name()) {
+				zerolog.Ctx(ctx).Debug().Str("path", path).Msg("excluded")
+				return nil
+			}
+
+			if len(include) > 0 && !matchesAny(include, rel, info.Name()) {
+				return nil
+			}
+
+			if reason, ok := ignorer.Ignored(path, false); ok {
+				zerolog.Ctx(ctx).Debug().Str("path", path).Str("reason", reason).Msg("ignored")
+				return nil
+			}
+
+			add(path)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Errorf("walking directory '%s': %w", root, err)
+		}
 	}
 
-	grp.Wait()
+	sort.Strings(files)
 
-	return formatErrors.ErrorOrNil()
+	return files, nil
+}
+
+// directories that never contain files worth formatting
+var skippedDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".svn": true,
+}
+
+func matchesAny(globs []string, rel string, base string) bool {
+	for _, glob := range globs {
+		if ok, _ := doublestar.Match(glob, rel); ok {
+			return true
+		}
+		if ok, _ := doublestar.Match(glob, base); ok {
+			return true
+		}
+	}
+	return false
 }
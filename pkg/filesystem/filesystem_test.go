@@ -0,0 +1,124 @@
+package filesystem_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/filesystem"
+	"gitlab.com/tozd/go/errors"
+)
+
+func newTestFs(t *testing.T, files ...string) afero.Fs {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+	for _, file := range files {
+		require.NoError(t, afero.WriteFile(fs, file, []byte("x"), 0644), "writing test file %s", file)
+	}
+	return fs
+}
+
+func TestExpandPaths(t *testing.T) {
+	fs := newTestFs(t,
+		"repo/main.go",
+		"repo/pkg/a.proto",
+		"repo/pkg/b.hcl",
+		"repo/gen/mock.gen.go",
+		"repo/.git/config",
+		"other.yaml",
+	)
+
+	tests := []struct {
+		name     string
+		paths    []string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{
+			name:  "walks_directories_recursively",
+			paths: []string{"repo"},
+			expected: []string{
+				"repo/gen/mock.gen.go",
+				"repo/main.go",
+				"repo/pkg/a.proto",
+				"repo/pkg/b.hcl",
+			},
+		},
+		{
+			name:     "include_filters_walked_files",
+			paths:    []string{"repo"},
+			include:  []string{"*.go"},
+			expected: []string{"repo/gen/mock.gen.go", "repo/main.go"},
+		},
+		{
+			name:     "exclude_skips_directories",
+			paths:    []string{"repo"},
+			exclude:  []string{"gen", "*.hcl"},
+			expected: []string{"repo/main.go", "repo/pkg/a.proto"},
+		},
+		{
+			name:     "exclude_matches_relative_paths",
+			paths:    []string{"repo"},
+			exclude:  []string{"pkg/**"},
+			expected: []string{"repo/gen/mock.gen.go", "repo/main.go"},
+		},
+		{
+			name:     "explicit_files_ignore_include",
+			paths:    []string{"other.yaml", "repo/pkg"},
+			include:  []string{"*.proto"},
+			expected: []string{"other.yaml", "repo/pkg/a.proto"},
+		},
+		{
+			name:     "duplicates_are_removed",
+			paths:    []string{"repo/main.go", "./repo/main.go"},
+			expected: []string{"repo/main.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := filesystem.ExpandPaths(context.Background(), fs, tt.paths, tt.include, tt.exclude, nil)
+			require.NoError(t, err, "expanding paths should succeed")
+			assert.Equal(t, tt.expected, files, "expanded files should match")
+		})
+	}
+}
+
+func TestExpandPathsMissing(t *testing.T) {
+	fs := newTestFs(t)
+
+	_, err := filesystem.ExpandPaths(context.Background(), fs, []string{"nope"}, nil, nil, nil)
+	require.Error(t, err, "missing paths should fail")
+}
+
+func TestForEachFile(t *testing.T) {
+	files := []string{"a", "b", "c", "d", "e", "f"}
+
+	var running, peak, calls atomic.Int32
+	err := filesystem.ForEachFile(context.Background(), files, 2, func(ctx context.Context, filename string) error {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		calls.Add(1)
+		if filename == "c" || filename == "e" {
+			return errors.Errorf("bad file %s", filename)
+		}
+		return nil
+	})
+
+	require.Error(t, err, "errors from the callback should be returned")
+	assert.Contains(t, err.Error(), "bad file c", "error for c should be reported")
+	assert.Contains(t, err.Error(), "bad file e", "error for e should be reported")
+	assert.Equal(t, int32(len(files)), calls.Load(), "every file should be visited")
+	assert.LessOrEqual(t, peak.Load(), int32(2), "no more than two workers should run at once")
+}
@@ -0,0 +1,254 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	ignore "github.com/sabhiram/go-gitignore"
+	"github.com/spf13/afero"
+)
+
+// IgnoreFileName is the file that lists, with gitignore syntax, the paths retab leaves alone
+const IgnoreFileName = ".retabignore"
+
+// builtinIgnores are vendored directories retab never formats
+var builtinIgnores = []string{"node_modules/", ".terraform/", "vendor/"}
+
+// Ignorer decides which paths retab leaves alone. Like git, it reads the ignore files of every
+// directory from the repository root down to the path, and their patterns are relative to the
+// directory they are in. Besides .retabignore it reads the linguist-generated and
+// linguist-vendored attributes of .gitattributes, and optionally .gitignore.
+type Ignorer struct {
+	fs        afero.Fs
+	gitignore bool
+	builtin   *ignoreFile
+
+	mu   sync.Mutex
+	dirs map[string]*dirIgnores
+}
+
+// dirIgnores are the ignore files and the .gitattributes of a directory
+type dirIgnores struct {
+	files      []*ignoreFile
+	attributes []*attributeRule
+}
+
+type ignoreFile struct {
+	path    string
+	matcher *ignore.GitIgnore
+	// lines are what the reason quotes for each pattern
+	lines []string
+}
+
+func NewIgnorer(fs afero.Fs, gitignore bool) *Ignorer {
+	return &Ignorer{
+		fs:        fs,
+		gitignore: gitignore,
+		builtin:   &ignoreFile{path: "built-in", matcher: ignore.CompileIgnoreLines(builtinIgnores...), lines: builtinIgnores},
+		dirs:      map[string]*dirIgnores{},
+	}
+}
+
+// Ignored reports whether path is ignored, and which file and pattern ignore it
+func (me *Ignorer) Ignored(path string, isDir bool) (string, bool) {
+	if me == nil {
+		return "", false
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+
+	suffix := ""
+	if isDir {
+		// patterns ending in a slash only match directories
+		suffix = "/"
+	}
+
+	dirs := me.parents(abs)
+	for i, dir := range dirs {
+		rel, err := filepath.Rel(dir, abs)
+		if err != nil {
+			continue
+		}
+		files := me.load(dir).files
+		if i == 0 {
+			// built-in patterns are relative to the repository root, so a checkout inside a vendor
+			// directory is still formatted
+			files = append([]*ignoreFile{me.builtin}, files...)
+		}
+		for _, file := range files {
+			if reason, ok := file.match(filepath.ToSlash(rel) + suffix); ok {
+				return reason, true
+			}
+		}
+	}
+
+	if isDir {
+		// like in git, attributes apply to files and not to the directories they are in
+		return "", false
+	}
+	return me.generated(dirs, abs)
+}
+
+// generated reports whether the linguist-generated or linguist-vendored attribute is set for path.
+// Like git, the .gitattributes files are read from the repository root down and the last line that
+// matches path decides each attribute, so a later -linguist-generated takes a file back.
+func (me *Ignorer) generated(dirs []string, path string) (string, bool) {
+	state := map[string]*attributeRule{}
+	set := map[string]bool{}
+
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			continue
+		}
+		for _, rule := range me.load(dir).attributes {
+			if !rule.matcher.MatchesPath(filepath.ToSlash(rel)) {
+				continue
+			}
+			for attr, value := range rule.values {
+				state[attr], set[attr] = rule, value
+			}
+		}
+	}
+
+	for _, attr := range linguistAttributes {
+		if set[attr] {
+			return fmt.Sprintf("%s: %s", state[attr].path, state[attr].lines[attr]), true
+		}
+	}
+	return "", false
+}
+
+func (me *ignoreFile) match(rel string) (string, bool) {
+	ok, pattern := me.matcher.MatchesPathHow(rel)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s: %s", me.path, me.lines[pattern.LineNo-1]), true
+}
+
+// parents returns the directories of path from the repository root, the nearest one with a .git,
+// down to the directory path is in
+func (me *Ignorer) parents(path string) []string {
+	dirs := []string{}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if ok, _ := afero.Exists(me.fs, filepath.Join(dir, ".git")); ok {
+			break
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	return dirs
+}
+
+// load reads the ignore files of dir once
+func (me *Ignorer) load(dir string) *dirIgnores {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if ignores, ok := me.dirs[dir]; ok {
+		return ignores
+	}
+
+	files := []*ignoreFile{}
+
+	names := []string{IgnoreFileName}
+	if me.gitignore {
+		names = append(names, ".gitignore")
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		content, err := afero.ReadFile(me.fs, path)
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		files = append(files, &ignoreFile{path: path, matcher: ignore.CompileIgnoreLines(lines...), lines: lines})
+	}
+
+	ignores := &dirIgnores{files: files}
+
+	path := filepath.Join(dir, ".gitattributes")
+	if content, err := afero.ReadFile(me.fs, path); err == nil {
+		ignores.attributes = parseGitattributes(path, content)
+	}
+
+	me.dirs[dir] = ignores
+	return ignores
+}
+
+// linguistAttributes are the attributes that make retab leave a file alone
+var linguistAttributes = []string{"linguist-generated", "linguist-vendored"}
+
+// attributeRule is a line of .gitattributes that sets or unsets a linguist attribute
+type attributeRule struct {
+	path    string
+	matcher *ignore.GitIgnore
+	// values are the linguist attributes of the line, true when set and false when unset
+	values map[string]bool
+	// lines are what the reason quotes for each attribute
+	lines map[string]string
+}
+
+// parseGitattributes keeps the lines of .gitattributes that set, unset or unspecify
+// linguist-generated or linguist-vendored, in order
+func parseGitattributes(path string, content []byte) []*attributeRule {
+	rules := []*attributeRule{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// negative patterns are not allowed in .gitattributes
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+
+		rule := &attributeRule{path: path, values: map[string]bool{}, lines: map[string]string{}}
+		for _, field := range fields[1:] {
+			attr, value, ok := attributeValue(field)
+			if !ok || !slices.Contains(linguistAttributes, attr) {
+				continue
+			}
+			// an unspecified attribute (!attr) is the same as an unset one for retab
+			rule.values[attr] = value
+			rule.lines[attr] = fields[0] + " " + field
+		}
+		if len(rule.values) > 0 {
+			rule.matcher = ignore.CompileIgnoreLines(fields[0])
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// attributeValue reads an attribute of a .gitattributes line: attr and attr=true set it, -attr,
+// !attr and attr=false do not
+func attributeValue(field string) (string, bool, bool) {
+	switch {
+	case strings.HasPrefix(field, "-"), strings.HasPrefix(field, "!"):
+		return field[1:], false, true
+	}
+
+	attr, value, hasValue := strings.Cut(field, "=")
+	if !hasValue {
+		return attr, true, true
+	}
+	switch value {
+	case "true":
+		return attr, true, true
+	case "false":
+		return attr, false, true
+	}
+	return attr, false, false
+}
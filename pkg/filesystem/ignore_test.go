@@ -0,0 +1,75 @@
+package filesystem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/filesystem"
+)
+
+func TestIgnorer(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for name, content := range map[string]string{
+		"/repo/.git/HEAD":              "ref: refs/heads/main\n",
+		"/repo/.retabignore":           "gen/\n*.snap.hcl\n!keep.snap.hcl\n",
+		"/repo/.gitignore":             "build/\n",
+		"/repo/sub/.retabignore":       "/local.hcl\n",
+		"/repo/sub/.gitattributes":     "# comment\n*.pb.go linguist-generated=true\n*.md text\nout/** linguist-generated\nout/keep.hcl -linguist-generated\nlib/** linguist-vendored\nlib/own.hcl linguist-vendored=false\n",
+		"/repo/sub/lib/.gitattributes": "mine.hcl !linguist-vendored\n",
+	} {
+		require.NoError(t, afero.WriteFile(fs, name, []byte(content), 0644), "writing %s should succeed", name)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		isDir     bool
+		gitignore bool
+		reason    string
+	}{
+		{name: "not_ignored", path: "/repo/main.hcl"},
+		{name: "directory_pattern", path: "/repo/gen", isDir: true, reason: "/repo/.retabignore: gen/"},
+		{name: "file_in_ignored_directory", path: "/repo/gen/mocks/a.go", reason: "/repo/.retabignore: gen/"},
+		{name: "nested_match", path: "/repo/sub/gen/a.go", reason: "/repo/.retabignore: gen/"},
+		{name: "glob", path: "/repo/sub/a.snap.hcl", reason: "/repo/.retabignore: *.snap.hcl"},
+		{name: "negated", path: "/repo/keep.snap.hcl"},
+		{name: "anchored_to_its_directory", path: "/repo/sub/local.hcl", reason: "/repo/sub/.retabignore: /local.hcl"},
+		{name: "anchored_elsewhere", path: "/repo/local.hcl"},
+		{name: "gitattributes_generated", path: "/repo/sub/x/a.pb.go", reason: "/repo/sub/.gitattributes: *.pb.go linguist-generated=true"},
+		{name: "gitattributes_other_attributes", path: "/repo/sub/README.md"},
+		{name: "gitattributes_pattern", path: "/repo/sub/out/a.hcl", reason: "/repo/sub/.gitattributes: out/** linguist-generated"},
+		{name: "gitattributes_later_unset_wins", path: "/repo/sub/out/keep.hcl"},
+		{name: "gitattributes_later_false_wins", path: "/repo/sub/lib/own.hcl"},
+		{name: "gitattributes_nested_file_wins", path: "/repo/sub/lib/mine.hcl"},
+		{name: "gitattributes_vendored", path: "/repo/sub/lib/other.hcl", reason: "/repo/sub/.gitattributes: lib/** linguist-vendored"},
+		{name: "gitattributes_not_for_directories", path: "/repo/sub/out", isDir: true},
+		{name: "builtin", path: "/repo/web/node_modules/x/a.json", reason: "built-in: node_modules/"},
+		{name: "gitignore_off", path: "/repo/build/a.hcl"},
+		{name: "gitignore_on", path: "/repo/build/a.hcl", gitignore: true, reason: "/repo/.gitignore: build/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := filesystem.NewIgnorer(fs, tt.gitignore).Ignored(tt.path, tt.isDir)
+			assert.Equal(t, tt.reason != "", ok, "ignored should match")
+			assert.Equal(t, tt.reason, reason, "reason should match")
+		})
+	}
+}
+
+func TestExpandPathsIgnored(t *testing.T) {
+	fs := newTestFs(t,
+		"/repo/.git/HEAD",
+		"/repo/main.hcl",
+		"/repo/gen/a.hcl",
+		"/repo/node_modules/b.hcl",
+	)
+	require.NoError(t, afero.WriteFile(fs, "/repo/.retabignore", []byte("gen/\n"), 0644), "writing .retabignore should succeed")
+
+	files, err := filesystem.ExpandPaths(context.Background(), fs, []string{"/repo"}, []string{"*.hcl"}, nil, filesystem.NewIgnorer(fs, false))
+	require.NoError(t, err, "expanding paths should succeed")
+	assert.Equal(t, []string{"/repo/main.hcl"}, files, "ignored directories should be skipped")
+}
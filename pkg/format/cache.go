@@ -0,0 +1,73 @@
+package format
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Cache stores formatted output by a key that covers everything that can change it, see CacheKey
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Put(ctx context.Context, key string, formatted []byte) error
+}
+
+// CacheKeyer is implemented by providers whose type alone does not identify their output, like
+// external formatters that differ only in the command they run
+type CacheKeyer interface {
+	CacheKey(ctx context.Context) string
+}
+
+type cacheContextKey struct{}
+
+type contextCache struct {
+	cache   Cache
+	version string
+}
+
+// ContextWithCache makes Format consult the cache. The version is part of every key, so results
+// from another retab build are never reused.
+func ContextWithCache(ctx context.Context, cache Cache, version string) context.Context {
+	return context.WithValue(ctx, cacheContextKey{}, &contextCache{cache: cache, version: version})
+}
+
+func cacheFromContext(ctx context.Context) (*contextCache, bool) {
+	c, ok := ctx.Value(cacheContextKey{}).(*contextCache)
+	return c, ok
+}
+
+// ProviderIdentity names a provider for cache keys
+func ProviderIdentity(ctx context.Context, provider Provider) string {
+	if lazy, ok := provider.(*LazyFormatProvider); ok {
+		provider = lazy.Provider()
+	}
+	if keyer, ok := provider.(CacheKeyer); ok {
+		return keyer.CacheKey(ctx)
+	}
+	return reflect.TypeOf(provider).String()
+}
+
+// CacheKey hashes the retab version, the provider identity, the resolved configuration and the input
+func CacheKey(ctx context.Context, version string, provider Provider, cfg Configuration, input []byte) string {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "version=%q\nprovider=%q\n", version, ProviderIdentity(ctx, provider))
+
+	raw := cfg.Raw()
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "cfg.%s=%q\n", k, raw[k])
+	}
+
+	fmt.Fprintf(h, "input=%d\n", len(input))
+	h.Write(input)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// LineRange is the lines Start to End of a file, counted from 1 and both included
+type LineRange struct {
+	Start int
+	End   int
+}
+
+func (me LineRange) overlaps(start int, end int) bool {
+	return me.Start <= end && me.End >= start
+}
+
+// ClipToLines keeps the changes from before to after that touch one of the ranges of before and
+// undoes the others, so only the given lines of a formatted file change
+func ClipToLines(before []byte, after []byte, ranges []LineRange) []byte {
+	return ApplyEdits(before, ClipEdits(before, after, ranges))
+}
+
+// ClipEdits returns the changes from before to after that touch one of the ranges of before, as
+// edits of whole lines of before
+func ClipEdits(before []byte, after []byte, ranges []LineRange) []Edit {
+	a := splitLines(before)
+	b := splitLines(after)
+	offsets := lineOffsets(a)
+
+	touched := func(op difflib.OpCode) bool {
+		// lines I1+1 to I2 are replaced or deleted, an insertion sits between lines I1 and I1+1
+		start, end := op.I1+1, op.I2
+		if op.I1 == op.I2 {
+			start, end = op.I1, op.I1+1
+		}
+		for _, r := range ranges {
+			if r.overlaps(start, end) {
+				return true
+			}
+		}
+		return false
+	}
+
+	edits := []Edit{}
+	matcher := difflib.NewMatcherWithJunk(a, b, false, nil)
+	for _, op := range matcher.GetOpCodes() {
+		if op.Tag == 'e' || !touched(op) {
+			continue
+		}
+		edits = append(edits, Edit{
+			Start: offsets[op.I1],
+			End:   offsets[op.I2],
+			Text:  []byte(strings.Join(b[op.J1:op.J2], "")),
+		})
+	}
+
+	return edits
+}
+
+// splitLines splits s into lines that keep their newline
+func splitLines(s []byte) []string {
+	lines := strings.SplitAfter(string(s), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOffsets returns the byte offset each line starts at, and the length of the file last
+func lineOffsets(lines []string) []int {
+	offsets := make([]int, len(lines)+1)
+	for i, line := range lines {
+		offsets[i+1] = offsets[i] + len(line)
+	}
+	return offsets
+}
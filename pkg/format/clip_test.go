@@ -0,0 +1,47 @@
+package format_test
+
+import (
+	"testing"
+
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+func TestClipToLines(t *testing.T) {
+	before := "a {\n  b = 1\n}\n\nc {\n  d = 1\n}\n"
+	after := "a {\n\tb = 1\n}\n\nc {\n\td = 1\n}\n"
+
+	tests := []struct {
+		name   string
+		ranges []format.LineRange
+		want   string
+	}{
+		{
+			name:   "no_ranges",
+			ranges: nil,
+			want:   before,
+		},
+		{
+			name:   "first_block",
+			ranges: []format.LineRange{{Start: 1, End: 3}},
+			want:   "a {\n\tb = 1\n}\n\nc {\n  d = 1\n}\n",
+		},
+		{
+			name:   "second_block",
+			ranges: []format.LineRange{{Start: 6, End: 6}},
+			want:   "a {\n  b = 1\n}\n\nc {\n\td = 1\n}\n",
+		},
+		{
+			name:   "everything",
+			ranges: []format.LineRange{{Start: 1, End: 100}},
+			want:   after,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := format.ClipToLines([]byte(before), []byte(after), tt.ranges)
+			diff.Require(t).Want(tt.want).Got(string(got)).Equals()
+		})
+	}
+}
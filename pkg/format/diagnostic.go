@@ -0,0 +1,144 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem a provider found at a position of its input, most often a syntax error.
+// Lines and columns start at 1 and columns count bytes.
+type Diagnostic struct {
+	// File is empty when the provider was not told which file it formats
+	File      string   `json:"file,omitempty"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndLine   int      `json:"end_line"`
+	EndColumn int      `json:"end_column"`
+	Severity  Severity `json:"severity"`
+	Message   string   `json:"message"`
+	Provider  string   `json:"provider"`
+}
+
+// NewDiagnostic returns an error about the bytes start to end of src
+func NewDiagnostic(provider string, src []byte, start int, end int, message string) Diagnostic {
+	start = min(max(start, 0), len(src))
+	end = min(max(end, start), len(src))
+
+	line, column := position(src, start)
+	endLine, endColumn := position(src, end)
+
+	return Diagnostic{
+		Line:      line,
+		Column:    column,
+		EndLine:   endLine,
+		EndColumn: endColumn,
+		Severity:  SeverityError,
+		Message:   message,
+		Provider:  provider,
+	}
+}
+
+func position(src []byte, offset int) (int, int) {
+	line := bytes.Count(src[:offset], []byte("\n")) + 1
+	return line, offset - (bytes.LastIndexByte(src[:offset], '\n') + 1) + 1
+}
+
+func (me Diagnostic) String() string {
+	return me.location() + ": " + me.Message
+}
+
+func (me Diagnostic) location() string {
+	file := me.File
+	if file == "" {
+		file = "<input>"
+	}
+	return fmt.Sprintf("%s:%d:%d", file, me.Line, me.Column)
+}
+
+// Frame renders the diagnostic with the line of src it points at and carets under the part of
+// the line it is about
+//
+//	error: Missing newline after argument (hcl)
+//	 --> main.tf:1:7
+//	  |
+//	1 | a = 1 b = 2
+//	  |       ^
+func (me Diagnostic) Frame(src []byte) string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "%s: %s (%s)\n", me.Severity, me.Message, me.Provider)
+
+	lines := strings.Split(string(src), "\n")
+	number := strconv.Itoa(me.Line)
+	gutter := strings.Repeat(" ", len(number))
+	fmt.Fprintf(&out, "%s--> %s\n", gutter, me.location())
+	if me.Line < 1 || me.Line > len(lines) {
+		return out.String()
+	}
+
+	text := strings.TrimRight(lines[me.Line-1], "\r")
+	column := min(max(me.Column, 1), len(text)+1)
+	width := 1
+	if me.EndLine == me.Line && me.EndColumn > column {
+		width = min(me.EndColumn, len(text)+1) - column
+	}
+
+	// the text before the caret keeps its tabs so the caret lines up with the source
+	pad := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, text[:column-1])
+
+	fmt.Fprintf(&out, "%s |\n", gutter)
+	fmt.Fprintf(&out, "%s | %s\n", number, text)
+	fmt.Fprintf(&out, "%s | %s%s\n", gutter, pad, strings.Repeat("^", max(width, 1)))
+
+	return out.String()
+}
+
+// Diagnostics is the error of a provider that found problems in its input. Library callers get
+// the diagnostics back with errors.As.
+type Diagnostics []Diagnostic
+
+func (me Diagnostics) Error() string {
+	messages := make([]string, len(me))
+	for i, diag := range me {
+		messages[i] = diag.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// InFile returns a copy of the diagnostics with File set where it is empty
+func (me Diagnostics) InFile(file string) Diagnostics {
+	out := make(Diagnostics, len(me))
+	for i, diag := range me {
+		if diag.File == "" {
+			diag.File = file
+		}
+		out[i] = diag
+	}
+	return out
+}
+
+// withFile replaces an error with diagnostics by the diagnostics in file, they say what failed and
+// now also where
+func withFile(err error, file string) error {
+	var diags Diagnostics
+	if errors.As(err, &diags) {
+		return diags.InFile(file)
+	}
+	return err
+}
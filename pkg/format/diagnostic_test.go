@@ -0,0 +1,87 @@
+package format_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+func TestNewDiagnostic(t *testing.T) {
+	src := []byte("one\n\ttwo three\n")
+
+	diag := format.NewDiagnostic("test", src, 9, 14, "bad three")
+	assert.Equal(t, format.Diagnostic{
+		Line:      2,
+		Column:    6,
+		EndLine:   2,
+		EndColumn: 11,
+		Severity:  format.SeverityError,
+		Message:   "bad three",
+		Provider:  "test",
+	}, diag, "offsets should become one based lines and byte columns")
+
+	diag = format.NewDiagnostic("test", src, 100, 200, "at the end")
+	assert.Equal(t, 3, diag.Line, "offsets past the end should be clamped")
+	assert.Equal(t, 1, diag.Column, "offsets past the end should be clamped")
+}
+
+func TestDiagnosticFrame(t *testing.T) {
+	src := []byte("one\n\ttwo three\n")
+
+	tests := []struct {
+		name string
+		diag format.Diagnostic
+		want string
+	}{
+		{
+			name: "range_keeps_tabs",
+			diag: func() format.Diagnostic {
+				diag := format.NewDiagnostic("test", src, 9, 14, "bad three")
+				diag.File = "a.txt"
+				return diag
+			}(),
+			want: "error: bad three (test)\n --> a.txt:2:6\n  |\n2 | \ttwo three\n  | \t    ^^^^^\n",
+		},
+		{
+			name: "position",
+			diag: format.NewDiagnostic("test", src, 1, 1, "bad n"),
+			want: "error: bad n (test)\n --> <input>:1:2\n  |\n1 | one\n  |  ^\n",
+		},
+		{
+			name: "line_outside_the_source",
+			diag: format.Diagnostic{Line: 9, Column: 1, Severity: format.SeverityWarning, Message: "gone", Provider: "test"},
+			want: "warning: gone (test)\n --> <input>:9:1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff.Require(t).Want(tt.want).Got(tt.diag.Frame(src)).Equals()
+		})
+	}
+}
+
+// brokenProvider fails with a diagnostic on the first line
+type brokenProvider struct{}
+
+func (brokenProvider) Format(ctx context.Context, cfg format.Configuration, reader io.Reader) (io.Reader, error) {
+	return nil, errors.Errorf("failed to parse: %w", format.Diagnostics{{Line: 1, Column: 1, Severity: format.SeverityError, Message: "broken", Provider: "broken"}})
+}
+
+func TestFormatDiagnostics(t *testing.T) {
+	_, err := format.FormatSimple(context.Background(), &brokenProvider{}, "a.txt", true, 4, strings.NewReader("x"))
+	require.Error(t, err, "formatting should fail")
+
+	var diags format.Diagnostics
+	require.True(t, errors.As(err, &diags), "library callers should get the diagnostics back")
+	require.Len(t, diags, 1, "the diagnostic of the provider should be returned")
+	assert.Equal(t, "a.txt", diags[0].File, "the diagnostics should name the formatted file")
+	assert.Contains(t, err.Error(), "a.txt:1:1: broken", "the error should say where formatting failed")
+}
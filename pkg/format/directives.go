@@ -0,0 +1,246 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+const (
+	directiveOff        = "off"
+	directiveOn         = "on"
+	directiveIgnoreNext = "ignore-next"
+)
+
+// Directives are the `retab:off`, `retab:on` and `retab:ignore-next` comments of a language. The
+// lines between retab:off and retab:on, or to the end of the file without a retab:on, and the line
+// after retab:ignore-next are left the way they are written.
+type Directives struct {
+	prefix   string
+	pattern  *regexp.Regexp
+	reindent bool
+}
+
+// NewDirectives returns the directives written in comments that start with one of the prefixes,
+// the first one is used for the comments retab adds while formatting
+func NewDirectives(prefixes ...string) *Directives {
+	quoted := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		quoted[i] = regexp.QuoteMeta(prefix)
+	}
+	return &Directives{
+		prefix:  prefixes[0],
+		pattern: regexp.MustCompile(`^\s*(?:` + strings.Join(quoted, "|") + `)\s*retab:(off|on|ignore-next)(?:\s.*)?$`),
+	}
+}
+
+// WithReindent returns directives whose regions move to the indentation their directive gets when
+// formatting. Only languages where indentation is syntax want it, elsewhere it would change the
+// content of heredocs and multi-line strings.
+func (me *Directives) WithReindent() *Directives {
+	return &Directives{prefix: me.prefix, pattern: me.pattern, reindent: true}
+}
+
+var (
+	// HashDirectives are written in # comments
+	HashDirectives = NewDirectives("#")
+	// SlashDirectives are written in // comments
+	SlashDirectives = NewDirectives("//")
+)
+
+// suppressed is a region of lines, start included and end not, that formatting leaves alone
+type suppressed struct {
+	kind  string
+	start int
+	end   int
+	// closed is set when a retab:on ends the region, inserted by retab for retab:ignore-next
+	closed bool
+}
+
+func (me *Directives) kind(line string) string {
+	m := me.pattern.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// Format formats read with next and puts the regions the directives turn off back afterwards
+func (me *Directives) Format(ctx context.Context, cfg Configuration, read io.Reader, next func(context.Context, Configuration, io.Reader) (io.Reader, error)) (io.Reader, error) {
+	input, err := io.ReadAll(read)
+	if err != nil {
+		return nil, errors.Errorf("failed to read input: %w", err)
+	}
+
+	lines := splitLines(input)
+	regions := me.regions(lines)
+	if len(regions) == 0 {
+		return next(ctx, cfg, bytes.NewReader(input))
+	}
+
+	r, err := next(ctx, cfg, bytes.NewReader(me.prepare(lines, regions)))
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("failed to read formatted output: %w", err)
+	}
+
+	restored, err := me.restore(lines, regions, splitLines(formatted))
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(restored), nil
+}
+
+// regions finds the regions the directives in lines turn off
+func (me *Directives) regions(lines []string) []suppressed {
+	regions := []suppressed{}
+	for i := 0; i < len(lines); i++ {
+		switch me.kind(lines[i]) {
+		case directiveOff:
+			region := suppressed{kind: directiveOff, start: i + 1, end: len(lines)}
+			for j := i + 1; j < len(lines); j++ {
+				if me.kind(lines[j]) == directiveOn {
+					region.end, region.closed = j, true
+					break
+				}
+			}
+			regions = append(regions, region)
+			i = region.end
+		case directiveIgnoreNext:
+			end := i + 1
+			for end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+				end++
+			}
+			if end == len(lines) {
+				continue
+			}
+			// a line continued with a backslash is ignored with the lines it continues on
+			end++
+			for end < len(lines) && strings.HasSuffix(strings.TrimRight(lines[end-1], "\r\n"), `\`) {
+				end++
+			}
+			regions = append(regions, suppressed{kind: directiveIgnoreNext, start: i + 1, end: end, closed: true})
+			i = end - 1
+		}
+	}
+	return regions
+}
+
+// prepare ends the regions of retab:ignore-next with a retab:on, so they can be found in the
+// formatted output the same way as the others. The retab:on gets the indentation of the line after
+// it: when the ignored line opens a yaml block scalar, a comment indented less would end it.
+func (me *Directives) prepare(lines []string, regions []suppressed) []byte {
+	var out bytes.Buffer
+	last := 0
+	for _, region := range regions {
+		if region.kind != directiveIgnoreNext {
+			continue
+		}
+		for _, line := range lines[last:region.end] {
+			out.WriteString(line)
+		}
+		if !strings.HasSuffix(lines[region.end-1], "\n") {
+			out.WriteString("\n")
+		}
+		out.WriteString(nextIndentation(lines[region.end:]) + me.prefix + " retab:" + directiveOn + "\n")
+		last = region.end
+	}
+	for _, line := range lines[last:] {
+		out.WriteString(line)
+	}
+	return out.Bytes()
+}
+
+// restore replaces the lines between the directives of formatted with the regions of the input
+func (me *Directives) restore(input []string, regions []suppressed, formatted []string) ([]byte, error) {
+	find := func(kind string, from int) int {
+		for i := from; i < len(formatted); i++ {
+			if me.kind(formatted[i]) == kind {
+				return i
+			}
+		}
+		return -1
+	}
+
+	var out bytes.Buffer
+	cursor := 0
+	for _, region := range regions {
+		start := find(region.kind, cursor)
+		if start < 0 {
+			return nil, errors.Errorf("formatting moved the retab:%s directive of line %d", region.kind, region.start)
+		}
+		end := len(formatted)
+		if region.closed {
+			if end = find(directiveOn, start+1); end < 0 {
+				return nil, errors.Errorf("formatting moved the retab:%s directive of line %d", directiveOn, region.end+1)
+			}
+		}
+
+		for _, line := range formatted[cursor : start+1] {
+			out.WriteString(line)
+		}
+		kept := input[region.start:region.end]
+		if me.reindent {
+			kept = reindent(kept, indentation(input[region.start-1]), indentation(formatted[start]))
+		}
+		for _, line := range kept {
+			out.WriteString(line)
+		}
+
+		cursor = end
+		if region.kind == directiveIgnoreNext {
+			// the retab:on was only added to find the end of the region
+			cursor++
+		}
+	}
+	for _, line := range formatted[cursor:] {
+		out.WriteString(line)
+	}
+
+	return out.Bytes(), nil
+}
+
+// nextIndentation returns the indentation of the first line of lines that is not blank
+func nextIndentation(lines []string) string {
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			return indentation(line)
+		}
+	}
+	return ""
+}
+
+func indentation(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// reindent moves lines from the indentation from to to, so they still sit inside the same block.
+// The lines are left alone when one that is not blank does not start with from.
+func reindent(lines []string, from string, to string) []string {
+	if from == to {
+		return lines
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, from) {
+			return lines
+		}
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			out[i] = line
+			continue
+		}
+		out[i] = to + strings.TrimPrefix(line, from)
+	}
+	return out
+}
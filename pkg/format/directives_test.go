@@ -0,0 +1,121 @@
+package format_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+var spaces = regexp.MustCompile(`[ \t]+`)
+
+// squeeze indents every line inside braces with a tab and squeezes the other spaces
+func squeeze(ctx context.Context, cfg format.Configuration, reader io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	depth := 0
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		line = spaces.ReplaceAll(bytes.TrimSpace(line), []byte(" "))
+		if bytes.HasPrefix(line, []byte("}")) {
+			depth--
+		}
+		if len(line) > 0 {
+			out.Write(bytes.Repeat([]byte("\t"), depth))
+			out.Write(line)
+			out.WriteString("\n")
+		}
+		if bytes.HasSuffix(line, []byte("{")) {
+			depth++
+		}
+	}
+	return &out, nil
+}
+
+func TestDirectives(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives *format.Directives
+		src        string
+		want       string
+	}{
+		{
+			name:       "no_directives",
+			directives: format.HashDirectives,
+			src:        "a {\n  b   c\n}\n",
+			want:       "a {\n\tb c\n}\n",
+		},
+		{
+			name:       "off_and_on",
+			directives: format.HashDirectives,
+			src:        "a {\n  # retab:off\n  b   c\n    d   e\n  # retab:on\n  f   g\n}\n",
+			want:       "a {\n\t# retab:off\n  b   c\n    d   e\n\t# retab:on\n\tf g\n}\n",
+		},
+		{
+			name:       "off_to_the_end",
+			directives: format.SlashDirectives,
+			src:        "a   b\n//retab:off because it is aligned\nc   d\ne   f",
+			want:       "a b\n//retab:off because it is aligned\nc   d\ne   f",
+		},
+		{
+			name:       "ignore_next",
+			directives: format.HashDirectives,
+			src:        "a {\n# retab:ignore-next\n  b   c\n  d   e\n}\n",
+			want:       "a {\n\t# retab:ignore-next\n  b   c\n\td e\n}\n",
+		},
+		{
+			name:       "ignore_next_with_continued_lines",
+			directives: format.HashDirectives,
+			src:        "# retab:ignore-next\nRUN   a \\\n   b\nRUN   c\n",
+			want:       "# retab:ignore-next\nRUN   a \\\n   b\nRUN c\n",
+		},
+		{
+			name:       "other_comments_are_formatted",
+			directives: format.HashDirectives,
+			src:        "# not   retab:off\na   b\n",
+			want:       "# not retab:off\na b\n",
+		},
+		{
+			name:       "reindent",
+			directives: format.HashDirectives.WithReindent(),
+			src:        "a {\n  # retab:off\n  b   c\n    d   e\n  # retab:on\n}\n",
+			want:       "a {\n\t# retab:off\n\tb   c\n\t  d   e\n\t# retab:on\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+
+			r, err := tt.directives.Format(context.Background(), cfg, bytes.NewReader([]byte(tt.src)), squeeze)
+			require.NoError(t, err, "formatting should succeed")
+
+			got, err := io.ReadAll(r)
+			require.NoError(t, err, "reading the output should succeed")
+
+			diff.Require(t).Want(tt.want).Got(string(got)).Equals()
+		})
+	}
+}
+
+func TestDirectivesMoved(t *testing.T) {
+	dropComments := func(ctx context.Context, cfg format.Configuration, reader io.Reader) (io.Reader, error) {
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(regexp.MustCompile(`(?m)^#.*\n`).ReplaceAll(content, nil)), nil
+	}
+
+	_, err := format.HashDirectives.Format(context.Background(), formatmock.NewMockConfiguration(t), bytes.NewReader([]byte("# retab:off\na\n")), dropComments)
+	require.ErrorContains(t, err, "formatting moved the retab:off directive of line 1", "a directive the formatter drops should fail")
+}
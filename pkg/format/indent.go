@@ -69,3 +69,76 @@ func BruteForceIndentation(ctx context.Context, startIndentation string, cfg Con
 
 	return &output, nil
 }
+
+// IndentStats counts how the lines of existing files are indented, to tell which style a project
+// already uses
+type IndentStats struct {
+	TabLines   int
+	SpaceLines int
+	// Steps counts by how many spaces the indentation grows from one line to the next
+	Steps map[int]int
+}
+
+// MeasureIndentation counts the indented lines of content. Only steps of 2 to 8 spaces are
+// counted, single spaces are usually alignment like the stars of block comments.
+func MeasureIndentation(content []byte) *IndentStats {
+	stats := &IndentStats{Steps: map[int]int{}}
+
+	previous := 0
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		if line[0] == '\t' {
+			stats.TabLines++
+			previous = -1
+			continue
+		}
+
+		spaces := len(line) - len(bytes.TrimLeft(line, " "))
+		if spaces > 0 {
+			stats.SpaceLines++
+		}
+		if step := spaces - previous; previous >= 0 && step >= 2 && step <= 8 {
+			stats.Steps[step]++
+		}
+		previous = spaces
+	}
+
+	return stats
+}
+
+// Add counts the lines of other too
+func (me *IndentStats) Add(other *IndentStats) {
+	me.TabLines += other.TabLines
+	me.SpaceLines += other.SpaceLines
+	if me.Steps == nil {
+		me.Steps = map[int]int{}
+	}
+	for step, count := range other.Steps {
+		me.Steps[step] += count
+	}
+}
+
+// Style returns the style most lines use, with the most common step as the size of space
+// indentation and 4 for tabs. ok is false when no line is indented.
+func (me *IndentStats) Style() (useTabs bool, size int, ok bool) {
+	if me.TabLines == 0 && me.SpaceLines == 0 {
+		return false, 0, false
+	}
+
+	if me.TabLines >= me.SpaceLines {
+		return true, 4, true
+	}
+
+	size, best := 4, 0
+	for step := 2; step <= 8; step++ {
+		// ties go to the smaller step, a file indented by 2 also has steps of 4 when it skips levels
+		if me.Steps[step] > best {
+			size, best = step, me.Steps[step]
+		}
+	}
+
+	return false, size, true
+}
@@ -0,0 +1,35 @@
+package format_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+func TestMeasureIndentation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		useTabs bool
+		size    int
+		ok      bool
+	}{
+		{name: "tabs", content: "a {\n\tb {\n\t\tc\n\t}\n}\n", useTabs: true, size: 4, ok: true},
+		{name: "two_spaces", content: "a:\n  b:\n    c: 1\n  d: 2\n", useTabs: false, size: 2, ok: true},
+		{name: "four_spaces_skipping_levels", content: "a\n    b\n        c\nd\n            e\n", useTabs: false, size: 4, ok: true},
+		{name: "block_comment_stars_ignored", content: "/*\n * a\n * b\n */\nx {\n   y\n}\n", useTabs: false, size: 3, ok: true},
+		{name: "flat", content: "a\nb\n\nc\n", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTabs, size, ok := format.MeasureIndentation([]byte(tt.content)).Style()
+			assert.Equal(t, tt.ok, ok, "ok should match")
+			assert.Equal(t, tt.useTabs, useTabs, "useTabs should match")
+			if tt.ok {
+				assert.Equal(t, tt.size, size, "size should match")
+			}
+		})
+	}
+}
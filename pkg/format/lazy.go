@@ -13,11 +13,16 @@ type LazyFormatProvider struct {
 }
 
 func (p *LazyFormatProvider) Format(ctx context.Context, cfg Configuration, reader io.Reader) (io.Reader, error) {
+	return p.Provider().Format(ctx, cfg, reader)
+}
+
+// Provider creates the wrapped provider if needed and returns it
+func (p *LazyFormatProvider) Provider() Provider {
 	p.providerOnce.Do(func() {
 		p.provider = p.providerFunc()
 	})
 
-	return p.provider.Format(ctx, cfg, reader)
+	return p.provider
 }
 
 func NewLazyFormatProvider(providerFunc func() Provider) *LazyFormatProvider {
@@ -0,0 +1,184 @@
+package format
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+type OptionType string
+
+const (
+	OptionTypeBool   OptionType = "bool"
+	OptionTypeInt    OptionType = "int"
+	OptionTypeString OptionType = "string"
+	// OptionTypeEnum is a string that must be one of the option's Values
+	OptionTypeEnum OptionType = "enum"
+	// OptionTypeList is a comma separated list of strings, limited to Values when there are any
+	OptionTypeList OptionType = "list"
+)
+
+// Option is an editorconfig key a provider reads from Raw
+type Option struct {
+	Key  string
+	Type OptionType
+	// Default is the value used when the key is not set, written like it is in .editorconfig
+	Default string
+	// Values are the allowed values of an enum or a list, or the words an int accepts besides
+	// numbers, which read as 0
+	Values []string
+	Doc    string
+}
+
+// OptionSet is the options of one provider
+type OptionSet struct {
+	Provider string
+	Options  []*Option
+}
+
+var optionSets = []*OptionSet{}
+
+// RegisterOptions declares the options a provider reads. Providers call it from a package level
+// variable, the registry is what validates .editorconfig sections and what `retab options` lists.
+func RegisterOptions(provider string, options ...*Option) *OptionSet {
+	set := &OptionSet{Provider: provider, Options: options}
+	optionSets = append(optionSets, set)
+	return set
+}
+
+// RegisteredOptions returns every registered option set, sorted by provider
+func RegisteredOptions() []*OptionSet {
+	sets := slices.Clone(optionSets)
+	slices.SortStableFunc(sets, func(a, b *OptionSet) int { return strings.Compare(a.Provider, b.Provider) })
+	return sets
+}
+
+// EditorconfigOptions are the standard editorconfig keys and the ones retab reads for every file
+var EditorconfigOptions = RegisterOptions("editorconfig",
+	&Option{Key: "root", Type: OptionTypeBool, Default: "false", Doc: "stop looking for .editorconfig files in parent directories"},
+	&Option{Key: "indent_style", Type: OptionTypeEnum, Default: "tab", Values: []string{"tab", "space"}, Doc: "indent with tabs or spaces"},
+	&Option{Key: "indent_size", Type: OptionTypeInt, Default: "4", Values: []string{"tab"}, Doc: "the width of one indentation level, tab means tab_width"},
+	&Option{Key: "tab_width", Type: OptionTypeInt, Doc: "the width of a tab, used when indent_size = tab"},
+	&Option{Key: "end_of_line", Type: OptionTypeEnum, Values: []string{"lf", "cr", "crlf"}, Doc: "the line ending, not changed by retab"},
+	&Option{Key: "charset", Type: OptionTypeEnum, Values: []string{"latin1", "utf-8", "utf-8-bom", "utf-16be", "utf-16le"}, Doc: "the file encoding, not changed by retab"},
+	&Option{Key: "trim_trailing_whitespace", Type: OptionTypeBool, Doc: "remove whitespace at the end of lines"},
+	&Option{Key: "insert_final_newline", Type: OptionTypeBool, Doc: "end files with a newline"},
+	&Option{Key: "trim_multiple_empty_lines", Type: OptionTypeBool, Default: "false", Doc: "keep at most one empty line in a row"},
+	&Option{Key: "one_bracket_per_line", Type: OptionTypeBool, Default: "false", Doc: "put every bracket on its own line"},
+)
+
+// Lookup finds the option for key
+func (me *OptionSet) Lookup(key string) (*Option, bool) {
+	for _, opt := range me.Options {
+		if opt.Key == key {
+			return opt, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns the keys of the options, in declaration order
+func (me *OptionSet) Keys() []string {
+	keys := make([]string, 0, len(me.Options))
+	for _, opt := range me.Options {
+		keys = append(keys, opt.Key)
+	}
+	return keys
+}
+
+// Validate reports whether value can be read as the option's type
+func (me *Option) Validate(value string) error {
+	value = strings.TrimSpace(value)
+
+	switch me.Type {
+	case OptionTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.Errorf("invalid %s %q, expected true or false", me.Key, value)
+		}
+	case OptionTypeInt:
+		if slices.Contains(me.Values, value) {
+			return nil
+		}
+		if _, err := strconv.Atoi(value); err != nil {
+			return errors.Errorf("invalid %s %q, expected a number%s", me.Key, value, orWords(me.Values))
+		}
+	case OptionTypeEnum:
+		if !slices.Contains(me.Values, value) {
+			return errors.Errorf("invalid %s %q, expected one of %s", me.Key, value, strings.Join(me.Values, ", "))
+		}
+	case OptionTypeList:
+		if len(me.Values) == 0 {
+			return nil
+		}
+		for _, item := range SplitList(value) {
+			if !slices.Contains(me.Values, item) {
+				return errors.Errorf("invalid %s %q, expected a comma separated list of %s", me.Key, item, strings.Join(me.Values, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+func orWords(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	return " or " + strings.Join(words, ", ")
+}
+
+// value returns the configured value, or the default when the key is not set or its value is
+// invalid. Invalid values do not fail formatting, CheckOptions warns about them.
+func (me *Option) value(cfg Configuration) (string, bool) {
+	if v, ok := cfg.Raw()[me.Key]; ok {
+		if v = strings.TrimSpace(v); me.Validate(v) == nil {
+			return v, true
+		}
+	}
+	return me.Default, me.Default != ""
+}
+
+// IsSet reports whether the configuration sets the option, defaults do not count
+func (me *Option) IsSet(cfg Configuration) bool {
+	_, ok := cfg.Raw()[me.Key]
+	return ok
+}
+
+// Bool reads a bool option, false when it is not set and has no default
+func (me *Option) Bool(cfg Configuration) bool {
+	v, _ := me.value(cfg)
+	b, _ := strconv.ParseBool(v)
+	return b
+}
+
+// Int reads an int option, the words in Values and an unset option without default read as 0
+func (me *Option) Int(cfg Configuration) int {
+	v, _ := me.value(cfg)
+	n, _ := strconv.Atoi(v)
+	return n
+}
+
+// String reads a string or enum option, empty when it is not set and has no default
+func (me *Option) String(cfg Configuration) string {
+	v, _ := me.value(cfg)
+	return v
+}
+
+// List reads a comma separated list option, empty items are dropped
+func (me *Option) List(cfg Configuration) []string {
+	v, _ := me.value(cfg)
+	return SplitList(v)
+}
+
+// SplitList splits a comma separated editorconfig value, trimming the items and dropping empty ones
+func SplitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
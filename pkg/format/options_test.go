@@ -0,0 +1,102 @@
+package format_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+func TestOptionValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  *format.Option
+		value   string
+		wantErr bool
+	}{
+		{name: "bool", option: &format.Option{Key: "k", Type: format.OptionTypeBool}, value: "true"},
+		{name: "bool_invalid", option: &format.Option{Key: "k", Type: format.OptionTypeBool}, value: "yes", wantErr: true},
+		{name: "int", option: &format.Option{Key: "k", Type: format.OptionTypeInt}, value: " 12 "},
+		{name: "int_word", option: &format.Option{Key: "k", Type: format.OptionTypeInt, Values: []string{"off"}}, value: "off"},
+		{name: "int_invalid", option: &format.Option{Key: "k", Type: format.OptionTypeInt, Values: []string{"off"}}, value: "none", wantErr: true},
+		{name: "enum", option: &format.Option{Key: "k", Type: format.OptionTypeEnum, Values: []string{"a", "b"}}, value: "b"},
+		{name: "enum_invalid", option: &format.Option{Key: "k", Type: format.OptionTypeEnum, Values: []string{"a", "b"}}, value: "c", wantErr: true},
+		{name: "list", option: &format.Option{Key: "k", Type: format.OptionTypeList, Values: []string{"a", "b"}}, value: "a, b,"},
+		{name: "list_invalid", option: &format.Option{Key: "k", Type: format.OptionTypeList, Values: []string{"a", "b"}}, value: "a, c", wantErr: true},
+		{name: "list_free", option: &format.Option{Key: "k", Type: format.OptionTypeList}, value: "anything, at all"},
+		{name: "string", option: &format.Option{Key: "k", Type: format.OptionTypeString}, value: "anything"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.option.Validate(tt.value)
+			if tt.wantErr {
+				require.Error(t, err, "validating %q should fail", tt.value)
+				return
+			}
+			require.NoError(t, err, "validating %q should succeed", tt.value)
+		})
+	}
+}
+
+func TestOptionAccessors(t *testing.T) {
+	cfg := formatmock.NewMockConfiguration(t)
+	cfg.EXPECT().Raw().Return(map[string]string{
+		"sort":   "true",
+		"width":  "off",
+		"pad":    "3",
+		"items":  "a, b",
+		"broken": "maybe",
+	}).Maybe()
+
+	sort := &format.Option{Key: "sort", Type: format.OptionTypeBool}
+	assert.True(t, sort.Bool(cfg), "sort should be true")
+	assert.True(t, sort.IsSet(cfg), "sort should be set")
+
+	width := &format.Option{Key: "width", Type: format.OptionTypeInt, Default: "80", Values: []string{"off"}}
+	assert.Equal(t, 0, width.Int(cfg), "off should read as 0")
+
+	pad := &format.Option{Key: "pad", Type: format.OptionTypeInt, Default: "1"}
+	assert.Equal(t, 3, pad.Int(cfg), "pad should be read from the configuration")
+
+	unset := &format.Option{Key: "unset", Type: format.OptionTypeInt, Default: "7"}
+	assert.Equal(t, 7, unset.Int(cfg), "unset should fall back to its default")
+	assert.False(t, unset.IsSet(cfg), "a default should not count as set")
+
+	items := &format.Option{Key: "items", Type: format.OptionTypeList}
+	assert.Equal(t, []string{"a", "b"}, items.List(cfg), "items should be split and trimmed")
+
+	broken := &format.Option{Key: "broken", Type: format.OptionTypeBool, Default: "true"}
+	assert.True(t, broken.Bool(cfg), "an invalid bool should fall back to its default")
+
+	brokenInt := &format.Option{Key: "broken", Type: format.OptionTypeInt, Default: "2"}
+	assert.Equal(t, 2, brokenInt.Int(cfg), "an invalid int should fall back to its default")
+}
+
+func TestOptionsJSONSchema(t *testing.T) {
+	sets := []*format.OptionSet{
+		{Provider: "a", Options: []*format.Option{
+			{Key: "shared", Type: format.OptionTypeInt, Default: "80", Values: []string{"off"}, Doc: "a doc"},
+			{Key: "flag", Type: format.OptionTypeBool, Default: "false", Doc: "flag doc"},
+		}},
+		{Provider: "b", Options: []*format.Option{
+			{Key: "shared", Type: format.OptionTypeInt, Default: "off", Values: []string{"off"}, Doc: "b doc"},
+		}},
+	}
+
+	schema := format.OptionsJSONSchema(sets)
+	properties, ok := schema["properties"].(map[string]any)
+	require.True(t, ok, "schema should have properties")
+
+	shared, ok := properties["shared"].(map[string]any)
+	require.True(t, ok, "shared should be a property")
+	assert.Equal(t, "a: a doc\nb: b doc", shared["description"], "shared keys should list the docs of every provider")
+	assert.Equal(t, 80, shared["default"], "int defaults should be numbers")
+
+	flag, ok := properties["flag"].(map[string]any)
+	require.True(t, ok, "flag should be a property")
+	assert.Equal(t, "boolean", flag["type"], "bools should be booleans")
+	assert.Equal(t, false, flag["default"], "bool defaults should be booleans")
+}
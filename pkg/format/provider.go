@@ -15,6 +15,12 @@ type Provider interface {
 	Format(ctx context.Context, cfg Configuration, reader io.Reader) (io.Reader, error)
 }
 
+// ProviderLookup finds the provider for a language id, it lets providers format code embedded in
+// another language. formatters.AutoFormatProvider implements it.
+type ProviderLookup interface {
+	GetFormatterByLangID(ctx context.Context, lang string) (Provider, bool)
+}
+
 func Format(ctx context.Context, provider Provider, cfg ConfigurationProvider, filename string, fle io.Reader) (io.Reader, error) {
 	ctx = zerolog.Ctx(ctx).With().Str("path", filename).Str("provider", reflect.TypeOf(provider).Elem().String()).Logger().WithContext(ctx)
 
@@ -23,14 +29,53 @@ func Format(ctx context.Context, provider Provider, cfg ConfigurationProvider, f
 		return nil, errors.Errorf("failed to get editorconfig: %w", err)
 	}
 
+	if cache, ok := cacheFromContext(ctx); ok {
+		r, err := formatCached(ctx, cache, provider, efg, fle)
+		if err != nil {
+			return nil, withFile(err, filename)
+		}
+		return r, nil
+	}
+
 	r, err := provider.Format(ctx, efg, fle)
 	if err != nil {
-		return nil, errors.Errorf("failed to format: %w", err)
+		return nil, errors.Errorf("failed to format: %w", withFile(err, filename))
 	}
 
 	return r, nil
 }
 
+func formatCached(ctx context.Context, cache *contextCache, provider Provider, cfg Configuration, fle io.Reader) (io.Reader, error) {
+	input, err := io.ReadAll(fle)
+	if err != nil {
+		return nil, errors.Errorf("failed to read input: %w", err)
+	}
+
+	key := CacheKey(ctx, cache.version, provider, cfg, input)
+
+	if formatted, ok := cache.cache.Get(ctx, key); ok {
+		zerolog.Ctx(ctx).Debug().Str("key", key).Msg("format cache hit")
+		return bytes.NewReader(formatted), nil
+	}
+
+	r, err := provider.Format(ctx, cfg, bytes.NewReader(input))
+	if err != nil {
+		return nil, errors.Errorf("failed to format: %w", err)
+	}
+
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("failed to read formatted output: %w", err)
+	}
+
+	if err := cache.cache.Put(ctx, key, formatted); err != nil {
+		// a cache that cannot be written only costs speed
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to write format cache")
+	}
+
+	return bytes.NewReader(formatted), nil
+}
+
 func FormatSimple(ctx context.Context, provider Provider, filename string, useTabs bool, indentSize int, input io.Reader) (io.Reader, error) {
 	return Format(ctx, provider, &basicConfigurationProvider{
 		tabs:       useTabs,
@@ -0,0 +1,125 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// Edit replaces the bytes Start to End of a file with Text
+type Edit struct {
+	Start int
+	End   int
+	Text  []byte
+}
+
+// RangeProvider is a provider that can format only some lines of a file. It grows each range to
+// the syntactic units around it, so a range in the middle of a block formats the whole block, and
+// returns edits that touch nothing outside of them.
+type RangeProvider interface {
+	Provider
+	FormatRanges(ctx context.Context, cfg Configuration, input []byte, ranges []LineRange) ([]Edit, error)
+}
+
+// FormatRanges formats the ranges of input with the provider's own range formatting, or formats
+// the whole input and keeps only the changes that touch the ranges when it has none
+func FormatRanges(ctx context.Context, provider Provider, cfg Configuration, input []byte, ranges []LineRange) ([]Edit, error) {
+	if rp, ok := unwrapProvider(provider).(RangeProvider); ok {
+		edits, err := rp.FormatRanges(ctx, cfg, input, ranges)
+		if err != nil {
+			return nil, errors.Errorf("failed to format ranges: %w", err)
+		}
+		return edits, nil
+	}
+
+	r, err := provider.Format(ctx, cfg, bytes.NewReader(input))
+	if err != nil {
+		return nil, errors.Errorf("failed to format: %w", err)
+	}
+
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("failed to read formatted output: %w", err)
+	}
+
+	return ClipEdits(input, formatted, ranges), nil
+}
+
+// ApplyEdits returns input with the edits applied, the edits must not overlap
+func ApplyEdits(input []byte, edits []Edit) []byte {
+	edits = slices.Clone(edits)
+	slices.SortStableFunc(edits, func(a, b Edit) int {
+		return a.Start - b.Start
+	})
+
+	var out bytes.Buffer
+	last := 0
+	for _, edit := range edits {
+		out.Write(input[last:edit.Start])
+		out.Write(edit.Text)
+		last = edit.End
+	}
+	out.Write(input[last:])
+
+	return out.Bytes()
+}
+
+// ByteRangeLines returns the lines the bytes start to end of input are on
+func ByteRangeLines(input []byte, start int, end int) LineRange {
+	start = min(max(start, 0), len(input))
+	end = min(max(end, start), len(input))
+
+	first := bytes.Count(input[:start], []byte("\n")) + 1
+	last := first + bytes.Count(input[start:end], []byte("\n"))
+	if end > start && input[end-1] == '\n' {
+		// a range that ends with a newline ends on the line before
+		last--
+	}
+
+	return LineRange{Start: first, End: last}
+}
+
+// UnitEdits replaces the syntactic units of before that overlap a range with the same units of
+// after, the formatted before. Units are paired by their index, units that share a line are
+// replaced together, and when the two files have a different number of units it falls back to
+// ClipEdits.
+func UnitEdits(before []byte, after []byte, beforeUnits []LineRange, afterUnits []LineRange, ranges []LineRange) []Edit {
+	if len(beforeUnits) != len(afterUnits) {
+		return ClipEdits(before, after, ranges)
+	}
+
+	a := splitLines(before)
+	b := splitLines(after)
+	aOffsets := lineOffsets(a)
+	bOffsets := lineOffsets(b)
+
+	edits := []Edit{}
+	for i := 0; i < len(beforeUnits); {
+		aUnit, bUnit := beforeUnits[i], afterUnits[i]
+		for i++; i < len(beforeUnits) && (beforeUnits[i].Start <= aUnit.End || afterUnits[i].Start <= bUnit.End); i++ {
+			aUnit.End = max(aUnit.End, beforeUnits[i].End)
+			bUnit.End = max(bUnit.End, afterUnits[i].End)
+		}
+
+		if !slices.ContainsFunc(ranges, func(r LineRange) bool { return r.overlaps(aUnit.Start, aUnit.End) }) {
+			continue
+		}
+
+		aStart, aEnd := aOffsets[clampLine(aUnit.Start-1, a)], aOffsets[clampLine(aUnit.End, a)]
+		bStart, bEnd := bOffsets[clampLine(bUnit.Start-1, b)], bOffsets[clampLine(bUnit.End, b)]
+		if bytes.Equal(before[aStart:aEnd], after[bStart:bEnd]) {
+			continue
+		}
+
+		edits = append(edits, Edit{Start: aStart, End: aEnd, Text: slices.Clone(after[bStart:bEnd])})
+	}
+
+	return edits
+}
+
+func clampLine(line int, lines []string) int {
+	return min(max(line, 0), len(lines))
+}
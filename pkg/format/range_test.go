@@ -0,0 +1,92 @@
+package format_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+func TestUnitEdits(t *testing.T) {
+	before := "a {\n  b = 1\n  c = 2\n}\n\nd {\n  e = 1\n}\n"
+	after := "a {\n\tb = 1\n\tc = 2\n}\n\nd {\n\te = 1\n}\n"
+	beforeUnits := []format.LineRange{{Start: 1, End: 4}, {Start: 6, End: 8}}
+	afterUnits := []format.LineRange{{Start: 1, End: 4}, {Start: 6, End: 8}}
+
+	tests := []struct {
+		name        string
+		ranges      []format.LineRange
+		beforeUnits []format.LineRange
+		want        string
+	}{
+		{
+			name:        "line_in_unit_formats_whole_unit",
+			ranges:      []format.LineRange{{Start: 2, End: 2}},
+			beforeUnits: beforeUnits,
+			want:        "a {\n\tb = 1\n\tc = 2\n}\n\nd {\n  e = 1\n}\n",
+		},
+		{
+			name:        "range_between_units",
+			ranges:      []format.LineRange{{Start: 5, End: 5}},
+			beforeUnits: beforeUnits,
+			want:        before,
+		},
+		{
+			name:        "units_sharing_a_line_are_merged",
+			ranges:      []format.LineRange{{Start: 7, End: 7}},
+			beforeUnits: []format.LineRange{{Start: 1, End: 6}, {Start: 6, End: 8}},
+			want:        after,
+		},
+		{
+			name:        "different_unit_counts_clip",
+			ranges:      []format.LineRange{{Start: 7, End: 7}},
+			beforeUnits: beforeUnits[:1],
+			want:        "a {\n  b = 1\n  c = 2\n}\n\nd {\n\te = 1\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := format.UnitEdits([]byte(before), []byte(after), tt.beforeUnits, afterUnits, tt.ranges)
+			got := format.ApplyEdits([]byte(before), edits)
+			diff.Require(t).Want(tt.want).Got(string(got)).Equals()
+		})
+	}
+}
+
+func TestByteRangeLines(t *testing.T) {
+	src := []byte("one\ntwo\nthree\n")
+
+	assert.Equal(t, format.LineRange{Start: 1, End: 1}, format.ByteRangeLines(src, 0, 3), "a range inside the first line")
+	assert.Equal(t, format.LineRange{Start: 1, End: 1}, format.ByteRangeLines(src, 0, 4), "the newline at the end belongs to the line")
+	assert.Equal(t, format.LineRange{Start: 2, End: 3}, format.ByteRangeLines(src, 5, 10), "a range across lines")
+	assert.Equal(t, format.LineRange{Start: 3, End: 3}, format.ByteRangeLines(src, 9, 9), "an empty range is on its line")
+}
+
+// trimProvider trims the spaces at the end of lines, and has no range formatting of its own
+type trimProvider struct{}
+
+func (trimProvider) Format(ctx context.Context, cfg format.Configuration, reader io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(bytes.ReplaceAll(content, []byte(" \n"), []byte("\n"))), nil
+}
+
+func TestFormatRangesFallback(t *testing.T) {
+	cfg := formatmock.NewMockConfiguration(t)
+	provider := format.NewLazyFormatProvider(func() format.Provider { return trimProvider{} })
+
+	input := []byte("a \n{\nb \n}\nc \n")
+	edits, err := format.FormatRanges(context.Background(), provider, cfg, input, []format.LineRange{{Start: 3, End: 3}})
+	require.NoError(t, err, "formatting a range should succeed")
+
+	diff.Require(t).Want("a \n{\nb\n}\nc \n").Got(string(format.ApplyEdits(input, edits))).Equals()
+}
@@ -0,0 +1,84 @@
+package format
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OptionsJSONSchema describes the keys of an .editorconfig section as a JSON Schema object, for
+// editors and linters that check configuration files. A key read by several providers takes its
+// type from the first set and lists the docs of all of them.
+func OptionsJSONSchema(sets []*OptionSet) map[string]any {
+	properties := map[string]any{}
+	docs := map[string][]string{}
+
+	for _, set := range sets {
+		for _, opt := range set.Options {
+			docs[opt.Key] = append(docs[opt.Key], fmt.Sprintf("%s: %s", set.Provider, opt.Doc))
+			if _, ok := properties[opt.Key]; ok {
+				continue
+			}
+			properties[opt.Key] = opt.jsonSchema()
+		}
+	}
+
+	for key, property := range properties {
+		property.(map[string]any)["description"] = strings.Join(docs[key], "\n")
+	}
+
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "retab .editorconfig section",
+		"description": "the keys retab reads from a section of an .editorconfig file",
+		"type":        "object",
+		"properties":  properties,
+		// editorconfig files hold the keys of other tools too
+		"additionalProperties": true,
+	}
+}
+
+func (me *Option) jsonSchema() map[string]any {
+	schema := map[string]any{}
+
+	switch me.Type {
+	case OptionTypeBool:
+		schema["type"] = "boolean"
+	case OptionTypeInt:
+		if len(me.Values) > 0 {
+			schema["anyOf"] = []any{
+				map[string]any{"type": "integer"},
+				map[string]any{"enum": me.Values},
+			}
+		} else {
+			schema["type"] = "integer"
+		}
+	case OptionTypeEnum:
+		schema["type"] = "string"
+		schema["enum"] = me.Values
+	case OptionTypeList:
+		schema["type"] = "string"
+		if len(me.Values) > 0 {
+			quoted := make([]string, len(me.Values))
+			for i, v := range me.Values {
+				quoted[i] = regexp.QuoteMeta(v)
+			}
+			schema["pattern"] = fmt.Sprintf(`^\s*(%[1]s)(\s*,\s*(%[1]s))*\s*$`, strings.Join(quoted, "|"))
+		}
+	default:
+		schema["type"] = "string"
+	}
+
+	if me.Default != "" {
+		schema["default"] = me.Default
+		if b, err := strconv.ParseBool(me.Default); err == nil && me.Type == OptionTypeBool {
+			schema["default"] = b
+		}
+		if n, err := strconv.Atoi(me.Default); err == nil && me.Type == OptionTypeInt {
+			schema["default"] = n
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,142 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// Node is a node of a syntax tree without its position and comments, the part of a tree that
+// formatting must not change
+type Node struct {
+	Kind  string
+	Text  string
+	Depth int
+	// Line is where the node starts, only to point at it in errors
+	Line int
+}
+
+func (me Node) String() string {
+	if me.Text == "" {
+		return me.Kind
+	}
+	return fmt.Sprintf("%s %q", me.Kind, me.Text)
+}
+
+// TreeProvider is a provider that parses what it formats, so formatting can be verified to keep
+// the syntax tree of its input
+type TreeProvider interface {
+	Provider
+	Tree(ctx context.Context, cfg Configuration, src []byte) ([]Node, error)
+}
+
+// TreeBuilder collects the nodes of a depth-first walk
+type TreeBuilder struct {
+	nodes []Node
+	depth int
+}
+
+// Enter adds a node, the nodes until the matching Leave are its children
+func (me *TreeBuilder) Enter(kind string, text string, line int) {
+	me.nodes = append(me.nodes, Node{Kind: kind, Text: text, Depth: me.depth, Line: line})
+	me.depth++
+}
+
+func (me *TreeBuilder) Leave() {
+	me.depth--
+}
+
+// Leaf adds a node without children
+func (me *TreeBuilder) Leaf(kind string, text string, line int) {
+	me.Enter(kind, text, line)
+	me.Leave()
+}
+
+// Embed adds the tree of code embedded at line, like a script in a yaml string, as children of the
+// current node. Code a provider formats with another provider is compared by its tree, since
+// formatting changes its text.
+func (me *TreeBuilder) Embed(nodes []Node, line int) {
+	for _, node := range nodes {
+		node.Depth += me.depth
+		node.Line += line - 1
+		me.nodes = append(me.nodes, node)
+	}
+}
+
+func (me *TreeBuilder) Nodes() []Node {
+	return me.nodes
+}
+
+// VerifyEquivalent parses input and formatted with the provider and fails at the first node where
+// their trees differ. Providers that cannot parse what they format are not verified.
+func VerifyEquivalent(ctx context.Context, provider Provider, cfg Configuration, input []byte, formatted []byte) error {
+	tp, ok := unwrapProvider(provider).(TreeProvider)
+	if !ok {
+		return nil
+	}
+
+	before, err := tp.Tree(ctx, cfg, input)
+	if err != nil {
+		return errors.Errorf("failed to parse the input: %w", err)
+	}
+
+	after, err := tp.Tree(ctx, cfg, formatted)
+	if err != nil {
+		return errors.Errorf("the formatted output does not parse: %w", err)
+	}
+
+	for i := range max(len(before), len(after)) {
+		switch {
+		case i >= len(after):
+			return errors.Errorf("the formatted output is missing %s from line %d of the input", before[i], before[i].Line)
+		case i >= len(before):
+			return errors.Errorf("the formatted output adds %s at line %d", after[i], after[i].Line)
+		case before[i].Kind != after[i].Kind || before[i].Text != after[i].Text || before[i].Depth != after[i].Depth:
+			return errors.Errorf("%s at line %d of the input became %s at line %d of the formatted output", before[i], before[i].Line, after[i], after[i].Line)
+		}
+	}
+
+	return nil
+}
+
+// VerifyIdempotent formats formatted again and fails when that changes it
+func VerifyIdempotent(ctx context.Context, provider Provider, cfg Configuration, formatted []byte) error {
+	r, err := provider.Format(ctx, cfg, bytes.NewReader(formatted))
+	if err != nil {
+		return errors.Errorf("formatting the formatted output again: %w", err)
+	}
+
+	again, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Errorf("failed to read formatted output: %w", err)
+	}
+
+	if bytes.Equal(formatted, again) {
+		return nil
+	}
+
+	a, b := splitLines(formatted), splitLines(again)
+	line := 0
+	for line < len(a) && line < len(b) && a[line] == b[line] {
+		line++
+	}
+	at := func(lines []string) string {
+		if line >= len(lines) {
+			return "the end of the file"
+		}
+		return fmt.Sprintf("%q", strings.TrimRight(lines[line], "\n"))
+	}
+
+	return errors.Errorf("formatting is not idempotent: formatting again changes line %d from %s to %s", line+1, at(a), at(b))
+}
+
+func unwrapProvider(provider Provider) Provider {
+	if lazy, ok := provider.(*LazyFormatProvider); ok {
+		return lazy.Provider()
+	}
+	return provider
+}
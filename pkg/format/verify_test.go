@@ -0,0 +1,115 @@
+package format_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// wordsProvider has a tree of one node per line with a leaf per word, and formats with format
+type wordsProvider struct {
+	format func(content []byte) []byte
+}
+
+func (me wordsProvider) Format(ctx context.Context, cfg format.Configuration, reader io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(me.format(content)), nil
+}
+
+func (me wordsProvider) Tree(ctx context.Context, cfg format.Configuration, src []byte) ([]format.Node, error) {
+	tree := &format.TreeBuilder{}
+	for i, line := range strings.Split(string(src), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		tree.Enter("Line", "", i+1)
+		for _, word := range strings.Fields(line) {
+			tree.Leaf("Word", word, i+1)
+		}
+		tree.Leave()
+	}
+	return tree.Nodes(), nil
+}
+
+func TestVerifyEquivalent(t *testing.T) {
+	input := "a  b\nc\n"
+
+	tests := []struct {
+		name      string
+		provider  format.Provider
+		formatted string
+		wantErr   string
+	}{
+		{
+			name:      "whitespace_only",
+			provider:  wordsProvider{},
+			formatted: "a b\n\nc\n",
+		},
+		{
+			name:      "changed_node",
+			provider:  wordsProvider{},
+			formatted: "a b\nd\n",
+			wantErr:   `Word "c" at line 2 of the input became Word "d" at line 2 of the formatted output`,
+		},
+		{
+			name:      "missing_node",
+			provider:  wordsProvider{},
+			formatted: "a b\n",
+			wantErr:   "the formatted output is missing Line from line 2 of the input",
+		},
+		{
+			name:      "added_node",
+			provider:  wordsProvider{},
+			formatted: "a b\nc\nd\n",
+			wantErr:   "the formatted output adds Line at line 3",
+		},
+		{
+			name:      "moved_to_another_parent",
+			provider:  wordsProvider{},
+			formatted: "a b c\n",
+			wantErr:   `Line at line 2 of the input became Word "c" at line 1 of the formatted output`,
+		},
+		{
+			name:      "provider_without_a_tree",
+			provider:  trimProvider{},
+			formatted: "anything\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+			provider := format.NewLazyFormatProvider(func() format.Provider { return tt.provider })
+
+			err := format.VerifyEquivalent(context.Background(), provider, cfg, []byte(input), []byte(tt.formatted))
+			if tt.wantErr == "" {
+				require.NoError(t, err, "verifying should succeed")
+				return
+			}
+			require.Error(t, err, "verifying should fail")
+			assert.Contains(t, err.Error(), tt.wantErr, "the error should point at the first differing node")
+		})
+	}
+}
+
+func TestVerifyIdempotent(t *testing.T) {
+	cfg := formatmock.NewMockConfiguration(t)
+
+	stable := wordsProvider{format: func(content []byte) []byte { return content }}
+	require.NoError(t, format.VerifyIdempotent(context.Background(), stable, cfg, []byte("a\nb\n")), "an unchanged output is idempotent")
+
+	growing := wordsProvider{format: func(content []byte) []byte { return bytes.ReplaceAll(content, []byte("b"), []byte("bb")) }}
+	err := format.VerifyIdempotent(context.Background(), growing, cfg, []byte("a\nb\n"))
+	require.Error(t, err, "an output that changes again is not idempotent")
+	assert.Contains(t, err.Error(), `formatting again changes line 2 from "b" to "bb"`, "the error should point at the first changed line")
+}
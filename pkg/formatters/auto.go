@@ -11,6 +11,11 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/samber/oops"
 	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/gofmt"
+	"github.com/walteh/retab/v2/pkg/formatters/jsonfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/tomlfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/yamlfmt"
 )
 
 type AutoFormatProvider struct {
@@ -23,17 +28,45 @@ type AutoFormatProvider struct {
 	TerraformFmt format.Provider
 	SwiftFmt     format.Provider
 	GoFmt        format.Provider
+	JSONFmt      format.Provider
+	JSONCFmt     format.Provider
+	JSON5Fmt     format.Provider
+	TOMLFmt      format.Provider
+	MarkdownFmt  format.Provider
 }
 
 type LanguageConfig struct {
-	LangIds       []string
+	LangIds []string
+	// FilenameGlobs match the base name, or the trailing path elements when the glob contains a slash
 	FilenameGlobs []string
 	ProviderFunc  func(me *AutoFormatProvider) format.Provider
+	// Options are the Raw() keys the provider reads, on top of indent_style and indent_size
+	Options *format.OptionSet
+}
+
+// CommonConfigKeys are read by every provider through UseTabs and IndentSize
+var CommonConfigKeys = []string{"indent_style", "indent_size"}
+
+const (
+	DetectionMethodExplicit = "explicit"
+	DetectionMethodGlob     = "glob"
+	DetectionMethodContent  = "content"
+)
+
+// Detection records which language config was picked for a file and how
+type Detection struct {
+	Language string
+	// Method is one of explicit (--formatter), glob (filename) or content (enry)
+	Method string
+	// Match is the glob or the enry language that matched, or the --formatter value
+	Match    string
+	Config   *LanguageConfig
+	Provider format.Provider
 }
 
 var (
 	hclConfig = RegisterLanguageConfig(&LanguageConfig{
-		LangIds:       []string{"hcl", "hcl2", "terraform", "tf"},
+		LangIds:       []string{"hcl", "hcl2", "terraform", "tf", "terraform-vars"},
 		FilenameGlobs: []string{"*.{hcl,hcl2,terraform,tf,tfvars}"},
 		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.HCLFmt },
 	})
@@ -46,11 +79,13 @@ var (
 		LangIds:       []string{"yaml", "yml"},
 		FilenameGlobs: []string{"*.yaml", "*.yml"},
 		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.YAMLFmt },
+		Options:       yamlfmt.Options,
 	})
 	shConfig = RegisterLanguageConfig(&LanguageConfig{
-		LangIds:       []string{"sh", "bash", "zsh", "ksh", "shell"},
+		LangIds:       []string{"sh", "bash", "zsh", "ksh", "shell", "shellscript"},
 		FilenameGlobs: []string{"*.sh", "*.bash", "*.zsh", "*.ksh", "*.shell"},
 		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.ShFmt },
+		Options:       shfmt.Options,
 	})
 	dockerConfig = RegisterLanguageConfig(&LanguageConfig{
 		LangIds:       []string{"dockerfile", "docker"},
@@ -76,31 +111,81 @@ var (
 		LangIds:       []string{"go", "golang"},
 		FilenameGlobs: []string{"*.go"},
 		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.GoFmt },
+		Options:       gofmt.Options,
+	})
+	// jsonc is registered before json so its well known .json files are not formatted as strict json
+	jsoncConfig = RegisterLanguageConfig(&LanguageConfig{
+		LangIds:       []string{"jsonc", "json with comments"},
+		FilenameGlobs: []string{"*.jsonc", "tsconfig.json", "tsconfig.*.json", "jsconfig.json", ".vscode/*.json"},
+		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.JSONCFmt },
+		Options:       jsonfmt.Options,
+	})
+	jsonConfig = RegisterLanguageConfig(&LanguageConfig{
+		LangIds:       []string{"json"},
+		FilenameGlobs: []string{"*.json"},
+		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.JSONFmt },
+		Options:       jsonfmt.Options,
+	})
+	json5Config = RegisterLanguageConfig(&LanguageConfig{
+		LangIds:       []string{"json5"},
+		FilenameGlobs: []string{"*.json5"},
+		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.JSON5Fmt },
+		Options:       jsonfmt.Options,
+	})
+	tomlConfig = RegisterLanguageConfig(&LanguageConfig{
+		LangIds:       []string{"toml"},
+		FilenameGlobs: []string{"*.toml"},
+		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.TOMLFmt },
+		Options:       tomlfmt.Options,
+	})
+	markdownConfig = RegisterLanguageConfig(&LanguageConfig{
+		LangIds:       []string{"markdown", "md"},
+		FilenameGlobs: []string{"*.md", "*.markdown"},
+		ProviderFunc:  func(me *AutoFormatProvider) format.Provider { return me.MarkdownFmt },
 	})
 )
 
 func (me *AutoFormatProvider) GetFormatter(ctx context.Context, formatter string, filename string, content io.ReadSeeker) (format.Provider, error) {
+	detection, err := me.Detect(ctx, formatter, filename, content)
+	if err != nil {
+		return nil, err
+	}
+	return detection.Provider, nil
+}
+
+// Detect is GetFormatter, but also reports how the formatter was chosen
+func (me *AutoFormatProvider) Detect(ctx context.Context, formatter string, filename string, content io.ReadSeeker) (*Detection, error) {
 
 	if formatter == "auto" || formatter == "" {
 
-		fmtr, ok := me.DetectFormatterFromFilenameGlobs(ctx, filename)
+		detection, ok := me.detectFromFilenameGlobs(ctx, filename)
 		if ok {
-			return fmtr, nil
+			return detection, nil
 		}
 
-		fmtr, ok = me.DetectFormatterFromContent(ctx, filename, content)
+		detection, ok = me.detectFromContent(ctx, filename, content)
 		if ok {
-			return fmtr, nil
+			return detection, nil
 		}
 
 		return nil, oops.WithContext(ctx).Errorf("unable to auto-detect formatter")
 	}
 
-	fmtr, ok := me.GetFormatterByLangID(ctx, formatter)
+	config, ok := languageConfigByID(formatter)
 	if !ok {
 		return nil, oops.WithContext(ctx).With("formatter_arg", formatter).Errorf("unknown formatter name")
 	}
-	return fmtr, nil
+	return me.detection(config, DetectionMethodExplicit, formatter), nil
+}
+
+func (me *AutoFormatProvider) detection(config *LanguageConfig, method string, match string) *Detection {
+	return &Detection{
+		Language: config.LangIds[0],
+		Method:   method,
+		Match:    match,
+		Config:   config,
+		Provider: config.ProviderFunc(me),
+	}
 }
 
 var languageConfigs = []*LanguageConfig{}
@@ -110,12 +195,12 @@ func RegisterLanguageConfig(config *LanguageConfig) *LanguageConfig {
 	return config
 }
 
-func (me *AutoFormatProvider) GetFormatterByLangID(ctx context.Context, lang string) (format.Provider, bool) {
+func languageConfigByID(lang string) (*LanguageConfig, bool) {
 	lang = strings.ToLower(lang)
 	for _, config := range languageConfigs {
 		for _, langId := range config.LangIds {
 			if langId == lang {
-				return config.ProviderFunc(me), true
+				return config, true
 			}
 		}
 	}
@@ -123,19 +208,39 @@ func (me *AutoFormatProvider) GetFormatterByLangID(ctx context.Context, lang str
 	return nil, false
 }
 
+func (me *AutoFormatProvider) GetFormatterByLangID(ctx context.Context, lang string) (format.Provider, bool) {
+	config, ok := languageConfigByID(lang)
+	if !ok {
+		return nil, false
+	}
+	return config.ProviderFunc(me), true
+}
+
 func (me *AutoFormatProvider) DetectFormatterFromFilenameGlobs(ctx context.Context, filename string) (format.Provider, bool) {
+	detection, ok := me.detectFromFilenameGlobs(ctx, filename)
+	if !ok {
+		return nil, false
+	}
+	return detection.Provider, true
+}
+
+func (me *AutoFormatProvider) detectFromFilenameGlobs(ctx context.Context, filename string) (*Detection, bool) {
 
 	for _, config := range languageConfigs {
 		for _, glob := range config.FilenameGlobs {
-			matches, err := doublestar.PathMatch(glob, filepath.Base(filename))
+			pattern, name := glob, filepath.Base(filename)
+			if strings.Contains(glob, "/") {
+				pattern, name = "**/"+glob, filepath.ToSlash(filename)
+			}
+			matches, err := doublestar.Match(pattern, name)
 			if err != nil {
 				// should never happen
 				panic("globbing: " + err.Error())
 			}
 			if matches {
-				provider := config.ProviderFunc(me)
-				zerolog.Ctx(ctx).Info().Str("glob", glob).Type("detected_formatter", provider).Msg("detected formatter (fast)")
-				return provider, true
+				detection := me.detection(config, DetectionMethodGlob, glob)
+				zerolog.Ctx(ctx).Info().Str("glob", glob).Type("detected_formatter", detection.Provider).Msg("detected formatter (fast)")
+				return detection, true
 			}
 		}
 	}
@@ -144,13 +249,21 @@ func (me *AutoFormatProvider) DetectFormatterFromFilenameGlobs(ctx context.Conte
 }
 
 func (me *AutoFormatProvider) DetectFormatterFromContent(ctx context.Context, filename string, br io.ReadSeeker) (format.Provider, bool) {
+	detection, ok := me.detectFromContent(ctx, filename, br)
+	if !ok {
+		return nil, false
+	}
+	return detection.Provider, true
+}
+
+func (me *AutoFormatProvider) detectFromContent(ctx context.Context, filename string, br io.ReadSeeker) (*Detection, bool) {
 
 	// Peek at the first 250 bytes without advancing the reader
 	peeked := make([]byte, 250)
-	_, _ = br.Read(peeked)
+	n, _ := br.Read(peeked)
 	defer br.Seek(0, io.SeekStart)
 
-	langs := enry.GetLanguages(filename, peeked)
+	langs := enry.GetLanguages(filename, peeked[:n])
 	if len(langs) == 0 {
 		return nil, false
 	}
@@ -158,17 +271,18 @@ func (me *AutoFormatProvider) DetectFormatterFromContent(ctx context.Context, fi
 	zerolog.Ctx(ctx).Debug().Strs("languages", langs).Msg("found languages")
 
 	for _, lang := range langs {
-		fmtr, ok := me.GetFormatterByLangID(ctx, lang)
+		config, ok := languageConfigByID(lang)
 		if !ok {
 			continue
 		}
 
 		zerolog.Ctx(ctx).Info().Str("language_detected", lang).Msg("detected formatter (fallback)")
 
-		return fmtr, true
+		return me.detection(config, DetectionMethodContent, lang), true
 	}
 
-	zerolog.Ctx(ctx).Warn().Strs("languages_detected", langs).Msg("fallback:no formatter found for detected languages")
+	// walking a directory finds many files without a formatter, the caller decides if that is a problem
+	zerolog.Ctx(ctx).Debug().Strs("languages_detected", langs).Msg("fallback:no formatter found for detected languages")
 
 	return nil, false
 }
@@ -13,6 +13,7 @@ type basicExternalFormatter struct {
 	indent    string
 	tempFiles map[string]string
 	f         func(io.Reader, io.Writer) func(ctx context.Context) error
+	key       string
 }
 
 //go:opts
@@ -22,6 +23,13 @@ type BasicExternalFormatterOpts struct {
 
 	useDocker bool
 
+	// runtime is one of auto, native, podman, nerdctl or docker, see ResolveRuntime
+	runtime string
+	// versionArgs print the native executable's version, without them any version is accepted
+	versionArgs []string
+	// nativeVersion is the version a native executable must have, it defaults to the docker image tag
+	nativeVersion string
+
 	dockerImageName string
 	dockerImageTag  string
 	dockerCommand   []string
@@ -30,7 +38,7 @@ type BasicExternalFormatterOpts struct {
 }
 
 func NewNoopBasicExternalFormatProvider() format.Provider {
-	return WrapExternalFormatterWithStdio(&basicExternalFormatter{"  ", map[string]string{}, func(r io.Reader, w io.Writer) func(ctx context.Context) error {
+	return WrapExternalFormatterWithStdio(&basicExternalFormatter{indent: "  ", tempFiles: map[string]string{}, key: "noop", f: func(r io.Reader, w io.Writer) func(ctx context.Context) error {
 		return func(ctx context.Context) error {
 			_, err := io.Copy(w, r)
 			if err != nil {
@@ -68,6 +76,11 @@ func (me *basicExternalFormatter) Indent() string {
 	return me.indent
 }
 
+// CacheKey implements format.CacheKeyer.
+func (me *basicExternalFormatter) CacheKey(ctx context.Context) string {
+	return me.key
+}
+
 // TempFiles implements format.ExternalFormatter.
 func (me *basicExternalFormatter) TempFiles() map[string]string {
 	return me.tempFiles
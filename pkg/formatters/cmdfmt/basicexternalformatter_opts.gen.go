@@ -38,6 +38,27 @@ func WithUseDocker(opt bool) OptBasicExternalFormatterOptsSetter {
 	}
 }
 
+func WithRuntime(opt string) OptBasicExternalFormatterOptsSetter {
+	return func(o *BasicExternalFormatterOpts) {
+		o.runtime = opt
+
+	}
+}
+
+func WithVersionArgs(opt []string) OptBasicExternalFormatterOptsSetter {
+	return func(o *BasicExternalFormatterOpts) {
+		o.versionArgs = opt
+
+	}
+}
+
+func WithNativeVersion(opt string) OptBasicExternalFormatterOptsSetter {
+	return func(o *BasicExternalFormatterOpts) {
+		o.nativeVersion = opt
+
+	}
+}
+
 func WithDockerImageName(opt string) OptBasicExternalFormatterOptsSetter {
 	return func(o *BasicExternalFormatterOpts) {
 		o.dockerImageName = opt
@@ -3,6 +3,7 @@
 package cmdfmt
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/rs/zerolog"
 	"gitlab.com/tozd/go/errors"
 )
 
@@ -25,14 +27,34 @@ func runBasicCmd(ctx context.Context, cmds []string) (string, error) {
 	return string(out), nil
 }
 
-func runFmtCmd(ctx context.Context, cmds []string, w io.Writer, r io.Reader, opts *BasicExternalFormatterOpts) error {
+// CommandError is the failure of an external formatter, with what it wrote to stderr
+type CommandError struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
 
-	fmt.Println("CMDS", strings.Join(cmds, " "))
+func (e *CommandError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: %v", e.Args[0], e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Args[0], e.Err, strings.TrimSpace(e.Stderr))
+}
 
-	cmd := exec.Command(cmds[0], cmds[1:]...)
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// runFmtCmd pipes r through the command into w. Only the command's stdout is written to w, its
+// stderr is kept for the error or logged.
+func runFmtCmd(ctx context.Context, cmds []string, w io.Writer, r io.Reader, opts *BasicExternalFormatterOpts) error {
+	zerolog.Ctx(ctx).Debug().Strs("command", cmds).Msg("running external formatter")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, cmds[0], cmds[1:]...)
 	cmd.Stdin = r
 	cmd.Stdout = w
-	cmd.Stderr = w
+	cmd.Stderr = &stderr
 	cmd.Env = os.Environ()
 
 	for cname, cdata := range opts.tempFiles {
@@ -53,14 +75,13 @@ func runFmtCmd(ctx context.Context, cmds []string, w io.Writer, r io.Reader, opt
 		}
 	}
 
-	// out, err := cmd.CombinedOutput()
-	// if err != nil {
-	// 	return errors.Errorf("failed to run command: %w", err)
-	// }
-
-	// fmt.Println("OUT", string(out))
+	if err := cmd.Run(); err != nil {
+		return &CommandError{Args: cmds, Stderr: stderr.String(), Err: err}
+	}
 
-	// read the from stdout
+	if stderr.Len() > 0 {
+		zerolog.Ctx(ctx).Debug().Strs("command", cmds).Str("stderr", stderr.String()).Msg("external formatter wrote to stderr")
+	}
 
-	return cmd.Run()
+	return nil
 }
@@ -0,0 +1,43 @@
+//go:build !js
+
+package cmdfmt_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
+	"gitlab.com/tozd/go/errors"
+)
+
+func TestCmdFormatterStderr(t *testing.T) {
+	cfg := formatmock.NewMockConfiguration(t)
+	cfg.EXPECT().UseTabs().Return(true).Maybe()
+	cfg.EXPECT().IndentSize().Return(4).Maybe()
+	cfg.EXPECT().Raw().Return(map[string]string{}).Maybe()
+
+	fmtr := cmdfmt.NewCmdFormatter([]string{"sh", "-c", "echo 'a warning' >&2; cat"}, cmdfmt.WithIndent("\t"))
+	r, err := fmtr.Format(context.Background(), cfg, strings.NewReader("a\n"))
+	require.NoError(t, err, "formatting should succeed")
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err, "reading the output should succeed")
+	assert.Equal(t, "a\n", string(out), "the command's stderr should not end up in the output")
+
+	fmtr = cmdfmt.NewCmdFormatter([]string{"sh", "-c", "echo 'bad input' >&2; exit 3"}, cmdfmt.WithIndent("\t"))
+	r, err = fmtr.Format(context.Background(), cfg, strings.NewReader("a\n"))
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	require.Error(t, err, "a failing command should fail formatting")
+
+	var cmdErr *cmdfmt.CommandError
+	require.True(t, errors.As(err, &cmdErr), "the error should be a command error")
+	assert.Equal(t, "bad input\n", cmdErr.Stderr, "the command's stderr should be attached to the error")
+	assert.Contains(t, err.Error(), "bad input", "the error should show the command's stderr")
+}
@@ -9,15 +9,86 @@ import (
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
 )
 
+// dockerContainer is a long lived container that formats are exec'd into, it is shared by every
+// formatter using the same runtime and image so a run over many files starts at most one container per image
+type dockerContainer struct {
+	runtime    string
+	image      string
+	name       string
+	once       sync.Once
+	started    bool
+	startError error
+}
+
+var (
+	dockerContainersMu sync.Mutex
+	dockerContainers   = map[string]*dockerContainer{}
+)
+
+func dockerContainerFor(runtime string, image string) *dockerContainer {
+	dockerContainersMu.Lock()
+	defer dockerContainersMu.Unlock()
+
+	key := runtime + " " + image
+	if c, ok := dockerContainers[key]; ok {
+		return c
+	}
+
+	c := &dockerContainer{runtime: runtime, image: image, name: "retab_" + xid.New().String()}
+	dockerContainers[key] = c
+	return c
+}
+
+func (me *dockerContainer) start(ctx context.Context) error {
+	me.once.Do(func() {
+		// the entrypoint is replaced so the container idles regardless of what the image runs by default
+		cmds := []string{me.runtime, "run", "--detach", "--rm", "--name", me.name, "--entrypoint", "tail", me.image, "-f", "/dev/null"}
+		out, err := runBasicCmd(ctx, cmds)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("runtime", me.runtime).Str("container", me.name).Msg("failed to start container")
+			me.startError = errors.Errorf("starting %s container for %s: %w", me.runtime, me.image, err)
+			return
+		}
+		me.started = true
+		zerolog.Ctx(ctx).Debug().Str("runtime", me.runtime).Str("container", me.name).Str("id", out).Msg("container started")
+	})
+	return me.startError
+}
+
+// RemoveContainers force removes every container started by an external formatter, whatever the
+// runtime. It should be called once before the process exits, including when it is interrupted.
+func RemoveContainers(ctx context.Context) error {
+	dockerContainersMu.Lock()
+	containers := dockerContainers
+	dockerContainers = map[string]*dockerContainer{}
+	dockerContainersMu.Unlock()
+
+	var errs []error
+	for _, c := range containers {
+		// wait for a start that is still in flight, and mark unstarted containers as done
+		c.once.Do(func() {})
+		if !c.started {
+			continue
+		}
+		zerolog.Ctx(ctx).Debug().Str("runtime", c.runtime).Str("container", c.name).Msg("removing container")
+		if _, err := runBasicCmd(ctx, []string{c.runtime, "rm", "--force", c.name}); err != nil {
+			errs = append(errs, errors.Errorf("removing %s container %s: %w", c.runtime, c.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 type DockerExternalFormatter struct {
-	Image         string
-	Command       []string
-	Once          sync.Once
-	containerName string
-	startError    error
-	internal      format.Provider
+	Runtime   string
+	Image     string
+	Command   []string
+	container *dockerContainer
+	opts      BasicExternalFormatterOpts
+	internal  format.Provider
 }
 
 func NewDockerCmdFormatter(command []string, optz ...OptBasicExternalFormatterOptsSetter) *DockerExternalFormatter {
@@ -40,52 +111,48 @@ func NewDockerCmdFormatter(command []string, optz ...OptBasicExternalFormatterOp
 		panic("executable is empty")
 	}
 
-	cmds := append([]string{opts.executable}, command...)
+	return newContainerCmdFormatter(RuntimeDocker, command, opts, optz...)
+}
+
+// newContainerCmdFormatter works with any runtime that accepts docker's run, exec and rm flags
+func newContainerCmdFormatter(runtime string, command []string, opts BasicExternalFormatterOpts, optz ...OptBasicExternalFormatterOptsSetter) *DockerExternalFormatter {
+	image := fmt.Sprintf("%s:%s", opts.dockerImageName, opts.dockerImageTag)
+	container := dockerContainerFor(runtime, image)
 
-	containerName := "retab_" + xid.New().String()
+	cmds := append([]string{opts.executable}, command...)
 
-	fmtCmds := []string{"docker", "run", "--interactive", "--quiet", "--name", containerName, fmt.Sprintf("%s:%s", opts.dockerImageName, opts.dockerImageTag)}
+	fmtCmds := []string{runtime, "exec", "--interactive", container.name}
 	fmtCmds = append(fmtCmds, cmds...)
 
 	basic := NewCmdFormatter(fmtCmds, optz...)
 
 	return &DockerExternalFormatter{
-		Image:         fmt.Sprintf("%s:%s", opts.dockerImageName, opts.dockerImageTag),
-		Command:       fmtCmds,
-		containerName: containerName,
-		internal:      basic,
+		Runtime:   runtime,
+		Image:     image,
+		Command:   fmtCmds,
+		container: container,
+		opts:      opts,
+		internal:  basic,
 	}
 }
 
+// CacheKey implements format.CacheKeyer, leaving out the container name that changes every run
+func (me *DockerExternalFormatter) CacheKey(ctx context.Context) string {
+	return fmt.Sprintf("%s %s", me.Image, cmdCacheKey(me.Command[4:], me.opts))
+}
+
 func (me *DockerExternalFormatter) Format(ctx context.Context, cfg format.Configuration, input io.Reader) (io.Reader, error) {
-	if me.startError != nil {
-		return nil, me.startError
+	if err := me.container.start(ctx); err != nil {
+		return nil, err
 	}
 
-	// me.Once.Do(func() {
-	// 	// create the container
-	// 	cmds := []string{"docker", "run", "--name", me.containerName, me.Image}
-	// 	cmds = append(cmds, me.Command...)
-	// 	out, err := runBasicCmd(ctx, cmds)
-	// 	if err != nil {
-	// 		zerolog.Ctx(ctx).Error().Err(err).Str("container", me.containerName).Msg("failed to start docker container")
-	// 		me.startError = err
-	// 	} else {
-	// 		zerolog.Ctx(ctx).Info().Str("container", me.containerName).Msgf("docker container started: %s", out)
-	// 		go func() {
-	// 			// wait for our go process to exit (signal)and clean up docker container
-	// 			sig := make(chan os.Signal, 1)
-	// 			signal.Notify(sig, os.Interrupt)
-	// 			<-sig
-	// 			_, err := runBasicCmd(ctx, []string{"docker", "rm", "--force", me.containerName})
-	// 			if err != nil {
-	// 				zerolog.Ctx(ctx).Error().Err(err).Str("container", me.containerName).Msg("failed to remove docker container")
-	// 			}
-	// 		}()
-	// 	}
-	// })
-
-	zerolog.Ctx(ctx).Info().Str("container", me.containerName).Strs("command", me.Command).Msg("formatting with docker")
+	zerolog.Ctx(ctx).Info().Str("runtime", me.Runtime).Str("container", me.container.name).Strs("command", me.Command).Msg("formatting in container")
 
 	return me.internal.Format(ctx, cfg, input)
 }
+
+var _ RuntimeResolver = (*DockerExternalFormatter)(nil)
+
+func (me *DockerExternalFormatter) ResolveRuntime(ctx context.Context) (*RuntimeDecision, error) {
+	return &RuntimeDecision{Runtime: me.Runtime, Executable: me.Runtime, Image: me.Image, Reason: "container formatter"}, nil
+}
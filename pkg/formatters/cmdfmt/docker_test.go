@@ -0,0 +1,155 @@
+package cmdfmt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
+)
+
+// fakeDocker logs every invocation and behaves just enough like docker for the formatter:
+// `run` prints an id, `exec` echoes stdin back and `rm` succeeds
+const fakeDocker = `#!/bin/sh
+echo "$@" >> "$FAKE_DOCKER_LOG"
+case "$1" in
+run)
+	if [ -n "$FAKE_DOCKER_FAIL_RUN" ]; then
+		echo "no such image" >&2
+		exit 1
+	fi
+	echo abc123
+	;;
+exec)
+	cat
+	;;
+esac
+`
+
+func installFakeDocker(t *testing.T) func() []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte(fakeDocker), 0o755), "writing fake docker should succeed")
+
+	logFile := filepath.Join(dir, "docker.log")
+	t.Setenv("FAKE_DOCKER_LOG", logFile)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	t.Cleanup(func() { _ = cmdfmt.RemoveContainers(context.Background()) })
+
+	return func() []string {
+		data, err := os.ReadFile(logFile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		require.NoError(t, err, "reading fake docker log should succeed")
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+}
+
+func countPrefix(lines []string, prefix string) int {
+	n := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func newFakeDockerFormatter(image string) *cmdfmt.DockerExternalFormatter {
+	return cmdfmt.NewDockerCmdFormatter([]string{"format"},
+		cmdfmt.WithUseDocker(true),
+		cmdfmt.WithIndent("  "),
+		cmdfmt.WithExecutable("fmtr"),
+		cmdfmt.WithDockerImageName(image),
+		cmdfmt.WithDockerImageTag("1"),
+	)
+}
+
+func TestDockerContainerIsReused(t *testing.T) {
+	calls := installFakeDocker(t)
+	ctx := context.Background()
+
+	cfg := formatmock.NewMockConfiguration(t)
+	cfg.EXPECT().UseTabs().Return(true)
+	cfg.EXPECT().IndentSize().Return(1).Maybe()
+
+	fmtr := newFakeDockerFormatter("reused")
+
+	for range 3 {
+		result, err := fmtr.Format(ctx, cfg, bytes.NewReader([]byte("a {\n  b\n}\n")))
+		require.NoError(t, err, "formatting should succeed")
+
+		got, err := io.ReadAll(result)
+		require.NoError(t, err, "reading result should succeed")
+		assert.Equal(t, "a {\n\tb\n}\n", string(got), "exec output should be re-indented")
+	}
+
+	// a second formatter for the same image shares the container
+	_, err := newFakeDockerFormatter("reused").Format(ctx, cfg, bytes.NewReader([]byte("a\n")))
+	require.NoError(t, err, "formatting should succeed")
+
+	lines := calls()
+	assert.Equal(t, 1, countPrefix(lines, "run "), "one container should be started")
+	assert.Equal(t, 4, countPrefix(lines, "exec "), "every format should be exec'd")
+	assert.Contains(t, lines[0], "reused:1", "the container should use the formatter image")
+
+	require.NoError(t, cmdfmt.RemoveContainers(ctx), "removing containers should succeed")
+
+	lines = calls()
+	require.Equal(t, 1, countPrefix(lines, "rm "), "the container should be removed")
+	name := strings.Fields(lines[1])[2]
+	assert.Equal(t, "rm --force "+name, lines[len(lines)-1], "the started container should be removed")
+}
+
+func TestDockerContainerPerImage(t *testing.T) {
+	calls := installFakeDocker(t)
+	ctx := context.Background()
+
+	cfg := formatmock.NewMockConfiguration(t)
+	cfg.EXPECT().UseTabs().Return(true)
+	cfg.EXPECT().IndentSize().Return(1).Maybe()
+
+	for _, image := range []string{"one", "two", "one"} {
+		_, err := newFakeDockerFormatter(image).Format(ctx, cfg, bytes.NewReader([]byte("a\n")))
+		require.NoError(t, err, "formatting should succeed")
+	}
+
+	require.NoError(t, cmdfmt.RemoveContainers(ctx), "removing containers should succeed")
+
+	lines := calls()
+	assert.Equal(t, 2, countPrefix(lines, "run "), "one container per image should be started")
+	assert.Equal(t, 2, countPrefix(lines, "rm "), "every container should be removed")
+}
+
+func TestDockerContainerStartFailure(t *testing.T) {
+	calls := installFakeDocker(t)
+	t.Setenv("FAKE_DOCKER_FAIL_RUN", "1")
+	ctx := context.Background()
+
+	cfg := formatmock.NewMockConfiguration(t)
+
+	fmtr := newFakeDockerFormatter("missing")
+
+	for range 2 {
+		_, err := fmtr.Format(ctx, cfg, bytes.NewReader([]byte("a\n")))
+		require.Error(t, err, "formatting should fail when the container cannot start")
+		assert.Contains(t, err.Error(), "no such image", "the docker error should be reported")
+	}
+
+	require.NoError(t, cmdfmt.RemoveContainers(ctx), "removing containers should succeed")
+
+	lines := calls()
+	assert.Equal(t, 1, countPrefix(lines, "run "), "a failed start should not be retried")
+	assert.Equal(t, 0, countPrefix(lines, "exec "), "nothing should be exec'd")
+	assert.Equal(t, 0, countPrefix(lines, "rm "), "nothing should be removed")
+}
@@ -2,6 +2,7 @@ package cmdfmt
 
 import (
 	"context"
+	"fmt"
 	"io"
 
 	"github.com/walteh/retab/v2/pkg/format"
@@ -21,13 +22,7 @@ func NewFormatter(cmds []string, optz ...OptBasicExternalFormatterOptsSetter) fo
 		panic("executable is empty")
 	}
 
-	if opts.useDocker {
-		return NewDockerCmdFormatter(cmds, optz...)
-	}
-
-	cmds = append([]string{opts.executable}, cmds...)
-
-	return NewCmdFormatter(cmds, optz...)
+	return &runtimeFormatter{cmds: cmds, optz: optz, opts: opts}
 }
 
 func NewCmdFormatter(cmds []string, optz ...OptBasicExternalFormatterOptsSetter) format.Provider {
@@ -36,6 +31,7 @@ func NewCmdFormatter(cmds []string, optz ...OptBasicExternalFormatterOptsSetter)
 	basic := &basicExternalFormatter{
 		indent:    opts.indent,
 		tempFiles: opts.tempFiles,
+		key:       cmdCacheKey(cmds, opts),
 		f: func(r io.Reader, w io.Writer) func(ctx context.Context) error {
 			if len(cmds) < 1 {
 				return func(ctx context.Context) error {
@@ -50,3 +46,7 @@ func NewCmdFormatter(cmds []string, optz ...OptBasicExternalFormatterOptsSetter)
 
 	return WrapExternalFormatterWithStdio(basic)
 }
+
+func cmdCacheKey(cmds []string, opts BasicExternalFormatterOpts) string {
+	return fmt.Sprintf("cmd %q indent=%q", cmds, opts.indent)
+}
@@ -3,6 +3,7 @@ package cmdfmt
 import (
 	"context"
 	"io"
+	"reflect"
 
 	"github.com/walteh/retab/v2/pkg/format"
 	"gitlab.com/tozd/go/errors"
@@ -38,3 +39,12 @@ func (me *externalStdioFormatter) Format(ctx context.Context, cfg format.Configu
 
 	return output, nil
 }
+
+// CacheKey implements format.CacheKeyer, every external formatter shares this type so the
+// wrapped formatter has to tell them apart
+func (me *externalStdioFormatter) CacheKey(ctx context.Context) string {
+	if keyer, ok := me.internal.(format.CacheKeyer); ok {
+		return keyer.CacheKey(ctx)
+	}
+	return reflect.TypeOf(me.internal).String()
+}
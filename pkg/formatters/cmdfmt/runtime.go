@@ -0,0 +1,215 @@
+package cmdfmt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+const (
+	RuntimeAuto    = "auto"
+	RuntimeNative  = "native"
+	RuntimeDocker  = "docker"
+	RuntimePodman  = "podman"
+	RuntimeNerdctl = "nerdctl"
+
+	// RuntimeEnvVar picks the runtime when none is configured explicitly
+	RuntimeEnvVar = "RETAB_RUNTIME"
+)
+
+// containerRuntimes are tried in this order when no native executable is usable
+var containerRuntimes = []string{RuntimePodman, RuntimeNerdctl, RuntimeDocker}
+
+// RuntimeDecision records which binary an external formatter runs and why it was picked
+type RuntimeDecision struct {
+	Runtime    string `json:"runtime"`
+	Executable string `json:"executable"`
+	Image      string `json:"image,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+func (me *RuntimeDecision) String() string {
+	if me.Runtime == RuntimeNative {
+		return fmt.Sprintf("native %s (%s)", me.Executable, me.Reason)
+	}
+	return fmt.Sprintf("%s image %s (%s)", me.Runtime, me.Image, me.Reason)
+}
+
+// RuntimeResolver is implemented by providers that run an external binary, so callers can
+// explain which one formatted a file
+type RuntimeResolver interface {
+	ResolveRuntime(ctx context.Context) (*RuntimeDecision, error)
+}
+
+var lookPath = exec.LookPath
+
+var versionRegex = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// ResolveRuntime applies the runtime policy: an explicit runtime (option, then RETAB_RUNTIME) is
+// used as is, otherwise a native executable at a matching version wins over podman, nerdctl and docker
+func ResolveRuntime(ctx context.Context, opts *BasicExternalFormatterOpts) (*RuntimeDecision, error) {
+	image := fmt.Sprintf("%s:%s", opts.dockerImageName, opts.dockerImageTag)
+
+	runtime, reason := opts.runtime, "configured runtime"
+	if runtime == "" {
+		runtime, reason = os.Getenv(RuntimeEnvVar), "set by "+RuntimeEnvVar
+	}
+	if runtime == "" && opts.useDocker {
+		runtime, reason = RuntimeDocker, "configured runtime"
+	}
+	if runtime == "" {
+		runtime = RuntimeAuto
+	}
+
+	switch runtime {
+	case RuntimeNative:
+		return resolveNative(ctx, opts)
+	case RuntimeDocker, RuntimePodman, RuntimeNerdctl:
+		// not looked up on PATH, an explicit runtime may only be reachable through a wrapper (like in wasm)
+		return &RuntimeDecision{Runtime: runtime, Executable: runtime, Image: image, Reason: reason}, nil
+	case RuntimeAuto:
+	default:
+		return nil, errors.Errorf("unknown runtime %q, expected one of auto, native, podman, nerdctl or docker", runtime)
+	}
+
+	decision, nativeErr := resolveNative(ctx, opts)
+	if nativeErr == nil {
+		return decision, nil
+	}
+
+	if opts.dockerImageName == "" {
+		return nil, nativeErr
+	}
+
+	for _, rt := range containerRuntimes {
+		path, err := lookPath(rt)
+		if err != nil {
+			continue
+		}
+		return &RuntimeDecision{Runtime: rt, Executable: path, Image: image, Reason: nativeErr.Error()}, nil
+	}
+
+	return nil, errors.Errorf("no runtime available for %s: %w, and none of podman, nerdctl or docker is on PATH", opts.executable, nativeErr)
+}
+
+func resolveNative(ctx context.Context, opts *BasicExternalFormatterOpts) (*RuntimeDecision, error) {
+	path, err := lookPath(opts.executable)
+	if err != nil {
+		return nil, errors.Errorf("%s not found on PATH", opts.executable)
+	}
+
+	want := opts.nativeVersion
+	if want == "" {
+		want = opts.dockerImageTag
+	}
+
+	if len(opts.versionArgs) == 0 {
+		return &RuntimeDecision{Runtime: RuntimeNative, Executable: path, Reason: "found on PATH"}, nil
+	}
+
+	out, err := runBasicCmd(ctx, append([]string{path}, opts.versionArgs...))
+	if err != nil {
+		return nil, errors.Errorf("%s does not report a version: %w", path, err)
+	}
+
+	version := versionRegex.FindString(out)
+	if !versionMatches(want, version) {
+		return nil, errors.Errorf("%s is version %q, want %q", path, version, want)
+	}
+
+	return &RuntimeDecision{Runtime: RuntimeNative, Executable: path, Version: version, Reason: fmt.Sprintf("found on PATH at version %s", version)}, nil
+}
+
+// versionMatches compares dotted components, so "6.1" matches "6.1.2" but not "6.10.0". A want
+// without any version number (like "stable" or "latest") accepts any version.
+func versionMatches(want string, got string) bool {
+	want = versionRegex.FindString(want)
+	if want == "" {
+		return true
+	}
+	if got == "" {
+		return false
+	}
+
+	wantParts := strings.Split(want, ".")
+	gotParts := strings.Split(got, ".")
+	if len(gotParts) < len(wantParts) {
+		return false
+	}
+	for i := range wantParts {
+		if wantParts[i] != gotParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// runtimeFormatter resolves the runtime on first use, resolution runs commands so it is kept out
+// of constructors
+type runtimeFormatter struct {
+	cmds []string
+	optz []OptBasicExternalFormatterOptsSetter
+	opts BasicExternalFormatterOpts
+
+	once     sync.Once
+	decision *RuntimeDecision
+	err      error
+	internal format.Provider
+}
+
+var _ RuntimeResolver = (*runtimeFormatter)(nil)
+
+func (me *runtimeFormatter) ResolveRuntime(ctx context.Context) (*RuntimeDecision, error) {
+	me.once.Do(func() {
+		me.decision, me.err = ResolveRuntime(ctx, &me.opts)
+		if me.err != nil {
+			return
+		}
+
+		zerolog.Ctx(ctx).Info().
+			Str("executable", me.opts.executable).
+			Str("runtime", me.decision.Runtime).
+			Str("path", me.decision.Executable).
+			Str("image", me.decision.Image).
+			Str("reason", me.decision.Reason).
+			Msg("resolved formatter runtime")
+
+		if me.decision.Runtime == RuntimeNative {
+			me.internal = NewCmdFormatter(append([]string{me.decision.Executable}, me.cmds...), me.optz...)
+			return
+		}
+		me.internal = newContainerCmdFormatter(me.decision.Executable, me.cmds, me.opts, me.optz...)
+	})
+	return me.decision, me.err
+}
+
+// CacheKey implements format.CacheKeyer. It resolves the runtime, a native executable of a tag
+// like latest can be any version so the output depends on what was found.
+func (me *runtimeFormatter) CacheKey(ctx context.Context) string {
+	key := fmt.Sprintf("%s:%s %s", me.opts.dockerImageName, me.opts.dockerImageTag, cmdCacheKey(append([]string{me.opts.executable}, me.cmds...), me.opts))
+
+	decision, err := me.ResolveRuntime(ctx)
+	if err != nil {
+		// Format fails the same way, and failures are not cached
+		return key
+	}
+
+	return fmt.Sprintf("%s runtime=%s version=%q", key, decision.Runtime, decision.Version)
+}
+
+func (me *runtimeFormatter) Format(ctx context.Context, cfg format.Configuration, input io.Reader) (io.Reader, error) {
+	if _, err := me.ResolveRuntime(ctx); err != nil {
+		return nil, err
+	}
+	return me.internal.Format(ctx, cfg, input)
+}
@@ -0,0 +1,218 @@
+package cmdfmt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
+)
+
+// fakePath replaces PATH with a directory holding the given scripts
+func fakePath(t *testing.T, scripts map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, script := range scripts {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755), "writing fake %s should succeed", name)
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv(cmdfmt.RuntimeEnvVar, "")
+
+	return dir
+}
+
+func TestResolveRuntime(t *testing.T) {
+	tests := []struct {
+		name        string
+		scripts     map[string]string
+		tag         string
+		opts        []cmdfmt.OptBasicExternalFormatterOptsSetter
+		env         string
+		wantRuntime string
+		wantErr     string
+	}{
+		{
+			name:        "native_at_matching_version",
+			scripts:     map[string]string{"fmtr": "echo fmtr 6.1.2", "docker": ""},
+			tag:         "6.1",
+			wantRuntime: cmdfmt.RuntimeNative,
+		},
+		{
+			name:        "native_version_mismatch_uses_container",
+			scripts:     map[string]string{"fmtr": "echo fmtr 6.10.0", "docker": ""},
+			tag:         "6.1",
+			wantRuntime: cmdfmt.RuntimeDocker,
+		},
+		{
+			name:        "native_version_override",
+			scripts:     map[string]string{"fmtr": "echo 601.0.1", "docker": ""},
+			tag:         "6.1",
+			opts:        []cmdfmt.OptBasicExternalFormatterOptsSetter{cmdfmt.WithNativeVersion("601")},
+			wantRuntime: cmdfmt.RuntimeNative,
+		},
+		{
+			name:        "non_numeric_tag_accepts_any_version",
+			scripts:     map[string]string{"fmtr": "echo 3.5.0", "docker": ""},
+			tag:         "stable",
+			wantRuntime: cmdfmt.RuntimeNative,
+		},
+		{
+			name:        "podman_before_nerdctl_and_docker",
+			scripts:     map[string]string{"podman": "", "nerdctl": "", "docker": ""},
+			tag:         "1",
+			wantRuntime: cmdfmt.RuntimePodman,
+		},
+		{
+			name:        "nerdctl_before_docker",
+			scripts:     map[string]string{"nerdctl": "", "docker": ""},
+			tag:         "1",
+			wantRuntime: cmdfmt.RuntimeNerdctl,
+		},
+		{
+			name:        "configured_runtime_wins_over_native",
+			scripts:     map[string]string{"fmtr": "echo 1.0.0"},
+			tag:         "1",
+			opts:        []cmdfmt.OptBasicExternalFormatterOptsSetter{cmdfmt.WithRuntime(cmdfmt.RuntimeNerdctl)},
+			wantRuntime: cmdfmt.RuntimeNerdctl,
+		},
+		{
+			name:        "env_runtime",
+			scripts:     map[string]string{"fmtr": "echo 1.0.0"},
+			tag:         "1",
+			env:         cmdfmt.RuntimePodman,
+			wantRuntime: cmdfmt.RuntimePodman,
+		},
+		{
+			name:    "configured_native_missing",
+			scripts: map[string]string{"docker": ""},
+			tag:     "1",
+			opts:    []cmdfmt.OptBasicExternalFormatterOptsSetter{cmdfmt.WithRuntime(cmdfmt.RuntimeNative)},
+			wantErr: "fmtr not found on PATH",
+		},
+		{
+			name:    "nothing_available",
+			scripts: map[string]string{},
+			tag:     "1",
+			wantErr: "none of podman, nerdctl or docker is on PATH",
+		},
+		{
+			name:    "unknown_runtime",
+			scripts: map[string]string{},
+			tag:     "1",
+			opts:    []cmdfmt.OptBasicExternalFormatterOptsSetter{cmdfmt.WithRuntime("lxc")},
+			wantErr: `unknown runtime "lxc"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePath(t, tt.scripts)
+			if tt.env != "" {
+				t.Setenv(cmdfmt.RuntimeEnvVar, tt.env)
+			}
+
+			opts := cmdfmt.NewBasicExternalFormatterOpts(append([]cmdfmt.OptBasicExternalFormatterOptsSetter{
+				cmdfmt.WithExecutable("fmtr"),
+				cmdfmt.WithVersionArgs([]string{"--version"}),
+				cmdfmt.WithDockerImageName("fmtr"),
+				cmdfmt.WithDockerImageTag(tt.tag),
+			}, tt.opts...)...)
+
+			decision, err := cmdfmt.ResolveRuntime(context.Background(), &opts)
+			if tt.wantErr != "" {
+				require.Error(t, err, "resolving should fail")
+				assert.Contains(t, err.Error(), tt.wantErr, "the error should explain why")
+				return
+			}
+
+			require.NoError(t, err, "resolving should succeed")
+			assert.Equal(t, tt.wantRuntime, decision.Runtime, "unexpected runtime, reason: %s", decision.Reason)
+			assert.NotEmpty(t, decision.Reason, "the decision should have a reason")
+		})
+	}
+}
+
+func TestFormatterUsesResolvedRuntime(t *testing.T) {
+	tests := []struct {
+		name        string
+		scripts     map[string]string
+		wantRuntime string
+	}{
+		{
+			name:        "native",
+			scripts:     map[string]string{"fmtr": "[ \"$1\" = --version ] && echo 1.2.3 && exit 0\ncat"},
+			wantRuntime: cmdfmt.RuntimeNative,
+		},
+		{
+			name:        "podman",
+			scripts:     map[string]string{"podman": fakeDocker},
+			wantRuntime: cmdfmt.RuntimePodman,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the fakes need the system tools (cat) but still come first
+			system := os.Getenv("PATH")
+			dir := fakePath(t, tt.scripts)
+			t.Setenv("PATH", dir+string(os.PathListSeparator)+system)
+			t.Setenv("FAKE_DOCKER_LOG", filepath.Join(dir, "calls.log"))
+			t.Cleanup(func() { _ = cmdfmt.RemoveContainers(context.Background()) })
+
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(true)
+			cfg.EXPECT().IndentSize().Return(1).Maybe()
+
+			fmtr := cmdfmt.NewFormatter([]string{"format"},
+				cmdfmt.WithIndent("  "),
+				cmdfmt.WithExecutable("fmtr"),
+				cmdfmt.WithVersionArgs([]string{"--version"}),
+				cmdfmt.WithDockerImageName("fmtr"),
+				cmdfmt.WithDockerImageTag("1"),
+			)
+
+			result, err := fmtr.Format(context.Background(), cfg, bytes.NewReader([]byte("a {\n  b\n}\n")))
+			require.NoError(t, err, "formatting should succeed")
+
+			got, err := io.ReadAll(result)
+			require.NoError(t, err, "reading result should succeed")
+			assert.Equal(t, "a {\n\tb\n}\n", string(got), "output should be re-indented")
+
+			resolver, ok := fmtr.(cmdfmt.RuntimeResolver)
+			require.True(t, ok, "external formatters should explain their runtime")
+
+			decision, err := resolver.ResolveRuntime(context.Background())
+			require.NoError(t, err, "resolving should succeed")
+			assert.Equal(t, tt.wantRuntime, decision.Runtime, "the formatter should use the resolved runtime")
+		})
+	}
+}
+
+func TestCacheKeyIncludesResolvedVersion(t *testing.T) {
+	key := func(version string) string {
+		fakePath(t, map[string]string{"fmtr": "echo fmtr " + version})
+
+		fmtr := cmdfmt.NewFormatter([]string{"format"},
+			cmdfmt.WithExecutable("fmtr"),
+			cmdfmt.WithVersionArgs([]string{"--version"}),
+			cmdfmt.WithDockerImageName("fmtr"),
+			cmdfmt.WithDockerImageTag("latest"),
+		)
+
+		keyer, ok := fmtr.(format.CacheKeyer)
+		require.True(t, ok, "external formatters should have a cache key")
+		return keyer.CacheKey(context.Background())
+	}
+
+	v1 := key("1.0.0")
+	assert.Contains(t, v1, "runtime=native", "the key should name the resolved runtime")
+	assert.NotEqual(t, v1, key("2.0.0"), "any native version matches latest, so the version should be part of the key")
+}
@@ -15,6 +15,7 @@ func NewDartCmdFormatter(opts ...cmdfmt.OptBasicExternalFormatterOptsSetter) for
 	startopts := []cmdfmt.OptBasicExternalFormatterOptsSetter{
 		cmdfmt.WithIndent("  "),
 		cmdfmt.WithExecutable("dart"),
+		cmdfmt.WithVersionArgs([]string{"--version"}),
 		cmdfmt.WithDockerImageName("dart"),
 		cmdfmt.WithDockerImageTag("stable"),
 	}
@@ -0,0 +1,145 @@
+package formatters_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/dockerfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/gofmt"
+	"github.com/walteh/retab/v2/pkg/formatters/hclfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/jsonfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/protofmt"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/tomlfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/yamlfmt"
+	"gitlab.com/tozd/go/errors"
+)
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider format.Provider
+		src      string
+		want     []format.Diagnostic
+	}{
+		{
+			name:     "hcl",
+			provider: hclfmt.NewFormatter(),
+			src:      "a {\n  b = 1 c = 2\n}\n",
+			want: []format.Diagnostic{{
+				Line: 2, Column: 9, EndLine: 2, EndColumn: 10, Severity: format.SeverityError, Provider: "hcl",
+				Message: "Missing newline after argument: An argument definition must end with a newline.",
+			}},
+		},
+		{
+			name:     "proto_reports_every_error",
+			provider: protofmt.NewFormatter(),
+			src:      "syntax = \"proto3\";\nmessage A {\n  int32 a = ;\n}\nmessage B {\n  int32 b = ;\n}\n",
+			want: []format.Diagnostic{
+				{Line: 3, Column: 13, EndLine: 3, EndColumn: 13, Severity: format.SeverityError, Provider: "proto", Message: "syntax error: unexpected ';', expecting int literal"},
+				{Line: 6, Column: 13, EndLine: 6, EndColumn: 13, Severity: format.SeverityError, Provider: "proto", Message: "syntax error: unexpected ';', expecting int literal"},
+			},
+		},
+		{
+			name:     "shell",
+			provider: shfmt.NewFormatter(),
+			src:      "if true; then\n  echo a\n",
+			want: []format.Diagnostic{{
+				Line: 1, Column: 1, EndLine: 1, EndColumn: 1, Severity: format.SeverityError, Provider: "shell",
+				Message: `if statement must end with "fi"`,
+			}},
+		},
+		{
+			name:     "go",
+			provider: gofmt.NewFormatter(),
+			src:      "package a\n\nfunc f() {\n\tx := \n}\n",
+			want: []format.Diagnostic{{
+				Line: 5, Column: 1, EndLine: 5, EndColumn: 1, Severity: format.SeverityError, Provider: "go",
+				Message: "expected operand, found '}'",
+			}},
+		},
+		{
+			name:     "yaml_points_at_the_line",
+			provider: yamlfmt.NewFormatter(),
+			src:      "a:\n  b: 1\n c: 2\n",
+			want: []format.Diagnostic{{
+				Line: 2, Column: 3, EndLine: 2, EndColumn: 3, Severity: format.SeverityError, Provider: "yaml",
+				Message: "did not find expected key",
+			}},
+		},
+		{
+			name:     "json",
+			provider: jsonfmt.NewFormatter(jsonfmt.DialectJSON),
+			src:      "{\n  \"a\": 1\n  \"b\": 2\n}\n",
+			want: []format.Diagnostic{{
+				Line: 3, Column: 3, EndLine: 3, EndColumn: 6, Severity: format.SeverityError, Provider: "json",
+				Message: `expected ',' or closing bracket, found "\"b\""`,
+			}},
+		},
+		{
+			name:     "toml",
+			provider: tomlfmt.NewFormatter(),
+			src:      "[a]\nb = [1, 2\nc = 3\n",
+			want: []format.Diagnostic{{
+				Line: 3, Column: 1, EndLine: 3, EndColumn: 2, Severity: format.SeverityError, Provider: "toml",
+				Message: `expected ',' or ']' in array, found "c"`,
+			}},
+		},
+		{
+			name:     "dockerfile",
+			provider: dockerfmt.NewFormatter(),
+			src:      "FROM alpine\nENV a\n",
+			want: []format.Diagnostic{{
+				Line: 2, Column: 1, EndLine: 2, EndColumn: 1, Severity: format.SeverityError, Provider: "dockerfile",
+				Message: "ENV must have two arguments",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(true).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+			cfg.EXPECT().Raw().Return(map[string]string{}).Maybe()
+
+			stdout := captureStdout(t)
+
+			_, err := tt.provider.Format(context.Background(), cfg, strings.NewReader(tt.src))
+			require.Error(t, err, "formatting a broken file should fail")
+
+			var diags format.Diagnostics
+			require.True(t, errors.As(err, &diags), "the error should carry diagnostics")
+			assert.Equal(t, format.Diagnostics(tt.want), diags, "the diagnostics should point at the errors")
+			assert.Empty(t, stdout(), "nothing should be written to stdout")
+		})
+	}
+}
+
+// captureStdout replaces os.Stdout until the returned func is called, which returns what was
+// written to it
+func captureStdout(t *testing.T) func() string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err, "creating a pipe should succeed")
+
+	orig := os.Stdout
+	os.Stdout = w
+	t.Cleanup(func() { os.Stdout = orig })
+
+	return func() string {
+		os.Stdout = orig
+		require.NoError(t, w.Close(), "closing the pipe should succeed")
+		out, err := io.ReadAll(r)
+		require.NoError(t, err, "reading the pipe should succeed")
+		return string(out)
+	}
+}
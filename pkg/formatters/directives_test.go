@@ -0,0 +1,94 @@
+package formatters_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/dockerfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/gofmt"
+	"github.com/walteh/retab/v2/pkg/formatters/hclfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/protofmt"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/yamlfmt"
+)
+
+func TestDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider format.Provider
+		useTabs  bool
+		src      string
+		want     string
+	}{
+		{
+			name:     "hcl",
+			provider: hclfmt.NewFormatter(),
+			useTabs:  true,
+			src:      "a {\n  // retab:off\n  x     =     1\n  yy  = [1,2]\n  # retab:on\n  z = 2\n}\n",
+			want:     "a {\n\t// retab:off\n  x     =     1\n  yy  = [1,2]\n\t# retab:on\n\tz = 2\n}\n",
+		},
+		{
+			name:     "proto",
+			provider: protofmt.NewFormatter(),
+			useTabs:  true,
+			src:      "syntax = \"proto3\";\n\nmessage A {\n  // retab:off\n  int32   a   = 1;\n  int32   bb  = 2;\n  // retab:on\n  int32 c = 3;\n}\n",
+			want:     "syntax = \"proto3\";\n\nmessage A {\n\t// retab:off\n  int32   a   = 1;\n  int32   bb  = 2;\n\t// retab:on\n\tint32 c = 3;\n}\n",
+		},
+		{
+			name:     "yaml_moves_the_region_with_its_block",
+			provider: yamlfmt.NewFormatter(),
+			src:      "a:\n  # retab:off\n  b:    1\n  c: |\n    x\n  # retab:on\n  d:   2\n",
+			want:     "a:\n    # retab:off\n    b:    1\n    c: |\n      x\n    # retab:on\n    d: 2\n",
+		},
+		{
+			name:     "yaml_ignores_a_block_scalar_header",
+			provider: yamlfmt.NewFormatter(),
+			src:      "steps:\n  # retab:ignore-next\n  run:   |\n    echo   a\n  b:   1\n",
+			want:     "steps:\n    # retab:ignore-next\n    run:   |\n        echo   a\n    b: 1\n",
+		},
+		{
+			name:     "shell_keeps_heredocs",
+			provider: shfmt.NewFormatter(),
+			useTabs:  true,
+			src:      "if true; then\n# retab:off\ncat <<EOF\nbody\nEOF\n# retab:on\n# retab:ignore-next\necho   a   |   \\\n  cat\necho   b\nfi\n",
+			want:     "if true; then\n\t# retab:off\ncat <<EOF\nbody\nEOF\n\t# retab:on\n\t# retab:ignore-next\necho   a   |   \\\n  cat\n\techo b\nfi\n",
+		},
+		{
+			name:     "dockerfile",
+			provider: dockerfmt.NewFormatter(),
+			useTabs:  true,
+			src:      "FROM alpine\n# retab:ignore-next\nRUN   echo   a\nRUN   echo   b\n",
+			want:     "FROM alpine\n# retab:ignore-next\nRUN   echo   a\nRUN echo b\n",
+		},
+		{
+			name:     "go",
+			provider: gofmt.NewFormatter(),
+			useTabs:  true,
+			src:      "package a\n\nfunc f() {\n// retab:off\nx :=   1\n    _ = x\n// retab:on\ny :=   2\n_ = y\n}\n",
+			want:     "package a\n\nfunc f() {\n\t// retab:off\nx :=   1\n    _ = x\n\t// retab:on\n\ty := 2\n\t_ = y\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(tt.useTabs).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+			cfg.EXPECT().Raw().Return(map[string]string{}).Maybe()
+
+			r, err := tt.provider.Format(context.Background(), cfg, strings.NewReader(tt.src))
+			require.NoError(t, err, "formatting should succeed")
+
+			got, err := io.ReadAll(r)
+			require.NoError(t, err, "reading the output should succeed")
+
+			diff.Require(t).Want(tt.want).Got(string(got)).Equals()
+		})
+	}
+}
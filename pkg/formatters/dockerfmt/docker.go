@@ -6,6 +6,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
 	"github.com/walteh/retab/v2/pkg/format"
 	"gitlab.com/tozd/go/errors"
 )
@@ -23,6 +24,11 @@ func NewFormatter() *Formatter {
 
 // Format parses and formats Dockerfile code.
 func (f *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	return format.HashDirectives.Format(ctx, cfg, read, f.formatDocument)
+}
+
+// formatDocument formats every instruction of the Dockerfile
+func (f *Formatter) formatDocument(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
 
 	idnt := "\t"
 	if !cfg.UseTabs() && cfg.IndentSize() > 0 {
@@ -44,11 +50,23 @@ func (f *Formatter) Format(ctx context.Context, cfg format.Configuration, read i
 	return bytes.NewReader([]byte(formattedContent)), nil
 }
 
-// getBoolOption is a helper function to check if a config option is true, with a default
-func getBoolOption(options map[string]string, name string, defaultValue bool) bool {
-	val, ok := options[name]
-	if !ok {
-		return defaultValue
+// diagnostic converts the errors of the buildkit parser that know the lines they are about, other
+// errors are returned as they are
+func diagnostic(err error) error {
+	var located *parser.ErrorLocation
+	if !errors.As(err, &located) || len(located.Locations) == 0 || len(located.Locations[0]) == 0 {
+		return err
 	}
-	return val == "true"
+	ranges := located.Locations[0]
+	start, end := ranges[0].Start, ranges[len(ranges)-1].End
+
+	return format.Diagnostics{{
+		Line:      max(start.Line, 1),
+		Column:    start.Character + 1,
+		EndLine:   max(end.Line, 1),
+		EndColumn: end.Character + 1,
+		Severity:  format.SeverityError,
+		Message:   errors.Unwrap(located).Error(),
+		Provider:  "dockerfile",
+	}}
 }
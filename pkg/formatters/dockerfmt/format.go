@@ -154,7 +154,7 @@ func FormatFileLines(fileLines io.Reader, c *Config) ([]byte, error) {
 
 	result, err := parser.Parse(bytes.NewReader(content))
 	if err != nil {
-		return nil, errors.Errorf("error parsing file: %v", err)
+		return nil, errors.Errorf("error parsing file: %w", diagnostic(err))
 	}
 
 	parseState := &ParseState{
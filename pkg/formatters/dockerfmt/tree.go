@@ -0,0 +1,51 @@
+package dockerfmt
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
+	"gitlab.com/tozd/go/errors"
+)
+
+var _ format.TreeProvider = (*Formatter)(nil)
+
+// Tree parses src with the buildkit parser. The commands of RUN and the heredocs are formatted as
+// shell, so they are compared by their shell tree when they parse, every other argument by its text.
+func (f *Formatter) Tree(ctx context.Context, cfg format.Configuration, src []byte) ([]format.Node, error) {
+	result, err := parser.Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, errors.Errorf("failed to parse Dockerfile: %w", diagnostic(err))
+	}
+
+	tree := &format.TreeBuilder{}
+	for _, child := range result.AST.Children {
+		tree.Enter("Instruction", strings.Join(append([]string{strings.ToLower(child.Value)}, child.Flags...), " "), child.StartLine)
+		shell := strings.EqualFold(child.Value, "run") && !child.Attributes["json"] && len(child.Heredocs) == 0
+		for next := child.Next; next != nil; next = next.Next {
+			f.shellLeaf(ctx, cfg, tree, "Argument", "", next.Value, shell, child.StartLine)
+		}
+		for _, heredoc := range child.Heredocs {
+			f.shellLeaf(ctx, cfg, tree, "Heredoc", heredoc.Name+" ", heredoc.Content, true, child.StartLine+1)
+		}
+		tree.Leave()
+	}
+
+	return tree.Nodes(), nil
+}
+
+// shellLeaf adds text to tree, as the tree of a shell script when shell is set and it parses
+func (f *Formatter) shellLeaf(ctx context.Context, cfg format.Configuration, tree *format.TreeBuilder, kind string, prefix string, text string, shell bool, line int) {
+	if shell {
+		if nodes, err := shfmt.NewFormatter().Tree(ctx, cfg, []byte(text)); err == nil {
+			tree.Enter(kind, prefix+"shell", line)
+			tree.Embed(nodes, line)
+			tree.Leave()
+			return
+		}
+	}
+	tree.Leaf(kind, prefix+text, line)
+}
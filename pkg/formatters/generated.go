@@ -0,0 +1,42 @@
+package formatters
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/go-enry/go-enry/v2"
+)
+
+// generatedHeader is the marker of https://go.dev/s/generatedcode, which other generators use in
+// the comments of other languages too
+var generatedHeader = regexp.MustCompile(`Code generated .* DO NOT EDIT\.`)
+
+// generatedMarker is the @generated tag of Meta's tools, not @generated in the middle of a word
+var generatedMarker = regexp.MustCompile(`(^|[^\w@])@generated\b`)
+
+// markerLines is how many lines at the top of a file are searched for a marker
+const markerLines = 10
+
+// Generated reports whether a file was generated, and why: a `Code generated ... DO NOT EDIT.`
+// header, an @generated marker near the top, or any of the paths and contents enry knows as
+// generated
+func Generated(filename string, content []byte) (string, bool) {
+	lines := bytes.SplitN(content, []byte("\n"), markerLines+1)
+	if len(lines) > markerLines {
+		lines = lines[:markerLines]
+	}
+	for _, line := range lines {
+		if generatedHeader.Match(line) {
+			return "generated: " + string(bytes.TrimSpace(line)), true
+		}
+		if generatedMarker.Match(line) {
+			return "generated: @generated marker", true
+		}
+	}
+
+	if enry.IsGenerated(filename, content) {
+		return "generated: detected by enry", true
+	}
+
+	return "", false
+}
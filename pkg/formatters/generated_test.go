@@ -0,0 +1,33 @@
+package formatters_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walteh/retab/v2/pkg/formatters"
+)
+
+func TestGenerated(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		reason   string
+	}{
+		{name: "go_header", filename: "mock.go", content: "// Code generated by mockery. DO NOT EDIT.\n\npackage x\n", reason: "generated: // Code generated by mockery. DO NOT EDIT."},
+		{name: "header_in_other_language", filename: "a.yaml", content: "# Code generated by gen. DO NOT EDIT.\na: 1\n", reason: "generated: # Code generated by gen. DO NOT EDIT."},
+		{name: "generated_marker", filename: "a.sh", content: "#!/bin/sh\n# @generated by tool\necho\n", reason: "generated: @generated marker"},
+		{name: "marker_in_a_word", filename: "a.sh", content: "# see foo@generated.example.com\necho\n"},
+		{name: "marker_too_far_down", filename: "a.hcl", content: "a = 1\n\n\n\n\n\n\n\n\n\n\n# @generated\n"},
+		{name: "enry", filename: "a.pb.go", content: "// Code generated by protoc-gen-go.\npackage x\n", reason: "generated: detected by enry"},
+		{name: "handwritten", filename: "main.go", content: "package main\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := formatters.Generated(tt.filename, []byte(tt.content))
+			assert.Equal(t, tt.reason != "", ok, "generated should match")
+			assert.Equal(t, tt.reason, reason, "reason should match")
+		})
+	}
+}
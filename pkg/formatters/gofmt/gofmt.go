@@ -6,6 +6,7 @@ import (
 	"io"
 
 	goformat "go/format"
+	"go/scanner"
 
 	"github.com/walteh/goimports-reviser/v3/reviser"
 	"github.com/walteh/retab/v2/pkg/format"
@@ -23,15 +24,35 @@ func NewFormatter() *Formatter {
 	return &Formatter{}
 }
 
+// Options are the editorconfig keys the go formatter reads
+var Options = format.RegisterOptions("go",
+	moduleNameOption,
+	renameImportsOption,
+	renameImportsSeparatorOption,
+	yesIWantSpacesOption,
+	justFormatOption,
+)
+
+var (
+	moduleNameOption             = &format.Option{Key: "go_module_name", Type: format.OptionTypeString, Doc: "the module whose imports are grouped last, as project imports"}
+	renameImportsOption          = &format.Option{Key: "go_rename_imports", Type: format.OptionTypeList, Doc: "imports to rename, as path=name pairs"}
+	renameImportsSeparatorOption = &format.Option{Key: "go_rename_imports_separator", Type: format.OptionTypeString, Default: "=", Doc: "the separator between path and name in go_rename_imports"}
+	yesIWantSpacesOption         = &format.Option{Key: "go_yes_i_want_spaces", Type: format.OptionTypeBool, Default: "false", Doc: "indent go with spaces when indent_style = space"}
+	justFormatOption             = &format.Option{Key: "go_just_format", Type: format.OptionTypeBool, Default: "false", Doc: "only run gofmt, without sorting imports"}
+)
+
 func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	return format.SlashDirectives.Format(ctx, cfg, read, me.formatDocument)
+}
 
-	raw := cfg.Raw()
+// formatDocument runs gofmt and the import reviser over the whole file
+func (me *Formatter) formatDocument(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
 
-	projectName := raw["go_module_name"]
-	importRenames := raw["go_rename_imports"]
-	renameImportsSeparator := raw["go_rename_imports_separator"]
-	yesIWantSpaces := raw["go_yes_i_want_spaces"]
-	justFormat := raw["go_just_format"]
+	projectName := moduleNameOption.String(cfg)
+	importRenames := renameImportsOption.List(cfg)
+	separator := renameImportsSeparatorOption.String(cfg)
+	yesIWantSpaces := yesIWantSpacesOption.Bool(cfg)
+	justFormat := justFormatOption.Bool(cfg)
 
 	reads, err := io.ReadAll(read)
 	if err != nil {
@@ -41,10 +62,10 @@ func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read
 	// fomrat with gofmt
 	formattedOutput, err := goformat.Source(reads)
 	if err != nil {
-		return nil, errors.Errorf("go format: %w", err)
+		return nil, errors.Errorf("go format: %w", diagnostics(reads, err))
 	}
 
-	if justFormat == "true" {
+	if justFormat {
 		return bytes.NewReader(formattedOutput), nil
 	}
 
@@ -67,18 +88,12 @@ func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read
 		reviser.WithSeparatedNamedImports,
 	}
 
-	if importRenames != "" {
-		separator := "="
-		if renameImportsSeparator != "" {
-			separator = renameImportsSeparator
-		}
-		for _, rename := range strings.Split(importRenames, ",") {
-			parts := strings.Split(rename, separator)
-			if len(parts) != 2 {
-				return nil, errors.Errorf("invalid rename: %s", rename)
-			}
-			opts = append(opts, reviser.WithRenameImport(parts[0], parts[1]))
+	for _, rename := range importRenames {
+		parts := strings.Split(rename, separator)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid rename: %s", rename)
 		}
+		opts = append(opts, reviser.WithRenameImport(parts[0], parts[1]))
 	}
 
 	formattedOutput, originalContent, changed, err := reviser.NewSourceFile(projectName, "").Fix(opts...)
@@ -86,7 +101,7 @@ func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read
 		return nil, errors.Errorf("go revise imports: %w", err)
 	}
 
-	if !cfg.UseTabs() && yesIWantSpaces == "true" {
+	if !cfg.UseTabs() && yesIWantSpaces {
 		// I really didn't want to do this, because really this formatter is for the imports,
 		// and not the code. But I'll give the world the benefit of the doubt and assume that someone
 		// has a good enough reason for using spaces in go as I have for using tabs in protobuf.
@@ -104,3 +119,16 @@ func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read
 	return bytes.NewReader(formattedOutput), nil
 
 }
+
+// diagnostics converts the syntax errors of the go parser, other errors are returned as they are
+func diagnostics(src []byte, err error) error {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return err
+	}
+	out := format.Diagnostics{}
+	for _, e := range list {
+		out = append(out, format.NewDiagnostic("go", src, e.Pos.Offset, e.Pos.Offset, e.Msg))
+	}
+	return out
+}
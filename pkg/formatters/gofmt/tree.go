@@ -0,0 +1,92 @@
+package gofmt
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"slices"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+var _ format.TreeProvider = (*Formatter)(nil)
+
+// Tree parses src with go/parser. The imports come first as a sorted list, since the formatter
+// sorts and groups them.
+func (me *Formatter) Tree(ctx context.Context, cfg format.Configuration, src []byte) ([]format.Node, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, errors.Errorf("parsing go: %w", diagnostics(src, err))
+	}
+
+	tree := &format.TreeBuilder{}
+
+	imports := []string{}
+	for _, spec := range file.Imports {
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name + " "
+		}
+		imports = append(imports, name+spec.Path.Value)
+	}
+	slices.Sort(imports)
+	for _, imp := range imports {
+		tree.Leaf("ImportSpec", imp, 0)
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		if node == nil {
+			tree.Leave()
+			return true
+		}
+		if decl, ok := node.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			return false
+		}
+		tree.Enter(strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."), nodeText(node), fset.Position(node.Pos()).Line)
+		return true
+	})
+
+	return tree.Nodes(), nil
+}
+
+// nodeText is what a node holds besides its children: names, literal values and operators
+func nodeText(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.Ident:
+		return node.Name
+	case *ast.BasicLit:
+		// gofmt rewrites 0X1 as 0x1, the value stays the same
+		return constant.MakeFromLiteral(node.Value, node.Kind, 0).ExactString()
+	case *ast.BinaryExpr:
+		return node.Op.String()
+	case *ast.UnaryExpr:
+		return node.Op.String()
+	case *ast.AssignStmt:
+		return node.Tok.String()
+	case *ast.IncDecStmt:
+		return node.Tok.String()
+	case *ast.BranchStmt:
+		return node.Tok.String()
+	case *ast.GenDecl:
+		return node.Tok.String()
+	case *ast.RangeStmt:
+		return node.Tok.String()
+	case *ast.ChanType:
+		return fmt.Sprint(node.Dir)
+	case *ast.SliceExpr:
+		if node.Slice3 {
+			return "3"
+		}
+	case *ast.TypeSpec:
+		if node.Assign.IsValid() {
+			return "="
+		}
+	}
+	return ""
+}
@@ -0,0 +1,260 @@
+package hclfmt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/rs/zerolog"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// heredocAttributes are the languages of heredocs assigned to well known attributes, attributes
+// ending in _policy hold json as well
+var heredocAttributes = map[string]string{
+	"user_data":             "sh",
+	"script":                "sh",
+	"command":               "sh",
+	"policy":                "json",
+	"container_definitions": "json",
+	"values":                "yaml",
+}
+
+const templatePlaceholder = "__retab_template_%d__"
+
+// formatHeredocs rewrites the heredocs of already formatted hcl. Heredocs with a language are
+// formatted with its provider and the bodies of <<- heredocs are indented one level deeper than
+// the line that opens them, which does not change their value because hcl strips the common
+// indentation of flush heredocs.
+func (me *Formatter) formatHeredocs(ctx context.Context, cfg format.Configuration, src []byte) []byte {
+	tokens, diags := hclsyntax.LexConfig(src, "", hcl.Pos{Byte: 0, Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return src
+	}
+
+	var out bytes.Buffer
+	last := 0
+	attribute := ""
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Type == hclsyntax.TokenIdent && i+1 < len(tokens) && tokens[i+1].Type == hclsyntax.TokenEqual {
+			attribute = string(tokens[i].Bytes)
+		}
+		if tokens[i].Type != hclsyntax.TokenOHeredoc {
+			continue
+		}
+
+		// heredocs can nest inside template interpolations, find the one that closes this one
+		end, depth := i+1, 0
+		for ; end < len(tokens); end++ {
+			if tokens[end].Type == hclsyntax.TokenOHeredoc {
+				depth++
+			} else if tokens[end].Type == hclsyntax.TokenCHeredoc {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+		if end == len(tokens) {
+			break
+		}
+
+		out.Write(src[last:tokens[i].Range.End.Byte])
+		out.WriteString(me.heredoc(ctx, cfg, src, tokens[i:end+1], attribute))
+		last = tokens[end].Range.End.Byte
+		i = end
+	}
+	out.Write(src[last:])
+
+	return out.Bytes()
+}
+
+// heredoc returns the new body and closing delimiter of the heredoc made of tokens
+func (me *Formatter) heredoc(ctx context.Context, cfg format.Configuration, src []byte, tokens hclsyntax.Tokens, attribute string) string {
+	open, closing := tokens[0], tokens[len(tokens)-1]
+	base := open.Range.End.Byte
+	original := string(src[base:closing.Range.End.Byte])
+
+	flush := bytes.HasPrefix(open.Bytes, []byte("<<-"))
+	delimiter := strings.TrimSpace(strings.TrimLeft(string(open.Bytes), "<-"))
+
+	body := string(src[base:closing.Range.Start.Byte])
+	if body == "" || strings.Contains(body, "__retab_template_") {
+		return original
+	}
+
+	// template sequences are swapped for placeholders so the body reads as plain code
+	sequences := templateSequences(tokens[1 : len(tokens)-1])
+	templates := make([]string, len(sequences))
+	for n := len(sequences) - 1; n >= 0; n-- {
+		start, end := sequences[n].Start.Byte-base, sequences[n].End.Byte-base
+		templates[n] = body[start:end]
+		body = body[:start] + fmt.Sprintf(templatePlaceholder, n) + body[end:]
+	}
+
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if flush {
+		lines = dedent(lines)
+	}
+
+	restore := func(lines []string) (string, bool) {
+		text := strings.Join(lines, "\n") + "\n"
+		for n, template := range templates {
+			placeholder := fmt.Sprintf(templatePlaceholder, n)
+			if strings.Count(text, placeholder) != 1 {
+				return "", false
+			}
+			text = strings.Replace(text, placeholder, template, 1)
+		}
+		return text, true
+	}
+
+	formatted, ok := me.formatHeredocBody(ctx, cfg, delimiter, attribute, lines, open.Range.Start.Line)
+	if ok {
+		if _, ok = restore(formatted); ok {
+			lines = formatted
+		} else {
+			zerolog.Ctx(ctx).Warn().Int("line", open.Range.Start.Line).Msg("leaving heredoc unformatted, formatting moved its template sequences")
+		}
+	}
+	if !ok && !flush {
+		return original
+	}
+
+	closer := string(closing.Bytes)
+	if flush {
+		indent := lineIndent(src, open.Range.Start.Byte)
+		unit := "\t"
+		if !cfg.UseTabs() {
+			unit = strings.Repeat(" ", cfg.IndentSize())
+		}
+		for i, line := range lines {
+			if strings.TrimSpace(line) != "" {
+				lines[i] = indent + unit + line
+			} else {
+				lines[i] = ""
+			}
+		}
+		closer = indent + strings.TrimSpace(closer)
+	}
+
+	text, ok := restore(lines)
+	if !ok {
+		return original
+	}
+
+	return text + closer
+}
+
+// formatHeredocBody formats the lines of a heredoc with the provider for the language named by its
+// delimiter, its shebang or its attribute, in that order
+func (me *Formatter) formatHeredocBody(ctx context.Context, cfg format.Configuration, delimiter string, attribute string, lines []string, line int) ([]string, bool) {
+	if me.lookup == nil {
+		return nil, false
+	}
+
+	candidates := []string{strings.ToLower(delimiter)}
+	if strings.HasPrefix(lines[0], "#cloud-config") {
+		candidates = append(candidates, "yaml")
+	}
+	candidates = append(candidates, format.Shebang([]byte(lines[0])))
+	explicit := len(candidates)
+	if lang, ok := heredocAttributes[attribute]; ok {
+		candidates = append(candidates, lang)
+	} else if strings.HasSuffix(attribute, "_policy") {
+		candidates = append(candidates, "json")
+	}
+
+	for i, lang := range candidates {
+		if lang == "" {
+			continue
+		}
+		provider, ok := me.lookup.GetFormatterByLangID(ctx, lang)
+		if !ok {
+			continue
+		}
+
+		logger := zerolog.Ctx(ctx).With().Str("language", lang).Int("line", line).Logger()
+
+		r, err := provider.Format(ctx, cfg, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+		if err == nil {
+			var formatted []byte
+			formatted, err = io.ReadAll(r)
+			if err == nil {
+				return strings.Split(strings.TrimRight(string(formatted), "\n"), "\n"), true
+			}
+		}
+
+		// a language guessed from the attribute name is often wrong, so that is not worth a warning
+		if i < explicit {
+			logger.Warn().Err(err).Msg("leaving heredoc unformatted")
+		} else {
+			logger.Debug().Err(err).Msg("leaving heredoc unformatted")
+		}
+		return nil, false
+	}
+
+	return nil, false
+}
+
+// templateSequences returns the ranges of the outermost ${...} and %{...} sequences in tokens
+func templateSequences(tokens hclsyntax.Tokens) []hcl.Range {
+	ranges := []hcl.Range{}
+	depth := 0
+	var start hcl.Pos
+	for _, tok := range tokens {
+		switch tok.Type {
+		case hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			if depth == 0 {
+				start = tok.Range.Start
+			}
+			depth++
+		case hclsyntax.TokenTemplateSeqEnd:
+			depth--
+			if depth == 0 {
+				ranges = append(ranges, hcl.Range{Start: start, End: tok.Range.End})
+			}
+		}
+	}
+	return ranges
+}
+
+// dedent removes the leading whitespace all non-blank lines share, counted in characters like hcl
+// does for flush heredocs
+func dedent(lines []string) []string {
+	common := -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+		if trimmed == "" {
+			continue
+		}
+		if n := utf8.RuneCountInString(line[:len(line)-len(trimmed)]); common < 0 || n < common {
+			common = n
+		}
+	}
+
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		out[i] = string([]rune(line)[common:])
+	}
+	return out
+}
+
+// lineIndent returns the whitespace that starts the line holding offset
+func lineIndent(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
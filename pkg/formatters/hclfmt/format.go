@@ -3,7 +3,6 @@ package hclfmt
 import (
 	"context"
 	"io"
-	"os"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
@@ -124,19 +123,36 @@ func FormatBytes(cfg format.Configuration, src []byte) (io.Reader, error) {
 	return r, nil
 }
 
-// checkErrors takes in the contents of a hcl file and looks for syntaxterrors.
-func checkErrors(ctx context.Context, contents []byte, fle string) error {
+// checkErrors parses contents and returns its syntax errors as diagnostics, warnings are only logged
+func checkErrors(ctx context.Context, contents []byte) error {
 	parser := hclparse.NewParser()
-	_, diags := parser.ParseHCL(contents, fle)
-	diagWriter := hcl.NewDiagnosticTextWriter(os.Stdout, parser.Files(), 0, true)
-	defer func() {
-		err := diagWriter.WriteDiagnostics(diags)
-		if err != nil {
-			zerolog.Ctx(ctx).Error().Err(err).Msgf("Error writing diagnostics for %s", fle)
-		}
-	}()
+	_, diags := parser.ParseHCL(contents, "")
 	if diags.HasErrors() {
-		return diags
+		return diagnostics(contents, diags)
+	}
+	for _, diag := range diagnostics(contents, diags) {
+		zerolog.Ctx(ctx).Warn().Str("diagnostic", diag.String()).Msg("hcl warning")
 	}
 	return nil
 }
+
+// diagnostics converts hcl diagnostics, whose positions are in src
+func diagnostics(src []byte, diags hcl.Diagnostics) format.Diagnostics {
+	out := format.Diagnostics{}
+	for _, diag := range diags {
+		start, end := 0, 0
+		if diag.Subject != nil {
+			start, end = diag.Subject.Start.Byte, diag.Subject.End.Byte
+		}
+		message := diag.Summary
+		if diag.Detail != "" {
+			message += ": " + diag.Detail
+		}
+		converted := format.NewDiagnostic("hcl", src, start, end, message)
+		if diag.Severity == hcl.DiagWarning {
+			converted.Severity = format.SeverityWarning
+		}
+		out = append(out, converted)
+	}
+	return out
+}
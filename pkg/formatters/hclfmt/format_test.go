@@ -1,12 +1,18 @@
 package hclfmt_test
 
 import (
+	"context"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
 	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
 	"github.com/walteh/retab/v2/pkg/formatters/hclfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/jsonfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
 )
 
 func TestFormat(t *testing.T) {
@@ -158,3 +164,154 @@ variable "DESTDIR1" {
 		})
 	}
 }
+
+type lookup map[string]format.Provider
+
+func (me lookup) GetFormatterByLangID(ctx context.Context, lang string) (format.Provider, bool) {
+	provider, ok := me[lang]
+	return provider, ok
+}
+
+func TestFormatHeredocs(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "user_data_is_formatted_as_shell",
+			src: `resource "aws_instance" "x" {
+  user_data = <<-EOT
+      if [ -f x ]; then
+      echo   ${var.name}
+      fi
+  EOT
+}
+`,
+			expected: `resource "aws_instance" "x" {
+	user_data = <<-EOT
+		if [ -f x ]; then
+			echo ${var.name}
+		fi
+	EOT
+}
+`,
+		},
+		{
+			name: "shebang_and_delimiter_name_the_language",
+			src: `a = <<EOT
+#!/usr/bin/env bash
+echo   "hi"
+EOT
+b = <<JSON
+{"a":1}
+JSON
+`,
+			expected: `a = <<EOT
+#!/usr/bin/env bash
+echo "hi"
+EOT
+b = <<JSON
+{
+	"a": 1
+}
+JSON
+`,
+		},
+		{
+			name: "policy_with_templates",
+			src: `policy = <<EOF
+{"Resource": "${aws_s3_bucket.x.arn}/*", "Effect": "Allow"}
+EOF
+`,
+			expected: `policy = <<EOF
+{
+	"Resource": "${aws_s3_bucket.x.arn}/*",
+	"Effect": "Allow"
+}
+EOF
+`,
+		},
+		{
+			name: "unknown_and_invalid_heredocs_are_kept",
+			src: `other = <<EOT
+keep   this
+EOT
+policy = <<EOT
+{"a":
+EOT
+`,
+			expected: `other  = <<EOT
+keep   this
+EOT
+policy = <<EOT
+{"a":
+EOT
+`,
+		},
+		{
+			name: "flush_heredocs_are_reindented",
+			src: `locals {
+  text = <<-EOT
+          keep   this
+            and this
+
+          EOT
+}
+`,
+			expected: `locals {
+	text = <<-EOT
+		keep   this
+		  and this
+
+	EOT
+}
+`,
+		},
+		{
+			name: "jsonencode_arguments",
+			src: `policy = jsonencode({
+Version = "2012-10-17"
+Statement = [{Effect = "Allow"}]
+})
+`,
+			expected: `policy = jsonencode({
+	Version = "2012-10-17"
+	Statement = [
+		{
+			Effect = "Allow"
+		},
+	]
+})
+`,
+		},
+	}
+
+	formatter := hclfmt.NewFormatterWithLookup(lookup{
+		"sh":   shfmt.NewFormatter(),
+		"bash": shfmt.NewFormatter(),
+		"json": jsonfmt.NewFormatter(jsonfmt.DialectJSON),
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := format.NewBasicConfigurationProvider(true, 4)
+
+			result, err := formatter.Format(t.Context(), cfg, strings.NewReader(tt.src))
+			require.NoError(t, err, "formatting should succeed")
+
+			formatted, err := io.ReadAll(result)
+			require.NoError(t, err, "reading the result should succeed")
+
+			diff.Require(t).Want(tt.expected).Got(string(formatted)).Equals()
+
+			again, err := formatter.Format(t.Context(), cfg, strings.NewReader(string(formatted)))
+			require.NoError(t, err, "formatting the output should succeed")
+
+			againFormatted, err := io.ReadAll(again)
+			require.NoError(t, err, "reading the result should succeed")
+
+			diff.Require(t).Want(string(formatted)).Got(string(againFormatted)).Equals()
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package hclfmt
 
 import (
+	"bytes"
 	"context"
 	"io"
 
@@ -8,22 +9,38 @@ import (
 )
 
 type Formatter struct {
+	// lookup finds the provider for the language of a heredoc, heredocs are only re-indented without it
+	lookup format.ProviderLookup
 }
 
 var _ format.Provider = (*Formatter)(nil)
 
+// directives are written in # and // comments, like the comments of hcl
+var directives = format.NewDirectives("#", "//")
+
 func NewFormatter() *Formatter {
 	return &Formatter{}
 }
 
+// NewFormatterWithLookup returns a formatter that also formats heredocs whose delimiter, attribute
+// or shebang names a language with a provider
+func NewFormatterWithLookup(lookup format.ProviderLookup) *Formatter {
+	return &Formatter{lookup: lookup}
+}
+
 func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	return directives.Format(ctx, cfg, read, me.formatDocument)
+}
+
+// formatDocument checks and formats the whole file, heredocs included
+func (me *Formatter) formatDocument(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
 
 	reads, err := io.ReadAll(read)
 	if err != nil {
 		return nil, err
 	}
 
-	err = checkErrors(ctx, reads, "")
+	err = checkErrors(ctx, reads)
 	if err != nil {
 		return nil, err
 	}
@@ -33,5 +50,10 @@ func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read
 		return nil, err
 	}
 
-	return newContents, nil
+	formatted, err := io.ReadAll(newContents)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(me.formatHeredocs(ctx, cfg, formatted)), nil
 }
@@ -70,6 +70,11 @@ func injectNewlinesAndTrailingCommas(nativeTokens hclsyntax.Tokens) hclsyntax.To
 			{
 				injectline()
 			}
+		case (prev.Type == hclsyntax.TokenCBrack || prev.Type == hclsyntax.TokenCBrace) && (nt.Type == hclsyntax.TokenCParen || nt.Type == hclsyntax.TokenComma):
+			{
+				// keep the closing paren of calls like jsonencode({...}) and the comma after a list
+				// element on the bracket's line
+			}
 		case (prev.Type == hclsyntax.TokenCBrack || prev.Type == hclsyntax.TokenCBrace || prev.Type == hclsyntax.TokenOBrace || prev.Type == hclsyntax.TokenOBrack) && nt.Type != hclsyntax.TokenNewline:
 			{
 				injectline()
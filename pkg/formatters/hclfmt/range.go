@@ -0,0 +1,85 @@
+package hclfmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+var _ format.RangeProvider = (*Formatter)(nil)
+
+// FormatRanges formats the file and keeps the changes to the top level groups of attributes and
+// blocks that overlap the ranges. A group ends at a blank line outside of any brackets, so the
+// attributes that are aligned together are formatted together.
+func (me *Formatter) FormatRanges(ctx context.Context, cfg format.Configuration, input []byte, ranges []format.LineRange) ([]format.Edit, error) {
+	r, err := me.Format(ctx, cfg, bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return format.UnitEdits(input, formatted, units(input), units(formatted), ranges), nil
+}
+
+// units returns the line ranges of the top level groups of src
+func units(src []byte) []format.LineRange {
+	nativeTokens, _ := hclsyntax.LexConfig(src, "", hcl.Pos{Byte: 0, Line: 1, Column: 1})
+
+	units := []format.LineRange{}
+	depth, line, start, end := 0, 1, 0, 0
+	for _, fl := range linesForFormat(writerTokens(nativeTokens), false) {
+		cells := []Tokens{fl.lead, fl.assign, fl.comment}
+
+		newlines, blank := 0, true
+		for _, cell := range cells {
+			for _, tok := range cell {
+				// heredocs and multi-line comments keep their newlines inside the tokens
+				newlines += bytes.Count(tok.Bytes, []byte("\n"))
+				depth += tokenBracketChange(tok)
+				if tok.Type != hclsyntax.TokenNewline {
+					blank = false
+				}
+			}
+		}
+
+		if blank {
+			if start > 0 && depth <= 0 {
+				units = append(units, format.LineRange{Start: start, End: end})
+				start = 0
+			}
+		} else {
+			if start == 0 {
+				start = line
+			}
+			end = line + newlines
+			if newlines > 0 && tokenIsNewline(lastToken(cells)) {
+				end--
+			}
+		}
+
+		line += newlines
+	}
+
+	if start > 0 {
+		units = append(units, format.LineRange{Start: start, End: end})
+	}
+
+	return units
+}
+
+func lastToken(cells []Tokens) *Token {
+	for i := len(cells) - 1; i >= 0; i-- {
+		if len(cells[i]) > 0 {
+			return cells[i][len(cells[i])-1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package hclfmt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/hclfmt"
+)
+
+func TestFormatRanges(t *testing.T) {
+	src := `a = 1
+bb = 2
+
+block "one" {
+  x = 1
+  yy = [1,
+2]
+}
+
+block "two" {
+  x = 1
+}
+`
+
+	tests := []struct {
+		name   string
+		ranges []format.LineRange
+		want   string
+	}{
+		{
+			name:   "attribute_formats_its_group",
+			ranges: []format.LineRange{{Start: 1, End: 1}},
+			want: `a  = 1
+bb = 2
+
+block "one" {
+  x = 1
+  yy = [1,
+2]
+}
+
+block "two" {
+  x = 1
+}
+`,
+		},
+		{
+			name:   "line_in_block_formats_the_block",
+			ranges: []format.LineRange{{Start: 7, End: 7}},
+			want: `a = 1
+bb = 2
+
+block "one" {
+	x = 1
+	yy = [
+		1,
+		2,
+	]
+}
+
+block "two" {
+  x = 1
+}
+`,
+		},
+		{
+			name:   "blank_line_between_blocks",
+			ranges: []format.LineRange{{Start: 9, End: 9}},
+			want:   src,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(true).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+
+			edits, err := hclfmt.NewFormatter().FormatRanges(context.Background(), cfg, []byte(src), tt.ranges)
+			require.NoError(t, err, "formatting ranges should succeed")
+
+			diff.Require(t).Want(tt.want).Got(string(format.ApplyEdits([]byte(src), edits))).Equals()
+		})
+	}
+}
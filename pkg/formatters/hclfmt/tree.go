@@ -0,0 +1,146 @@
+package hclfmt
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var _ format.TreeProvider = (*Formatter)(nil)
+
+// operations names the operators of binary and unary expressions, which are only pointers
+var operations = map[*hclsyntax.Operation]string{
+	hclsyntax.OpLogicalOr:          "||",
+	hclsyntax.OpLogicalAnd:         "&&",
+	hclsyntax.OpLogicalNot:         "!",
+	hclsyntax.OpEqual:              "==",
+	hclsyntax.OpNotEqual:           "!=",
+	hclsyntax.OpGreaterThan:        ">",
+	hclsyntax.OpGreaterThanOrEqual: ">=",
+	hclsyntax.OpLessThan:           "<",
+	hclsyntax.OpLessThanOrEqual:    "<=",
+	hclsyntax.OpAdd:                "+",
+	hclsyntax.OpSubtract:           "-",
+	hclsyntax.OpMultiply:           "*",
+	hclsyntax.OpDivide:             "/",
+	hclsyntax.OpModulo:             "%",
+	hclsyntax.OpNegate:             "-",
+}
+
+// Tree parses src with hclsyntax. The attributes of a body are sorted by name, hcl keeps them in
+// a map.
+func (me *Formatter) Tree(ctx context.Context, cfg format.Configuration, src []byte) ([]format.Node, error) {
+	file, diags := hclsyntax.ParseConfig(src, "", hcl.Pos{Byte: 0, Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diagnostics(src, diags)
+	}
+
+	tree := &format.TreeBuilder{}
+	walkBody(tree, file.Body.(*hclsyntax.Body))
+
+	return tree.Nodes(), nil
+}
+
+func walkBody(tree *format.TreeBuilder, body *hclsyntax.Body) {
+	for _, name := range slices.Sorted(maps.Keys(body.Attributes)) {
+		attr := body.Attributes[name]
+		tree.Enter("Attribute", name, attr.SrcRange.Start.Line)
+		hclsyntax.Walk(attr.Expr, &treeWalker{tree: tree})
+		tree.Leave()
+	}
+	for _, block := range body.Blocks {
+		tree.Enter("Block", strings.Join(append([]string{block.Type}, block.Labels...), " "), block.TypeRange.Start.Line)
+		walkBody(tree, block.Body)
+		tree.Leave()
+	}
+}
+
+// treeWalker adds the nodes of an expression
+type treeWalker struct {
+	tree *format.TreeBuilder
+	// multiline counts the templates around the node that span lines, heredocs are re-indented
+	multiline int
+}
+
+func (me *treeWalker) Enter(node hclsyntax.Node) hcl.Diagnostics {
+	me.tree.Enter(strings.TrimPrefix(fmt.Sprintf("%T", node), "*hclsyntax."), me.text(node), node.Range().Start.Line)
+	if multiline(node) {
+		me.multiline++
+	}
+	return nil
+}
+
+func (me *treeWalker) Exit(node hclsyntax.Node) hcl.Diagnostics {
+	if multiline(node) {
+		me.multiline--
+	}
+	me.tree.Leave()
+	return nil
+}
+
+func multiline(node hclsyntax.Node) bool {
+	template, ok := node.(*hclsyntax.TemplateExpr)
+	return ok && template.SrcRange.Start.Line != template.SrcRange.End.Line
+}
+
+// text is what an expression holds besides its children: names, values and operators
+func (me *treeWalker) text(node hclsyntax.Node) string {
+	switch node := node.(type) {
+	case *hclsyntax.LiteralValueExpr:
+		if node.Val.Type() == cty.String && node.Val.IsKnown() && !node.Val.IsNull() {
+			if me.multiline > 0 {
+				return strings.Join(strings.Fields(node.Val.AsString()), "")
+			}
+			return node.Val.AsString()
+		}
+		return node.Val.GoString()
+	case *hclsyntax.ScopeTraversalExpr:
+		return traversalText(node.Traversal)
+	case *hclsyntax.RelativeTraversalExpr:
+		return traversalText(node.Traversal)
+	case *hclsyntax.FunctionCallExpr:
+		if node.ExpandFinal {
+			return node.Name + "..."
+		}
+		return node.Name
+	case *hclsyntax.BinaryOpExpr:
+		return operations[node.Op]
+	case *hclsyntax.UnaryOpExpr:
+		return operations[node.Op]
+	case *hclsyntax.ForExpr:
+		text := node.KeyVar + "," + node.ValVar
+		if node.Group {
+			text += "..."
+		}
+		return text
+	case *hclsyntax.ObjectConsKeyExpr:
+		if node.ForceNonLiteral {
+			return "()"
+		}
+	}
+	return ""
+}
+
+func traversalText(traversal hcl.Traversal) string {
+	parts := []string{}
+	for _, step := range traversal {
+		switch step := step.(type) {
+		case hcl.TraverseRoot:
+			parts = append(parts, step.Name)
+		case hcl.TraverseAttr:
+			parts = append(parts, step.Name)
+		case hcl.TraverseIndex:
+			parts = append(parts, "["+step.Key.GoString()+"]")
+		case hcl.TraverseSplat:
+			parts = append(parts, "*")
+		}
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,101 @@
+package jsonfmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Dialect decides which syntax is accepted and kept: comments are allowed in jsonc and json5,
+// trailing commas are kept in jsonc and json5 and json5 also allows its relaxed keys, strings and numbers
+type Dialect string
+
+const (
+	DialectJSON  Dialect = "json"
+	DialectJSONC Dialect = "jsonc"
+	DialectJSON5 Dialect = "json5"
+)
+
+const defaultMaxLineLength = 80
+
+type Formatter struct {
+	dialect Dialect
+}
+
+var _ format.Provider = (*Formatter)(nil)
+
+func NewFormatter(dialect Dialect) *Formatter {
+	return &Formatter{dialect: dialect}
+}
+
+func (me *Formatter) Targets() []string {
+	switch me.dialect {
+	case DialectJSONC:
+		return []string{"*.jsonc", "tsconfig.json", "tsconfig.*.json", "jsconfig.json", ".vscode/*.json"}
+	case DialectJSON5:
+		return []string{"*.json5"}
+	default:
+		return []string{"*.json"}
+	}
+}
+
+type options struct {
+	sortKeys       bool
+	collapseArrays bool
+	// maxLineLength limits collapsed arrays, zero means no limit
+	maxLineLength int
+}
+
+// Options are the editorconfig keys the json, jsonc and json5 formatters read
+var Options = format.RegisterOptions("json",
+	sortKeysOption,
+	collapseArraysOption,
+	maxLineLengthOption,
+)
+
+var (
+	sortKeysOption       = &format.Option{Key: "json_sort_keys", Type: format.OptionTypeBool, Default: "false", Doc: "sort object keys"}
+	collapseArraysOption = &format.Option{Key: "json_collapse_arrays", Type: format.OptionTypeBool, Default: "false", Doc: "keep short arrays of plain values on one line"}
+	maxLineLengthOption  = &format.Option{Key: "max_line_length", Type: format.OptionTypeInt, Default: strconv.Itoa(defaultMaxLineLength), Values: []string{"off"}, Doc: "the longest line a collapsed array may make, off for no limit"}
+)
+
+func getOptions(cfg format.Configuration) *options {
+	return &options{
+		sortKeys:       sortKeysOption.Bool(cfg),
+		collapseArrays: collapseArraysOption.Bool(cfg),
+		maxLineLength:  maxLineLengthOption.Int(cfg),
+	}
+}
+
+func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	src, err := io.ReadAll(read)
+	if err != nil {
+		return nil, errors.Errorf("reading json: %w", err)
+	}
+
+	opts := getOptions(cfg)
+
+	doc, err := parse(me.dialect, strings.TrimPrefix(string(src), "\uFEFF"))
+	if err != nil {
+		return nil, errors.Errorf("parsing %s: %w", me.dialect, err)
+	}
+
+	p := &printer{
+		dialect:     me.dialect,
+		opts:        opts,
+		indent:      strings.Repeat(" ", cfg.IndentSize()),
+		indentWidth: cfg.IndentSize(),
+	}
+	if cfg.UseTabs() {
+		p.indent = "\t"
+	}
+
+	p.document(doc)
+
+	return bytes.NewReader(p.buf.Bytes()), nil
+}
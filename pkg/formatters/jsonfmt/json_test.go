@@ -0,0 +1,224 @@
+package jsonfmt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/jsonfmt"
+)
+
+func formatJSON(ctx context.Context, dialect jsonfmt.Dialect, cfg format.Configuration, src string) (string, error) {
+	reader, err := jsonfmt.NewFormatter(dialect).Format(ctx, cfg, bytes.NewReader([]byte(src)))
+	if err != nil {
+		return "", err
+	}
+
+	result, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  jsonfmt.Dialect
+		useTabs  bool
+		indent   int
+		raw      map[string]string
+		src      string
+		expected string
+	}{
+		{
+			name:    "tabs",
+			dialect: jsonfmt.DialectJSON,
+			useTabs: true,
+			indent:  4,
+			src:     `{"a":1,"b":{"c":[true,null,"x"]},"d":[],"e":{}}`,
+			expected: `{
+	"a": 1,
+	"b": {
+		"c": [
+			true,
+			null,
+			"x"
+		]
+	},
+	"d": [],
+	"e": {}
+}
+`,
+		},
+		{
+			name:    "spaces",
+			dialect: jsonfmt.DialectJSON,
+			useTabs: false,
+			indent:  2,
+			src:     "{\n\t\"a\": [1.5e3, -2]\n}",
+			expected: `{
+  "a": [
+    1.5e3,
+    -2
+  ]
+}
+`,
+		},
+		{
+			name:    "blank_lines_are_kept_once",
+			dialect: jsonfmt.DialectJSON,
+			useTabs: true,
+			indent:  4,
+			src:     "{\"a\": 1,\n\n\n\"b\": 2}",
+			expected: `{
+	"a": 1,
+
+	"b": 2
+}
+`,
+		},
+		{
+			name:     "json_drops_trailing_commas",
+			dialect:  jsonfmt.DialectJSON,
+			useTabs:  true,
+			indent:   4,
+			src:      `[1, 2,]`,
+			expected: "[\n\t1,\n\t2\n]\n",
+		},
+		{
+			name:    "jsonc_keeps_comments_and_trailing_commas",
+			dialect: jsonfmt.DialectJSONC,
+			useTabs: true,
+			indent:  4,
+			src: `// settings
+{
+  // the first
+  "a": 1, // inline
+  "b": [1, 2,],
+  /* at the end */
+}`,
+			expected: `// settings
+{
+	// the first
+	"a": 1, // inline
+	"b": [
+		1,
+		2,
+	],
+	/* at the end */
+}
+`,
+		},
+		{
+			name:    "json5_syntax_is_kept_verbatim",
+			dialect: jsonfmt.DialectJSON5,
+			useTabs: true,
+			indent:  4,
+			src:     `{unquoted: 'single', hex: 0xFF, half: .5, big: +Infinity,}`,
+			expected: `{
+	unquoted: 'single',
+	hex: 0xFF,
+	half: .5,
+	big: +Infinity,
+}
+`,
+		},
+		{
+			name:    "sort_keys",
+			dialect: jsonfmt.DialectJSONC,
+			useTabs: true,
+			indent:  4,
+			raw:     map[string]string{"json_sort_keys": "true"},
+			src: `{
+	"b": 1,
+	// about a
+	"a": {"z": 1, "y": 2}
+}`,
+			expected: `{
+	// about a
+	"a": {
+		"y": 2,
+		"z": 1
+	},
+	"b": 1
+}
+`,
+		},
+		{
+			name:    "collapse_short_arrays",
+			dialect: jsonfmt.DialectJSON,
+			useTabs: false,
+			indent:  2,
+			raw:     map[string]string{"json_collapse_arrays": "true", "max_line_length": "24"},
+			src:     `{"short": [1, 2, 3], "long": ["aaaaaa", "bbbbbb"], "nested": [[1], {"a": 1}]}`,
+			expected: `{
+  "short": [1, 2, 3],
+  "long": [
+    "aaaaaa",
+    "bbbbbb"
+  ],
+  "nested": [
+    [1],
+    {
+      "a": 1
+    }
+  ]
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := map[string]string{}
+			for k, v := range tt.raw {
+				raw[k] = v
+			}
+
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(tt.useTabs).Maybe()
+			cfg.EXPECT().IndentSize().Return(tt.indent).Maybe()
+			cfg.EXPECT().Raw().Return(raw).Maybe()
+
+			formatted, err := formatJSON(t.Context(), tt.dialect, cfg, tt.src)
+			require.NoError(t, err, "formatting should succeed")
+
+			diff.Require(t).Want(tt.expected).Got(formatted).Equals()
+
+			again, err := formatJSON(t.Context(), tt.dialect, cfg, formatted)
+			require.NoError(t, err, "formatting the output should succeed")
+			diff.Require(t).Want(formatted).Got(again).Equals()
+		})
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect jsonfmt.Dialect
+		src     string
+	}{
+		{name: "comment_in_json", dialect: jsonfmt.DialectJSON, src: "{\n// no\n}"},
+		{name: "single_quotes_in_jsonc", dialect: jsonfmt.DialectJSONC, src: `{"a": 'b'}`},
+		{name: "unquoted_key_in_json", dialect: jsonfmt.DialectJSON, src: `{a: 1}`},
+		{name: "missing_comma", dialect: jsonfmt.DialectJSON5, src: `[1 2]`},
+		{name: "unterminated_object", dialect: jsonfmt.DialectJSONC, src: `{"a": 1`},
+		{name: "invalid_number", dialect: jsonfmt.DialectJSON, src: `[01]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := format.NewBasicConfigurationProvider(true, 4)
+
+			_, err := formatJSON(t.Context(), tt.dialect, cfg, tt.src)
+			require.Error(t, err, "formatting invalid %s should fail", tt.dialect)
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package jsonfmt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenBeginObject
+	tokenEndObject
+	tokenBeginArray
+	tokenEndArray
+	tokenColon
+	tokenComma
+	tokenString
+	tokenLiteral
+	tokenComment
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+	// pos is the offset of the token in the source
+	pos int
+	// newlines counts the line breaks between the previous token and this one
+	newlines int
+}
+
+type lexer struct {
+	dialect Dialect
+	src     string
+	pos     int
+	line    int
+}
+
+// errorf is an error at the position of the lexer
+func (me *lexer) errorf(message string, args ...any) error {
+	return me.errorAt(me.pos, me.pos, message, args...)
+}
+
+// errorAt is an error about the bytes start to end of the source
+func (me *lexer) errorAt(start int, end int, message string, args ...any) error {
+	return format.Diagnostics{format.NewDiagnostic(string(me.dialect), []byte(me.src), start, end, fmt.Sprintf(message, args...))}
+}
+
+func (me *lexer) next() (*token, error) {
+	newlines := 0
+	for me.pos < len(me.src) {
+		c := me.src[me.pos]
+		if c == '\n' {
+			newlines++
+			me.line++
+		} else if c != ' ' && c != '\t' && c != '\r' {
+			break
+		}
+		me.pos++
+	}
+
+	tok := &token{line: me.line, pos: me.pos, newlines: newlines}
+
+	if me.pos >= len(me.src) {
+		tok.kind = tokenEOF
+		return tok, nil
+	}
+
+	start := me.pos
+	switch c := me.src[me.pos]; c {
+	case '{':
+		tok.kind = tokenBeginObject
+		me.pos++
+	case '}':
+		tok.kind = tokenEndObject
+		me.pos++
+	case '[':
+		tok.kind = tokenBeginArray
+		me.pos++
+	case ']':
+		tok.kind = tokenEndArray
+		me.pos++
+	case ':':
+		tok.kind = tokenColon
+		me.pos++
+	case ',':
+		tok.kind = tokenComma
+		me.pos++
+	case '"', '\'':
+		if c == '\'' && me.dialect != DialectJSON5 {
+			return nil, me.errorf("single quoted strings are only allowed in json5")
+		}
+		if err := me.string(c); err != nil {
+			return nil, err
+		}
+		tok.kind = tokenString
+	case '/':
+		if err := me.comment(); err != nil {
+			return nil, err
+		}
+		if me.dialect == DialectJSON {
+			return nil, me.errorAt(start, me.pos, "comments are not allowed in json, use a .jsonc file")
+		}
+		tok.kind = tokenComment
+	default:
+		for me.pos < len(me.src) && !strings.ContainsRune(" \t\r\n{}[]:,\"'/", rune(me.src[me.pos])) {
+			me.pos++
+		}
+		if me.pos == start {
+			return nil, me.errorf("unexpected character %q", me.src[me.pos])
+		}
+		tok.kind = tokenLiteral
+	}
+
+	tok.text = me.src[start:me.pos]
+
+	return tok, nil
+}
+
+func (me *lexer) string(quote byte) error {
+	me.pos++
+	for me.pos < len(me.src) {
+		switch me.src[me.pos] {
+		case quote:
+			me.pos++
+			return nil
+		case '\\':
+			me.pos++
+			if me.pos < len(me.src) && me.src[me.pos] == '\n' {
+				if me.dialect != DialectJSON5 {
+					return me.errorf("line continuations are only allowed in json5 strings")
+				}
+				me.line++
+			}
+		case '\n':
+			return me.errorf("unterminated string")
+		}
+		me.pos++
+	}
+	return me.errorf("unterminated string")
+}
+
+func (me *lexer) comment() error {
+	if strings.HasPrefix(me.src[me.pos:], "//") {
+		end := strings.IndexByte(me.src[me.pos:], '\n')
+		if end < 0 {
+			end = len(me.src) - me.pos
+		}
+		me.pos += end
+		return nil
+	}
+
+	if strings.HasPrefix(me.src[me.pos:], "/*") {
+		end := strings.Index(me.src[me.pos+2:], "*/")
+		if end < 0 {
+			return me.errorf("unterminated block comment")
+		}
+		body := me.src[me.pos : me.pos+2+end+2]
+		me.line += strings.Count(body, "\n")
+		me.pos += len(body)
+		return nil
+	}
+
+	return me.errorf("unexpected character '/'")
+}
+
+type nodeKind int
+
+const (
+	nodeScalar nodeKind = iota
+	nodeObject
+	nodeArray
+)
+
+type node struct {
+	kind nodeKind
+	// text is the source text of a scalar, kept verbatim
+	text    string
+	members []*member
+	// trailingComma is set when the last member was followed by a comma
+	trailingComma bool
+	// dangling are comments after the last member, before the closing bracket
+	dangling []string
+}
+
+// member is an object member or an array element, with the comments attached to it
+type member struct {
+	key         string
+	value       *node
+	leading     []string
+	trailing    []string
+	blankBefore bool
+}
+
+type document struct {
+	leading []string
+	value   *node
+	// inline are comments on the line the value ends on
+	inline   []string
+	trailing []string
+}
+
+var (
+	jsonNumber  = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+	json5Number = regexp.MustCompile(`^[+-]?((0[xX][0-9a-fA-F]+)|(([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?)|Infinity|NaN)$`)
+	json5Ident  = regexp.MustCompile(`^[\p{L}$_][\p{L}\p{N}$_]*$`)
+)
+
+type parser struct {
+	lex *lexer
+	tok *token
+}
+
+func parse(dialect Dialect, src string) (*document, error) {
+	me := &parser{lex: &lexer{dialect: dialect, src: src, line: 1}}
+	if err := me.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &document{}
+
+	var err error
+	if doc.leading, err = me.comments(false); err != nil {
+		return nil, err
+	}
+
+	if me.tok.kind == tokenEOF {
+		return doc, nil
+	}
+
+	value, err := me.value()
+	if err != nil {
+		return nil, err
+	}
+	doc.value = value
+
+	if doc.inline, err = me.comments(true); err != nil {
+		return nil, err
+	}
+
+	if doc.trailing, err = me.comments(false); err != nil {
+		return nil, err
+	}
+
+	if me.tok.kind != tokenEOF {
+		return nil, me.errorf("unexpected %q after the top level value", me.tok.text)
+	}
+
+	return doc, nil
+}
+
+// errorf is an error about the current token
+func (me *parser) errorf(message string, args ...any) error {
+	return me.lex.errorAt(me.tok.pos, me.tok.pos+len(me.tok.text), message, args...)
+}
+
+func (me *parser) advance() error {
+	tok, err := me.lex.next()
+	if err != nil {
+		return err
+	}
+	me.tok = tok
+	return nil
+}
+
+// comments consumes comment tokens, with sameLine only those on the line of the previous token
+func (me *parser) comments(sameLine bool) ([]string, error) {
+	var comments []string
+	for me.tok.kind == tokenComment && (!sameLine || me.tok.newlines == 0) {
+		comments = append(comments, me.tok.text)
+		if err := me.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return comments, nil
+}
+
+func (me *parser) value() (*node, error) {
+	switch me.tok.kind {
+	case tokenBeginObject:
+		return me.container(tokenEndObject, nodeObject)
+	case tokenBeginArray:
+		return me.container(tokenEndArray, nodeArray)
+	case tokenString:
+		n := &node{kind: nodeScalar, text: me.tok.text}
+		return n, me.advance()
+	case tokenLiteral:
+		if !me.validLiteral(me.tok.text) {
+			return nil, me.errorf("invalid value %q", me.tok.text)
+		}
+		n := &node{kind: nodeScalar, text: me.tok.text}
+		return n, me.advance()
+	default:
+		return nil, me.unexpected()
+	}
+}
+
+func (me *parser) validLiteral(text string) bool {
+	switch text {
+	case "true", "false", "null":
+		return true
+	}
+	if me.lex.dialect == DialectJSON5 {
+		return json5Number.MatchString(text)
+	}
+	return jsonNumber.MatchString(text)
+}
+
+func (me *parser) unexpected() error {
+	if me.tok.kind == tokenEOF {
+		return me.errorf("unexpected end of input")
+	}
+	return me.errorf("unexpected %q", me.tok.text)
+}
+
+func (me *parser) container(end tokenKind, kind nodeKind) (*node, error) {
+	n := &node{kind: kind}
+
+	if err := me.advance(); err != nil {
+		return nil, err
+	}
+
+	for {
+		m := &member{blankBefore: me.tok.newlines > 1}
+
+		var err error
+		if m.leading, err = me.comments(false); err != nil {
+			return nil, err
+		}
+
+		if me.tok.kind == end {
+			n.dangling = m.leading
+			return n, me.advance()
+		}
+
+		if len(n.members) > 0 && !n.trailingComma {
+			return nil, me.errorf("expected ',' or closing bracket, found %q", me.tok.text)
+		}
+		n.trailingComma = false
+
+		if len(m.leading) > 0 && me.tok.newlines > 1 && !m.blankBefore {
+			// the blank line sits between the comments and the member, keep it above the comments
+			m.blankBefore = true
+		}
+
+		if kind == nodeObject {
+			if err := me.key(m); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := me.value()
+		if err != nil {
+			return nil, err
+		}
+		m.value = value
+
+		if m.trailing, err = me.comments(true); err != nil {
+			return nil, err
+		}
+
+		if me.tok.kind == tokenComma {
+			n.trailingComma = true
+			if err := me.advance(); err != nil {
+				return nil, err
+			}
+			after, err := me.comments(true)
+			if err != nil {
+				return nil, err
+			}
+			m.trailing = append(m.trailing, after...)
+		}
+
+		n.members = append(n.members, m)
+	}
+}
+
+func (me *parser) key(m *member) error {
+	switch me.tok.kind {
+	case tokenString:
+	case tokenLiteral:
+		if me.lex.dialect != DialectJSON5 || !json5Ident.MatchString(me.tok.text) {
+			return me.errorf("object keys must be strings, found %q", me.tok.text)
+		}
+	default:
+		return me.unexpected()
+	}
+	m.key = me.tok.text
+
+	if err := me.advance(); err != nil {
+		return err
+	}
+	// comments between the key and the value are moved above the member
+	if err := me.leadingComments(m); err != nil {
+		return err
+	}
+
+	if me.tok.kind != tokenColon {
+		return me.errorf("expected ':' after key %s, found %q", m.key, me.tok.text)
+	}
+	if err := me.advance(); err != nil {
+		return err
+	}
+	return me.leadingComments(m)
+}
+
+func (me *parser) leadingComments(m *member) error {
+	comments, err := me.comments(false)
+	if err != nil {
+		return err
+	}
+	m.leading = append(m.leading, comments...)
+	return nil
+}
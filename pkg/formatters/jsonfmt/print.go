@@ -0,0 +1,153 @@
+package jsonfmt
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+type printer struct {
+	buf     bytes.Buffer
+	dialect Dialect
+	opts    *options
+	indent  string
+	// indentWidth is the width of one indent level when measuring lines, tabs count as the indent size
+	indentWidth int
+}
+
+func (me *printer) document(doc *document) {
+	for _, c := range doc.leading {
+		me.comment(0, c)
+	}
+
+	if doc.value == nil {
+		return
+	}
+
+	me.value(doc.value, 0, 0)
+	me.inline(doc.inline)
+	me.buf.WriteByte('\n')
+
+	for _, c := range doc.trailing {
+		me.comment(0, c)
+	}
+}
+
+func (me *printer) writeIndent(depth int) {
+	for range depth {
+		me.buf.WriteString(me.indent)
+	}
+}
+
+func (me *printer) comment(depth int, c string) {
+	me.writeIndent(depth)
+	me.buf.WriteString(strings.TrimRight(c, " \t"))
+	me.buf.WriteByte('\n')
+}
+
+func (me *printer) inline(comments []string) {
+	for _, c := range comments {
+		me.buf.WriteByte(' ')
+		me.buf.WriteString(strings.TrimRight(c, " \t"))
+	}
+}
+
+// value writes n, column is where it starts on the current line
+func (me *printer) value(n *node, depth int, column int) {
+	if n.kind == nodeScalar {
+		me.buf.WriteString(n.text)
+		return
+	}
+
+	open, close := "{", "}"
+	if n.kind == nodeArray {
+		open, close = "[", "]"
+	}
+
+	if len(n.members) == 0 && len(n.dangling) == 0 {
+		me.buf.WriteString(open + close)
+		return
+	}
+
+	if inline, ok := me.collapse(n); ok {
+		// the comma that may follow the array counts towards the line length
+		if me.opts.maxLineLength == 0 || column+len(inline)+1 <= me.opts.maxLineLength {
+			me.buf.WriteString(inline)
+			return
+		}
+	}
+
+	members := n.members
+	if n.kind == nodeObject && me.opts.sortKeys {
+		members = slices.Clone(members)
+		slices.SortStableFunc(members, func(a, b *member) int {
+			return strings.Compare(unquote(a.key), unquote(b.key))
+		})
+	}
+
+	me.buf.WriteString(open)
+	me.buf.WriteByte('\n')
+
+	for i, m := range members {
+		// blank lines lose their meaning once keys are reordered
+		if i > 0 && m.blankBefore && !(n.kind == nodeObject && me.opts.sortKeys) {
+			me.buf.WriteByte('\n')
+		}
+
+		for _, c := range m.leading {
+			me.comment(depth+1, c)
+		}
+
+		me.writeIndent(depth + 1)
+		column := (depth + 1) * me.indentWidth
+		if n.kind == nodeObject {
+			me.buf.WriteString(m.key)
+			me.buf.WriteString(": ")
+			column += len(m.key) + 2
+		}
+
+		me.value(m.value, depth+1, column)
+
+		if i < len(members)-1 || me.keepTrailingComma(n) {
+			me.buf.WriteByte(',')
+		}
+
+		me.inline(m.trailing)
+		me.buf.WriteByte('\n')
+	}
+
+	for _, c := range n.dangling {
+		me.comment(depth+1, c)
+	}
+
+	me.writeIndent(depth)
+	me.buf.WriteString(close)
+}
+
+func (me *printer) keepTrailingComma(n *node) bool {
+	return n.trailingComma && me.dialect != DialectJSON
+}
+
+// collapse returns the single line form of a short array, when json_collapse_arrays allows it
+func (me *printer) collapse(n *node) (string, bool) {
+	if !me.opts.collapseArrays || n.kind != nodeArray || len(n.dangling) > 0 {
+		return "", false
+	}
+
+	values := make([]string, 0, len(n.members))
+	for _, m := range n.members {
+		if m.value.kind != nodeScalar || len(m.leading) > 0 || len(m.trailing) > 0 {
+			return "", false
+		}
+		values = append(values, m.value.text)
+	}
+
+	return "[" + strings.Join(values, ", ") + "]", true
+}
+
+func unquote(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
@@ -0,0 +1,351 @@
+package mdfmt
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	atxHeading     = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	listItem       = regexp.MustCompile(`^([ \t]*)([*+-]|[0-9]{1,9}[.)])([ \t]+|$)`)
+	bulletMarker   = regexp.MustCompile(`^([ \t]*)[*+-]([ \t]+)`)
+	thematicBreak  = regexp.MustCompile(`^ {0,3}((\*[ \t]*){3,}|(_[ \t]*){3,}|(-[ \t]*){3,})$`)
+	tableDelimiter = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+
+	strongUnderscore = regexp.MustCompile(`(^|[^\w_])__([^_\s](?:[^_]*[^_\s])?)__([^\w_]|$)`)
+	emphasisStar     = regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*]*[^*\s])?)\*([^\w*]|$)`)
+)
+
+// normalizeLine rewrites headings to the atx form with one space, thematic breaks to '---' and
+// emphasis to _em_ and **strong**. afterBlank tells whether the line starts a block.
+func normalizeLine(line string, afterBlank bool) string {
+	if thematicBreak.MatchString(line) {
+		// after a paragraph line '---' would turn the paragraph into a heading
+		if afterBlank {
+			return "---"
+		}
+		return line
+	}
+
+	if m := atxHeading.FindStringSubmatch(line); m != nil {
+		if m[2] == "" {
+			return m[1]
+		}
+		return m[1] + " " + normalizeEmphasis(m[2])
+	}
+
+	return normalizeEmphasis(line)
+}
+
+// bullets picks the marker of every bullet item. Lists become '-' lists, except where that would
+// join two adjacent lists: a list that follows another one at the same indent with a different
+// marker is a separate list, so one of the two keeps its marker.
+type bullets struct {
+	runs []bulletRun
+}
+
+// bulletRun is the list of the last bullet item at an indent
+type bulletRun struct {
+	indent   string
+	original byte
+	marker   byte
+}
+
+// reset forgets the lists, the line ended them
+func (me *bullets) reset() {
+	me.runs = nil
+}
+
+// rewrite returns lines[i] with the marker of its list
+func (me *bullets) rewrite(lines []string, i int) string {
+	line := lines[i]
+	if thematicBreak.MatchString(line) {
+		me.reset()
+		return line
+	}
+
+	m := listItem.FindStringSubmatch(line)
+	if m == nil {
+		return line
+	}
+	indent, original := m[1], m[2][0]
+
+	// an item ends the lists nested deeper than it
+	var prev *bulletRun
+	for len(me.runs) > 0 {
+		last := me.runs[len(me.runs)-1]
+		if len(last.indent) < len(indent) {
+			break
+		}
+		me.runs = me.runs[:len(me.runs)-1]
+		if last.indent == indent {
+			prev = &last
+			break
+		}
+	}
+
+	// ordered and empty items end the bullet list at their indent
+	if !bulletMarker.MatchString(line) {
+		return line
+	}
+
+	run := bulletRun{indent: indent, original: original}
+	switch {
+	case prev != nil && prev.original == original:
+		run.marker = prev.marker
+	case original == '-':
+		run.marker = '-'
+	case prev != nil && prev.marker == '-', nextList(lines, i, indent, original) == '-':
+		run.marker = original
+	default:
+		run.marker = '-'
+	}
+	me.runs = append(me.runs, run)
+
+	return bulletMarker.ReplaceAllString(line, "${1}"+string(run.marker)+"$2")
+}
+
+// nextList returns the marker of the list that directly follows the item at lines[i], or 0 when
+// something else comes first
+func nextList(lines []string, i int, indent string, marker byte) byte {
+	for _, line := range lines[i+1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if thematicBreak.MatchString(line) {
+			return 0
+		}
+
+		m := listItem.FindStringSubmatch(line)
+		switch {
+		case m == nil && startsIndented(line), m != nil && len(m[1]) > len(indent):
+			continue
+		case m == nil, len(m[1]) < len(indent), !bulletMarker.MatchString(line):
+			return 0
+		case m[2][0] != marker:
+			return m[2][0]
+		}
+	}
+	return 0
+}
+
+// isParagraph reports whether a line is plain text that a setext underline turns into a heading
+func isParagraph(line string) bool {
+	return !isIndentedCode(line) &&
+		!atxHeading.MatchString(line) &&
+		!listItem.MatchString(line) &&
+		!thematicBreak.MatchString(line) &&
+		!strings.HasPrefix(strings.TrimSpace(line), ">") &&
+		!strings.HasPrefix(strings.TrimSpace(line), "<")
+}
+
+// normalizeEmphasis uses _ for emphasis and ** for strong emphasis, outside of code spans
+func normalizeEmphasis(line string) string {
+	return mapOutsideCode(line, func(text string) string {
+		// the patterns share their boundary characters, so run them until nothing changes
+		for {
+			next := strongUnderscore.ReplaceAllString(text, "$1**$2**$3")
+			next = emphasisStar.ReplaceAllString(next, "${1}_${2}_${3}")
+			if next == text {
+				return text
+			}
+			text = next
+		}
+	})
+}
+
+// mapOutsideCode applies fn to the parts of line that are not inside `code spans`
+func mapOutsideCode(line string, fn func(string) string) string {
+	var sb strings.Builder
+
+	rest := line
+	for {
+		start := strings.IndexByte(rest, '`')
+		if start < 0 {
+			break
+		}
+		ticks := backtickRun(rest[start:])
+		end := closingBackticks(rest[start+ticks:], ticks)
+		if end < 0 {
+			break
+		}
+		end += start + 2*ticks
+
+		sb.WriteString(fn(rest[:start]))
+		sb.WriteString(rest[start:end])
+		rest = rest[end:]
+	}
+	sb.WriteString(fn(rest))
+
+	return sb.String()
+}
+
+func backtickRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] == '`' {
+		n++
+	}
+	return n
+}
+
+// closingBackticks finds the run of exactly n backticks that closes a code span
+func closingBackticks(s string, n int) int {
+	for i := 0; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		run := backtickRun(s[i:])
+		if run == n {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
+
+func isTableRow(line string) bool {
+	return strings.TrimSpace(line) != "" && len(splitCells(line)) > 1 || strings.HasPrefix(strings.TrimSpace(line), "|")
+}
+
+func isTableDelimiter(line string) bool {
+	return strings.Contains(line, "-") && tableDelimiter.MatchString(line)
+}
+
+// splitCells splits a table row on the pipes that are not escaped or inside code spans
+func splitCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	cells := []string{}
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '`':
+			ticks := backtickRun(line[i:])
+			if end := closingBackticks(line[i+ticks:], ticks); end >= 0 {
+				i += end + 2*ticks - 1
+			} else {
+				i += ticks - 1
+			}
+		case '|':
+			cells = append(cells, strings.TrimSpace(line[start:i]))
+			start = i + 1
+		}
+	}
+	cells = append(cells, strings.TrimSpace(line[start:]))
+
+	return cells
+}
+
+type alignment int
+
+const (
+	alignNone alignment = iota
+	alignLeft
+	alignCenter
+	alignRight
+)
+
+// formatTable pads every cell to the width of its column, lines[1] is the delimiter row
+func formatTable(lines []string) []string {
+	header := splitCells(lines[0])
+
+	aligns := []alignment{}
+	for _, cell := range splitCells(lines[1]) {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			aligns = append(aligns, alignCenter)
+		case right:
+			aligns = append(aligns, alignRight)
+		case left:
+			aligns = append(aligns, alignLeft)
+		default:
+			aligns = append(aligns, alignNone)
+		}
+	}
+
+	rows := [][]string{header}
+	for _, line := range lines[2:] {
+		rows = append(rows, splitCells(line))
+	}
+
+	columns := len(header)
+	for i, row := range rows {
+		for j := range row {
+			row[j] = normalizeEmphasis(row[j])
+		}
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+	for len(aligns) < columns {
+		aligns = append(aligns, alignNone)
+	}
+
+	widths := make([]int, columns)
+	for j := range widths {
+		widths[j] = 3
+		for _, row := range rows {
+			if j < len(row) {
+				widths[j] = max(widths[j], utf8.RuneCountInString(row[j]))
+			}
+		}
+	}
+
+	out := []string{}
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			if j >= columns {
+				cells[j] = cell
+				continue
+			}
+			cells[j] = pad(cell, widths[j], aligns[j])
+		}
+		out = append(out, "| "+strings.Join(cells, " | ")+" |")
+
+		if i == 0 {
+			delims := make([]string, columns)
+			for j := range delims {
+				delims[j] = delimiter(widths[j], aligns[j])
+			}
+			out = append(out, "| "+strings.Join(delims, " | ")+" |")
+		}
+	}
+
+	return out
+}
+
+func pad(cell string, width int, align alignment) string {
+	missing := width - utf8.RuneCountInString(cell)
+	switch align {
+	case alignRight:
+		return strings.Repeat(" ", missing) + cell
+	case alignCenter:
+		return strings.Repeat(" ", missing/2) + cell + strings.Repeat(" ", missing-missing/2)
+	default:
+		return cell + strings.Repeat(" ", missing)
+	}
+}
+
+func delimiter(width int, align alignment) string {
+	switch align {
+	case alignLeft:
+		return ":" + strings.Repeat("-", width-1)
+	case alignRight:
+		return strings.Repeat("-", width-1) + ":"
+	case alignCenter:
+		return ":" + strings.Repeat("-", width-2) + ":"
+	default:
+		return strings.Repeat("-", width)
+	}
+}
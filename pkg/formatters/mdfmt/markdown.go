@@ -0,0 +1,218 @@
+package mdfmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+type Formatter struct {
+	// lookup finds the provider for the language of a fenced code block
+	lookup format.ProviderLookup
+}
+
+var _ format.Provider = (*Formatter)(nil)
+
+func NewFormatter(lookup format.ProviderLookup) *Formatter {
+	return &Formatter{lookup: lookup}
+}
+
+func (me *Formatter) Targets() []string {
+	return []string{"*.md", "*.markdown"}
+}
+
+var (
+	fenceOpen       = regexp.MustCompile("^([ \t]*)(`{3,}|~{3,})(.*)$")
+	setextUnderline = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+)
+
+func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	src, err := io.ReadAll(read)
+	if err != nil {
+		return nil, errors.Errorf("reading markdown: %w", err)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+
+	w := &writer{}
+
+	i := 0
+	if len(lines) > 0 && lines[0] == "---" {
+		// front matter is kept as it is
+		for end := 1; end < len(lines); end++ {
+			if lines[end] == "---" || lines[end] == "..." {
+				w.lines = append(w.lines, lines[:end+1]...)
+				i = end + 1
+				break
+			}
+		}
+	}
+
+	inList := false
+	list := &bullets{}
+	for i < len(lines) {
+		line := lines[i]
+
+		if m := fenceOpen.FindStringSubmatch(line); m != nil && !(m[2][0] == '`' && strings.Contains(m[3], "`")) {
+			i = me.fence(ctx, cfg, w, lines, i, m[1], m[2], m[3])
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			w.blank()
+			i++
+			continue
+		}
+
+		if !inList && isIndentedCode(line) && w.lastBlank() {
+			// an indented code block runs until the next line that is not indented
+			end := i
+			for j := i; j < len(lines) && (isIndentedCode(lines[j]) || strings.TrimSpace(lines[j]) == ""); j++ {
+				if strings.TrimSpace(lines[j]) != "" {
+					end = j + 1
+				}
+			}
+			w.lines = append(w.lines, lines[i:end]...)
+			i = end
+			continue
+		}
+
+		if i+1 < len(lines) && isTableRow(line) && isTableDelimiter(lines[i+1]) {
+			end := i + 2
+			for end < len(lines) && isTableRow(lines[end]) {
+				end++
+			}
+			w.lines = append(w.lines, formatTable(lines[i:end])...)
+			i = end
+			continue
+		}
+
+		if i+1 < len(lines) && w.lastBlank() && setextUnderline.MatchString(lines[i+1]) && isParagraph(line) {
+			level := "#"
+			if strings.TrimSpace(lines[i+1])[0] == '-' {
+				level = "##"
+			}
+			w.lines = append(w.lines, level+" "+normalizeEmphasis(strings.TrimSpace(line)))
+			i += 2
+			continue
+		}
+
+		if listItem.MatchString(line) {
+			inList = true
+		} else if !startsIndented(line) {
+			inList = false
+			list.reset()
+		}
+
+		w.lines = append(w.lines, normalizeLine(list.rewrite(lines, i), w.lastBlank()))
+		i++
+	}
+
+	for len(w.lines) > 0 && w.lastBlank() {
+		w.lines = w.lines[:len(w.lines)-1]
+	}
+	if len(w.lines) == 0 {
+		return bytes.NewReader(nil), nil
+	}
+
+	return strings.NewReader(strings.Join(w.lines, "\n") + "\n"), nil
+}
+
+// fence copies a fenced code block, formatting its content when the info string names a language
+// with a provider. It returns the index of the line after the block.
+func (me *Formatter) fence(ctx context.Context, cfg format.Configuration, w *writer, lines []string, start int, indent string, marker string, info string) int {
+	closing := regexp.MustCompile("^[ \t]*" + regexp.QuoteMeta(marker[:1]) + "{" + strconv.Itoa(len(marker)) + ",}[ \t]*$")
+
+	end := start + 1
+	for end < len(lines) && !closing.MatchString(lines[end]) {
+		end++
+	}
+
+	if end == len(lines) {
+		// an unclosed fence runs to the end of the document, leave it as it is
+		w.lines = append(w.lines, lines[start:]...)
+		return end
+	}
+
+	w.lines = append(w.lines, lines[start])
+	w.lines = append(w.lines, me.codeBlock(ctx, cfg, lines[start+1:end], indent, info, start+1)...)
+	w.lines = append(w.lines, lines[end])
+
+	return end + 1
+}
+
+func (me *Formatter) codeBlock(ctx context.Context, cfg format.Configuration, body []string, indent string, info string, line int) []string {
+	fields := strings.Fields(info)
+	if len(fields) == 0 || len(body) == 0 {
+		return body
+	}
+	lang := strings.ToLower(strings.Trim(fields[0], "{}."))
+
+	provider, ok := me.lookup.GetFormatterByLangID(ctx, lang)
+	if !ok {
+		return body
+	}
+
+	code := make([]string, len(body))
+	for i, l := range body {
+		code[i] = trimIndent(l, len(indent))
+	}
+
+	r, err := provider.Format(ctx, cfg, strings.NewReader(strings.Join(code, "\n")+"\n"))
+	if err == nil {
+		var formatted []byte
+		formatted, err = io.ReadAll(r)
+		if err == nil {
+			out := strings.Split(strings.TrimRight(string(formatted), "\n"), "\n")
+			for i, l := range out {
+				if l != "" {
+					out[i] = indent + l
+				}
+			}
+			return out
+		}
+	}
+
+	zerolog.Ctx(ctx).Warn().Err(err).Str("language", lang).Int("line", line).Msg("leaving code block unformatted")
+
+	return body
+}
+
+type writer struct {
+	lines []string
+}
+
+func (me *writer) lastBlank() bool {
+	return len(me.lines) == 0 || strings.TrimSpace(me.lines[len(me.lines)-1]) == ""
+}
+
+// blank adds a blank line, keeping at most one in a row and none at the start
+func (me *writer) blank() {
+	if !me.lastBlank() {
+		me.lines = append(me.lines, "")
+	}
+}
+
+func startsIndented(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
+
+func isIndentedCode(line string) bool {
+	return strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")
+}
+
+// trimIndent removes up to n leading spaces or tabs
+func trimIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return line[i:]
+}
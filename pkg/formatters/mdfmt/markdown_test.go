@@ -0,0 +1,159 @@
+package mdfmt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/jsonfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/mdfmt"
+)
+
+type lookup map[string]format.Provider
+
+func (me lookup) GetFormatterByLangID(ctx context.Context, lang string) (format.Provider, bool) {
+	provider, ok := me[lang]
+	return provider, ok
+}
+
+func formatMarkdown(ctx context.Context, src string) (string, error) {
+	formatter := mdfmt.NewFormatter(lookup{"json": jsonfmt.NewFormatter(jsonfmt.DialectJSON)})
+
+	reader, err := formatter.Format(ctx, format.NewBasicConfigurationProvider(true, 4), bytes.NewReader([]byte(src)))
+	if err != nil {
+		return "", err
+	}
+
+	result, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "headings",
+			src: `Title
+=====
+
+Section
+-------
+
+##   Spaced ##
+#hashtag
+`,
+			expected: `# Title
+
+## Section
+
+## Spaced
+#hashtag
+`,
+		},
+		{
+			name: "list_markers_and_breaks",
+			src: `* one
+* two
+  + nested
+1. first
+
+* * *
+`,
+			expected: `- one
+- two
+  - nested
+1. first
+
+---
+`,
+		},
+		{
+			name: "adjacent_lists_stay_apart",
+			src: `- a
+- b
+
+* c
+* d
+
++ e
+
+text
+
+* f
++ g
+- h
+`,
+			expected: `- a
+- b
+
+* c
+* d
+
+- e
+
+text
+
+- f
++ g
+- h
+`,
+		},
+		{
+			name:     "emphasis",
+			src:      "some *em* and __strong__ but not `*code*`, snake_case or 2*3*4\n",
+			expected: "some _em_ and **strong** but not `*code*`, snake_case or 2*3*4\n",
+		},
+		{
+			name: "tables",
+			src: `| a | long header | c |
+|:--|--:|:-:|
+| longer cell | x | *y* |
+| z |
+`,
+			expected: `| a           | long header |  c  |
+| :---------- | ----------: | :-: |
+| longer cell |           x | _y_ |
+| z           |             |     |
+`,
+		},
+		{
+			name:     "fenced_blocks_are_formatted",
+			src:      "text\n\n```json\n{\"a\":[1,2]}\n```\n\n- item\n  ```json title=x\n  {\"b\":true}\n  ```\n",
+			expected: "text\n\n```json\n{\n\t\"a\": [\n\t\t1,\n\t\t2\n\t]\n}\n```\n\n- item\n  ```json title=x\n  {\n  \t\"b\": true\n  }\n  ```\n",
+		},
+		{
+			name:     "invalid_and_unknown_blocks_are_kept",
+			src:      "```json\n{\"a\":\n```\n\n~~~unknown\n*  keep   *\n~~~\n\n```\n__raw__\n```\n",
+			expected: "```json\n{\"a\":\n```\n\n~~~unknown\n*  keep   *\n~~~\n\n```\n__raw__\n```\n",
+		},
+		{
+			name:     "front_matter_and_indented_code_are_kept",
+			src:      "---\ntitle: *x*\n---\n\n    * code *\n    __x__\n\n\n\ntext\n",
+			expected: "---\ntitle: *x*\n---\n\n    * code *\n    __x__\n\ntext\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted, err := formatMarkdown(t.Context(), tt.src)
+			require.NoError(t, err, "formatting should succeed")
+
+			diff.Require(t).Want(tt.expected).Got(formatted).Equals()
+
+			again, err := formatMarkdown(t.Context(), formatted)
+			require.NoError(t, err, "formatting the output should succeed")
+			diff.Require(t).Want(formatted).Got(again).Equals()
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package formatters
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/editorconfig"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// OptionWarning is an .editorconfig setting that is likely a mistake: a key that no formatter of its
+// section reads, or a value the formatter cannot read
+type OptionWarning struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	File    string `json:"file"`
+	Section string `json:"section"`
+	Message string `json:"message"`
+}
+
+func (me *OptionWarning) String() string {
+	return fmt.Sprintf("%s [%s] %s = %s: %s", me.File, me.Section, me.Key, me.Value, me.Message)
+}
+
+// CheckOptions validates the settings that apply to a file formatted with detection. Values are
+// checked against the editorconfig options and the options of the detected provider. A key is
+// unknown when it is read by none of the providers whose globs the section targets, so a [*]
+// section may hold the keys of any provider but [*.json] only those of the json formatter.
+func CheckOptions(detection *Detection, sources []*editorconfig.KeySource) []*OptionWarning {
+	warnings := []*OptionWarning{}
+
+	for _, src := range sources {
+		warn := func(message string) {
+			warnings = append(warnings, &OptionWarning{Key: src.Key, Value: src.Value, File: src.File, Section: src.Section, Message: message})
+		}
+
+		opt, ok := format.EditorconfigOptions.Lookup(src.Key)
+		if !ok && detection.Config.Options != nil {
+			opt, ok = detection.Config.Options.Lookup(src.Key)
+		}
+		if ok {
+			if err := opt.Validate(src.Value); err != nil {
+				warn(err.Error())
+			}
+			continue
+		}
+
+		if readByTargets(src.Section, src.Key) {
+			continue
+		}
+
+		message := "unknown option, no formatter for this section reads it"
+		if suggestion := closestKey(src.Key, detection.Config.Options); suggestion != "" {
+			message += fmt.Sprintf(", did you mean %s?", suggestion)
+		}
+		warn(message)
+	}
+
+	return warnings
+}
+
+// readByTargets reports whether a provider whose globs the section targets reads key
+func readByTargets(section string, key string) bool {
+	for _, config := range languageConfigs {
+		if config.Options == nil {
+			continue
+		}
+		if _, ok := config.Options.Lookup(key); !ok {
+			continue
+		}
+		for _, sample := range config.samples() {
+			if ok, err := editorconfig.SectionMatches(section, sample); err == nil && ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var braces = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// samples returns a file name for every alternative of the filename globs, with each wildcard
+// standing for an x, they are what sections are matched against to tell which languages they target
+func (me *LanguageConfig) samples() []string {
+	names := []string{}
+	for _, glob := range me.FilenameGlobs {
+		expanded := []string{glob}
+		for slices.ContainsFunc(expanded, func(s string) bool { return braces.MatchString(s) }) {
+			next := []string{}
+			for _, s := range expanded {
+				loc := braces.FindStringSubmatchIndex(s)
+				if loc == nil {
+					next = append(next, s)
+					continue
+				}
+				for _, alt := range strings.Split(s[loc[2]:loc[3]], ",") {
+					next = append(next, s[:loc[0]]+alt+s[loc[1]:])
+				}
+			}
+			expanded = next
+		}
+		for _, name := range expanded {
+			names = append(names, strings.NewReplacer("**", "x", "*", "x", "?", "x").Replace(name))
+		}
+	}
+	return names
+}
+
+// closestKey suggests the option of set that is at most two edits away from key
+func closestKey(key string, set *format.OptionSet) string {
+	if set == nil {
+		return ""
+	}
+	best, bestDistance := "", 3
+	for _, opt := range set.Options {
+		if d := editDistance(key, opt.Key); d < bestDistance {
+			best, bestDistance = opt.Key, d
+		}
+	}
+	return best
+}
+
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
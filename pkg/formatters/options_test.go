@@ -0,0 +1,83 @@
+package formatters_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/editorconfig"
+	"github.com/walteh/retab/v2/pkg/formatters"
+)
+
+func TestCheckOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		sources  []*editorconfig.KeySource
+		want     []string
+	}{
+		{
+			name:     "known_keys",
+			filename: "a.json",
+			sources: []*editorconfig.KeySource{
+				{Key: "indent_style", Value: "tab", Section: "*"},
+				{Key: "json_sort_keys", Value: "true", Section: "*.json"},
+			},
+			want: []string{},
+		},
+		{
+			name:     "other_provider_key_in_wildcard_section",
+			filename: "a.json",
+			sources: []*editorconfig.KeySource{
+				{Key: "yaml_tabs", Value: "visual", Section: "*"},
+				{Key: "go_module_name", Value: "example.com/m", Section: "*.{go,json}"},
+			},
+			want: []string{},
+		},
+		{
+			name:     "typo_suggests_key",
+			filename: "a.json",
+			sources: []*editorconfig.KeySource{
+				{Key: "json_sort_key", Value: "true", Section: "*.json"},
+			},
+			want: []string{"json_sort_key: unknown option, no formatter for this section reads it, did you mean json_sort_keys?"},
+		},
+		{
+			name:     "other_provider_key_in_targeted_section",
+			filename: "a.json",
+			sources: []*editorconfig.KeySource{
+				{Key: "yaml_tabs", Value: "visual", Section: "*.json"},
+			},
+			want: []string{"yaml_tabs: unknown option, no formatter for this section reads it"},
+		},
+		{
+			name:     "invalid_values",
+			filename: "a.yaml",
+			sources: []*editorconfig.KeySource{
+				{Key: "indent_style", Value: "tabs", Section: "*"},
+				{Key: "yaml_tabs", Value: "sometimes", Section: "*.yaml"},
+				{Key: "yaml_shell_schema", Value: "github-actions, circleci", Section: "*.yaml"},
+			},
+			want: []string{
+				`indent_style: invalid indent_style "tabs", expected one of tab, space`,
+				`yaml_tabs: invalid yaml_tabs "sometimes", expected one of spaces, error, visual`,
+				`yaml_shell_schema: invalid yaml_shell_schema "circleci", expected a comma separated list of docker-compose, github-actions, gitlab-ci, taskfile`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detection, err := (&formatters.AutoFormatProvider{}).Detect(context.Background(), "auto", tt.filename, strings.NewReader(""))
+			require.NoError(t, err, "detecting %s should succeed", tt.filename)
+
+			got := []string{}
+			for _, warning := range formatters.CheckOptions(detection, tt.sources) {
+				got = append(got, warning.Key+": "+warning.Message)
+			}
+			assert.Equal(t, tt.want, got, "warnings should match")
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package protofmt
+
+import (
+	"bytes"
+
+	"github.com/bufbuild/protocompile/ast"
+	"github.com/bufbuild/protocompile/parser"
+	"github.com/bufbuild/protocompile/reporter"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// parse parses src with protocompile, which keeps going after a syntax error so every error of
+// the file is returned as a diagnostic
+func parse(src []byte) (*ast.FileNode, error) {
+	diags := format.Diagnostics{}
+	handler := reporter.NewHandler(reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+		diags = append(diags, format.NewDiagnostic("proto", src, err.Start().Offset, err.End().Offset, err.Unwrap().Error()))
+		return nil
+	}, nil))
+
+	fileNode, err := parser.Parse("retab.protobuf-parser", bytes.NewReader(src), handler)
+	if len(diags) > 0 {
+		return nil, diags
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return fileNode, nil
+}
@@ -8,8 +8,6 @@ import (
 
 	"github.com/walteh/retab/v2/pkg/format"
 
-	"github.com/bufbuild/protocompile/parser"
-	"github.com/bufbuild/protocompile/reporter"
 	"gitlab.com/tozd/go/errors"
 )
 
@@ -27,7 +25,17 @@ func (me *Formatter) Targets() []string {
 }
 
 func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
-	fileNode, err := parser.Parse("retab.protobuf-parser", read, reporter.NewHandler(nil))
+	return format.SlashDirectives.Format(ctx, cfg, read, me.formatDocument)
+}
+
+// formatDocument parses and prints the whole file
+func (me *Formatter) formatDocument(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	src, err := io.ReadAll(read)
+	if err != nil {
+		return nil, errors.Errorf("failed to read protobuf: %w", err)
+	}
+
+	fileNode, err := parse(src)
 	if err != nil {
 		return nil, errors.Errorf("failed to parse protobuf: %w", err)
 	}
@@ -0,0 +1,99 @@
+package protofmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/bufbuild/protocompile/ast"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+var _ format.RangeProvider = (*Formatter)(nil)
+
+// FormatRanges formats the file and keeps the changes to the top level declarations that overlap
+// the ranges. The header is a single unit, since its imports and options are sorted.
+func (me *Formatter) FormatRanges(ctx context.Context, cfg format.Configuration, input []byte, ranges []format.LineRange) ([]format.Edit, error) {
+	r, err := me.Format(ctx, cfg, bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("failed to read formatted output: %w", err)
+	}
+
+	before, err := units(input)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := units(formatted)
+	if err != nil {
+		return nil, err
+	}
+
+	return format.UnitEdits(input, formatted, before, after, ranges), nil
+}
+
+// units returns the line ranges of the header and of each top level declaration after it, with
+// their comments. It returns no units when a header declaration comes after a type, because the
+// header is moved to the top when formatting.
+func units(src []byte) ([]format.LineRange, error) {
+	fileNode, err := parse(src)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse protobuf: %w", err)
+	}
+
+	span := func(node ast.Node) format.LineRange {
+		info := fileNode.NodeInfo(node)
+		span := format.LineRange{Start: info.Start().Line, End: info.End().Line}
+		if leading := info.LeadingComments(); leading.Len() > 0 {
+			span.Start = leading.Index(0).Start().Line
+		}
+		if trailing := info.TrailingComments(); trailing.Len() > 0 {
+			span.End = trailing.Index(trailing.Len() - 1).End().Line
+		}
+		return span
+	}
+
+	var header *format.LineRange
+	addHeader := func(node ast.Node) {
+		s := span(node)
+		if header == nil {
+			header = &s
+			return
+		}
+		header.Start = min(header.Start, s.Start)
+		header.End = max(header.End, s.End)
+	}
+
+	if fileNode.Syntax != nil {
+		addHeader(fileNode.Syntax)
+	}
+	if fileNode.Edition != nil {
+		addHeader(fileNode.Edition)
+	}
+
+	types := []format.LineRange{}
+	for _, decl := range fileNode.Decls {
+		switch node := decl.(type) {
+		case *ast.PackageNode, *ast.ImportNode, *ast.OptionNode:
+			if len(types) > 0 {
+				return nil, nil
+			}
+			addHeader(node)
+		case *ast.EmptyDeclNode:
+			// dropped when formatting
+		default:
+			types = append(types, span(node))
+		}
+	}
+
+	if header == nil {
+		return types, nil
+	}
+	return append([]format.LineRange{*header}, types...), nil
+}
@@ -0,0 +1,111 @@
+package protofmt_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/protofmt"
+)
+
+func TestFormatRanges(t *testing.T) {
+	src := `syntax = "proto3";
+
+import "b.proto";
+import "a.proto";
+
+message A {
+  int32 a = 1;
+}
+
+// B is formatted
+message B {
+  int32 b = 1;
+string name = 2;
+}
+`
+
+	tests := []struct {
+		name   string
+		src    string
+		ranges []format.LineRange
+		want   string
+	}{
+		{
+			name:   "field_formats_its_message",
+			src:    src,
+			ranges: []format.LineRange{{Start: 13, End: 13}},
+			want: `syntax = "proto3";
+
+import "b.proto";
+import "a.proto";
+
+message A {
+  int32 a = 1;
+}
+
+// B is formatted
+message B {
+	int32  b    = 1;
+	string name = 2;
+}
+`,
+		},
+		{
+			name:   "import_formats_the_header",
+			src:    src,
+			ranges: []format.LineRange{{Start: 3, End: 3}},
+			want: `syntax = "proto3";
+
+import "a.proto";
+import "b.proto";
+
+message A {
+  int32 a = 1;
+}
+
+// B is formatted
+message B {
+  int32 b = 1;
+string name = 2;
+}
+`,
+		},
+		{
+			name: "option_after_a_message_clips",
+			src: `syntax = "proto3";
+
+message A {
+  int32 a = 1;
+}
+
+option go_package = "a";
+`,
+			ranges: []format.LineRange{{Start: 4, End: 4}},
+			want: `syntax = "proto3";
+
+message A {
+	int32 a = 1;
+}
+
+option go_package = "a";
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(true).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+
+			edits, err := protofmt.NewFormatter().FormatRanges(context.Background(), cfg, []byte(tt.src), tt.ranges)
+			require.NoError(t, err, "formatting ranges should succeed")
+
+			diff.Require(t).Want(tt.want).Got(string(format.ApplyEdits([]byte(tt.src), edits))).Equals()
+		})
+	}
+}
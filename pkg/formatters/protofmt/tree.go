@@ -0,0 +1,114 @@
+package protofmt
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bufbuild/protocompile/ast"
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+var _ format.TreeProvider = (*Formatter)(nil)
+
+// Tree parses src with protocompile. Punctuation is left out, and the package, imports and
+// options of the file come first as a sorted list without duplicates, the way the formatter
+// writes them.
+func (me *Formatter) Tree(ctx context.Context, cfg format.Configuration, src []byte) ([]format.Node, error) {
+	fileNode, err := parse(src)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse protobuf: %w", err)
+	}
+
+	tree := &format.TreeBuilder{}
+	walk := func(tree *format.TreeBuilder, node ast.Node) {
+		_ = ast.Walk(node, &ast.SimpleVisitor{},
+			ast.WithBefore(func(node ast.Node) error {
+				if !skipped(node) {
+					tree.Enter(strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."), nodeText(node), fileNode.NodeInfo(node).Start().Line)
+				}
+				return nil
+			}),
+			ast.WithAfter(func(node ast.Node) error {
+				if !skipped(node) {
+					tree.Leave()
+				}
+				return nil
+			}),
+		)
+	}
+
+	if fileNode.Syntax != nil {
+		walk(tree, fileNode.Syntax)
+	}
+	if fileNode.Edition != nil {
+		walk(tree, fileNode.Edition)
+	}
+
+	header := []format.Node{}
+	for _, decl := range fileNode.Decls {
+		switch decl.(type) {
+		case *ast.PackageNode, *ast.ImportNode, *ast.OptionNode:
+			// a declaration of the header is compared as the text of its nodes
+			sub := &format.TreeBuilder{}
+			walk(sub, decl)
+			texts := []string{}
+			for _, node := range sub.Nodes() {
+				if node.Text != "" {
+					texts = append(texts, node.Text)
+				}
+			}
+			header = append(header, format.Node{Kind: sub.Nodes()[0].Kind, Text: strings.Join(texts, " "), Line: sub.Nodes()[0].Line})
+		}
+	}
+	slices.SortStableFunc(header, func(a, b format.Node) int {
+		return strings.Compare(a.Kind+" "+a.Text, b.Kind+" "+b.Text)
+	})
+	header = slices.CompactFunc(header, func(a, b format.Node) bool {
+		return a.Kind == b.Kind && a.Text == b.Text
+	})
+	for _, node := range header {
+		tree.Leaf(node.Kind, node.Text, node.Line)
+	}
+
+	for _, decl := range fileNode.Decls {
+		switch decl.(type) {
+		case *ast.PackageNode, *ast.ImportNode, *ast.OptionNode:
+		default:
+			walk(tree, decl)
+		}
+	}
+
+	return tree.Nodes(), nil
+}
+
+// skipped reports whether a node is punctuation, which the formatter adds and removes
+func skipped(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.RuneNode, *ast.EmptyDeclNode:
+		return true
+	}
+	return false
+}
+
+// nodeText is the value of a terminal node
+func nodeText(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.IdentNode:
+		return node.Val
+	case *ast.KeywordNode:
+		return node.Val
+	case *ast.StringLiteralNode:
+		return strconv.Quote(node.Val)
+	case *ast.UintLiteralNode:
+		return strconv.FormatUint(node.Val, 10)
+	case *ast.FloatLiteralNode:
+		return strconv.FormatFloat(node.Val, 'g', -1, 64)
+	case *ast.SpecialFloatLiteralNode:
+		return node.KeywordNode.Val
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package formatters
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+// Survey collects the languages and indentation of a tree's files, it is what `retab init` writes
+// an .editorconfig from
+type Survey struct {
+	auto      *AutoFormatProvider
+	all       *format.IndentStats
+	languages map[*LanguageConfig]*LanguageSurvey
+}
+
+// LanguageSurvey is what a Survey found out about the files of one language
+type LanguageSurvey struct {
+	Config *LanguageConfig
+	Files  int
+	Indent *format.IndentStats
+}
+
+func NewSurvey(auto *AutoFormatProvider) *Survey {
+	return &Survey{
+		auto:      auto,
+		all:       &format.IndentStats{Steps: map[int]int{}},
+		languages: map[*LanguageConfig]*LanguageSurvey{},
+	}
+}
+
+// Add detects the language of a file like `retab fmt` does and counts its indentation, it reports
+// whether retab can format the file
+func (me *Survey) Add(ctx context.Context, filename string, content []byte) bool {
+	detection, err := me.auto.Detect(ctx, "auto", filename, bytes.NewReader(content))
+	if err != nil {
+		return false
+	}
+
+	lang, ok := me.languages[detection.Config]
+	if !ok {
+		lang = &LanguageSurvey{Config: detection.Config, Indent: &format.IndentStats{Steps: map[int]int{}}}
+		me.languages[detection.Config] = lang
+	}
+
+	stats := format.MeasureIndentation(content)
+	lang.Files++
+	lang.Indent.Add(stats)
+	me.all.Add(stats)
+
+	return true
+}
+
+// Languages returns the languages found, in the order they are detected in
+func (me *Survey) Languages() []*LanguageSurvey {
+	langs := []*LanguageSurvey{}
+	for _, config := range languageConfigs {
+		if lang, ok := me.languages[config]; ok {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// EditorConfig writes an .editorconfig with the indentation most files of the tree use in [*],
+// a section for every language found with the indentation of its files, and the options of its
+// formatter commented out with their defaults.
+func (me *Survey) EditorConfig() string {
+	var b strings.Builder
+
+	b.WriteString("# generated by retab init, `retab options list` describes every key\n")
+	b.WriteString("root = true\n\n[*]\n")
+	writeIndent(&b, me.all)
+	writeOptions(&b, format.EditorconfigOptions, "trim_multiple_empty_lines", "one_bracket_per_line")
+
+	langs := me.Languages()
+	// the first language config whose globs match wins detection, but the last matching section
+	// wins in an .editorconfig, so the sections are written in reverse to agree
+	slices.Reverse(langs)
+
+	for _, lang := range langs {
+		section := sectionGlob(lang.Config.FilenameGlobs)
+		if section == "" {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n# %s, %d file(s)\n[%s]\n", lang.Config.LangIds[0], lang.Files, section)
+		writeIndent(&b, lang.Indent)
+		if lang.Config.Options != nil {
+			writeOptions(&b, lang.Config.Options, lang.Config.Options.Keys()...)
+		}
+	}
+
+	return b.String()
+}
+
+func writeIndent(b *strings.Builder, stats *format.IndentStats) {
+	useTabs, size, ok := stats.Style()
+	if !ok {
+		return
+	}
+	if useTabs {
+		b.WriteString("indent_style = tab\n")
+	} else {
+		b.WriteString("indent_style = space\n")
+	}
+	fmt.Fprintf(b, "indent_size = %d\n", size)
+}
+
+// writeOptions writes the keys of set commented out, with their docs and defaults
+func writeOptions(b *strings.Builder, set *format.OptionSet, keys ...string) {
+	for _, key := range keys {
+		opt, ok := set.Lookup(key)
+		if !ok {
+			continue
+		}
+		value := opt.Default
+		if value == "" && opt.Type == format.OptionTypeEnum {
+			value = opt.Values[0]
+		}
+		fmt.Fprintf(b, "# %s\n%s\n", opt.Doc, strings.TrimSpace(fmt.Sprintf("# %s = %s", opt.Key, value)))
+	}
+}
+
+// sectionGlob joins globs into one editorconfig section
+func sectionGlob(globs []string) string {
+	switch len(globs) {
+	case 0:
+		return ""
+	case 1:
+		return globs[0]
+	}
+	return "{" + strings.Join(globs, ",") + "}"
+}
@@ -0,0 +1,33 @@
+package formatters_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/formatters"
+)
+
+func TestSurveyEditorConfig(t *testing.T) {
+	ctx := context.Background()
+	survey := formatters.NewSurvey(&formatters.AutoFormatProvider{})
+
+	require.True(t, survey.Add(ctx, "a.yaml", []byte("a:\n  b: 1\n  c:\n    d: 2\n")), "yaml should be detected")
+	require.True(t, survey.Add(ctx, "b.yml", []byte("x:\n  - 1\n")), "yml should be detected")
+	require.True(t, survey.Add(ctx, "main.go", []byte("package main\n\nfunc main() {\n\tprintln()\n\tif true {\n\t\tprintln()\n\t}\n}\n")), "go should be detected")
+	require.False(t, survey.Add(ctx, "notes.unknown", []byte("hello\n")), "unknown files should be skipped")
+
+	langs := survey.Languages()
+	require.Len(t, langs, 2, "two languages should be found")
+	assert.Equal(t, "yaml", langs[0].Config.LangIds[0], "yaml should be detected first")
+	assert.Equal(t, 2, langs[0].Files, "both yaml files should be counted")
+
+	got := survey.EditorConfig()
+	assert.Contains(t, got, "root = true\n\n[*]\nindent_style = tab\nindent_size = 4\n", "the tree's dominant style should go in [*]")
+	assert.Contains(t, got, "# go, 1 file(s)\n[*.go]\nindent_style = tab\nindent_size = 4\n", "go should get a section")
+	assert.Contains(t, got, "# yaml, 2 file(s)\n[{*.yaml,*.yml}]\nindent_style = space\nindent_size = 2\n", "yaml should get a section with its own indentation")
+	assert.Contains(t, got, "# yaml_tabs = spaces\n", "yaml options should be listed with their defaults")
+	assert.Less(t, strings.Index(got, "[*.go]"), strings.Index(got, "[{*.yaml,*.yml}]"), "sections should be written in reverse detection order")
+}
@@ -0,0 +1,69 @@
+package shfmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+var _ format.RangeProvider = (*Formatter)(nil)
+
+// FormatRanges formats the script and keeps the changes to the top level statements that overlap
+// the ranges, a function or a loop is formatted as a whole
+func (f *Formatter) FormatRanges(ctx context.Context, cfg format.Configuration, input []byte, ranges []format.LineRange) ([]format.Edit, error) {
+	r, err := f.Format(ctx, cfg, bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("failed to read formatted script: %w", err)
+	}
+
+	variant, err := dialect(cfg, input)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := units(variant, input)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := units(variant, formatted)
+	if err != nil {
+		return nil, err
+	}
+
+	return format.UnitEdits(input, formatted, before, after, ranges), nil
+}
+
+// units returns the line ranges of the top level statements of src, with their comments and
+// heredoc bodies
+func units(variant syntax.LangVariant, src []byte) ([]format.LineRange, error) {
+	prog, err := syntax.NewParser(syntax.KeepComments(true), syntax.Variant(variant)).Parse(bytes.NewReader(src), "")
+	if err != nil {
+		return nil, errors.Errorf("failed to parse shell script: %w", diagnostic(src, err))
+	}
+
+	units := make([]format.LineRange, 0, len(prog.Stmts))
+	for _, stmt := range prog.Stmts {
+		span := format.LineRange{Start: int(stmt.Pos().Line()), End: int(stmt.End().Line())}
+		syntax.Walk(stmt, func(node syntax.Node) bool {
+			if node == nil || !node.Pos().IsValid() {
+				return true
+			}
+			span.Start = min(span.Start, int(node.Pos().Line()))
+			span.End = max(span.End, int(node.End().Line()))
+			return true
+		})
+		units = append(units, span)
+	}
+
+	return units, nil
+}
@@ -0,0 +1,79 @@
+package shfmt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+func TestFormatRanges(t *testing.T) {
+	src := `#!/bin/bash
+echo   one
+
+# greet says hello
+greet() {
+echo hello
+cat <<EOF
+  kept
+EOF
+}
+
+echo   two; echo   three
+`
+
+	tests := []struct {
+		name   string
+		ranges []format.LineRange
+		want   string
+	}{
+		{
+			name:   "line_in_function_formats_the_function",
+			ranges: []format.LineRange{{Start: 6, End: 6}},
+			want: `#!/bin/bash
+echo   one
+
+# greet says hello
+greet() {
+	echo hello
+	cat << EOF
+  kept
+EOF
+}
+
+echo   two; echo   three
+`,
+		},
+		{
+			name:   "statements_on_one_line_are_formatted_together",
+			ranges: []format.LineRange{{Start: 12, End: 12}},
+			want: `#!/bin/bash
+echo   one
+
+# greet says hello
+greet() {
+echo hello
+cat <<EOF
+  kept
+EOF
+}
+
+echo two
+echo three
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createTestConfig(true, 4, nil)
+
+			edits, err := NewFormatter().FormatRanges(context.Background(), cfg, []byte(src), tt.ranges)
+			require.NoError(t, err, "formatting ranges should succeed")
+
+			diff.Require(t).Want(tt.want).Got(string(format.ApplyEdits([]byte(src), edits))).Equals()
+		})
+	}
+}
@@ -1,10 +1,10 @@
 package shfmt
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"io"
+	"slices"
 	"strings"
 
 	"github.com/walteh/retab/v2/pkg/format"
@@ -56,53 +56,100 @@ func (f *Formatter) Targets() []string {
 // 	return lang, shebasng, read, nil
 // }
 
-// Format parses and formats shell code.
-func (f *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+// Options are the editorconfig keys the shell formatter reads
+var Options = format.RegisterOptions("sh",
+	shellDialectOption,
+)
+
+var shellDialectOption = &format.Option{
+	Key:    "shell_dialect",
+	Type:   format.OptionTypeEnum,
+	Values: []string{"auto", "bash", "posix", "sh", "mksh", "bats"},
+	Doc:    "the shell language, detected from the shebang when it is not set",
+}
 
+// dialect returns the shell_dialect option, or the dialect the shebang at the start of the script
+// names when it is not set
+func dialect(cfg format.Configuration, head []byte) (syntax.LangVariant, error) {
 	langVar := syntax.LangAuto
 
-	if dialect, ok := cfg.Raw()["shell_dialect"]; ok {
+	if dialect := shellDialectOption.String(cfg); dialect != "" {
 		if err := langVar.Set(dialect); err != nil {
-			return nil, errors.Errorf("invalid shell dialect %q: %w", dialect, err)
-		}
-	} else {
-		readz := bufio.NewReader(read)
-		cont, _ := readz.Peek(250)
-		read = readz
-
-		lang := format.Shebang(cont)
-
-		switch lang {
-		case "bash", "zsh", "ksh":
-			// Bash-compatible shells with extended features
-			langVar = syntax.LangBash
-			break
-		case "posix", "sh", "dash", "yash", "ash", "busybox":
-			// POSIX-compliant shells (standard/basic shell)
-			langVar = syntax.LangPOSIX
-			break
-		case "mksh", "pdksh":
-			// MirBSD Korn shell
-			langVar = syntax.LangMirBSDKorn
-			break
-		case "bats":
-			// Bash Automated Testing System
-			langVar = syntax.LangBats
-			break
-		default:
-			// Skip unknown shell types
-			langVar = syntax.LangBash
+			return langVar, errors.Errorf("invalid shell dialect %q: %w", dialect, err)
 		}
+		return langVar, nil
+	}
+
+	lang := format.Shebang(head)
+
+	switch lang {
+	case "bash", "zsh", "ksh":
+		// Bash-compatible shells with extended features
+		langVar = syntax.LangBash
+		break
+	case "posix", "sh", "dash", "yash", "ash", "busybox":
+		// POSIX-compliant shells (standard/basic shell)
+		langVar = syntax.LangPOSIX
+		break
+	case "mksh", "pdksh":
+		// MirBSD Korn shell
+		langVar = syntax.LangMirBSDKorn
+		break
+	case "bats":
+		// Bash Automated Testing System
+		langVar = syntax.LangBats
+		break
+	default:
+		// Skip unknown shell types
+		langVar = syntax.LangBash
+	}
+
+	return langVar, nil
+}
+
+// diagnostic converts the syntax errors of the parser, other errors are returned as they are
+func diagnostic(src []byte, err error) error {
+	var parseErr syntax.ParseError
+	if errors.As(err, &parseErr) {
+		offset := int(parseErr.Pos.Offset())
+		return format.Diagnostics{format.NewDiagnostic("shell", src, offset, offset, parseErr.Text)}
+	}
+
+	var langErr syntax.LangError
+	if errors.As(err, &langErr) {
+		offset := int(langErr.Pos.Offset())
+		_, message, _ := strings.Cut(langErr.Error(), langErr.Pos.String()+": ")
+		return format.Diagnostics{format.NewDiagnostic("shell", src, offset, offset, message)}
+	}
+
+	return err
+}
+
+// Format parses and formats shell code.
+func (f *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	return format.HashDirectives.Format(ctx, cfg, read, f.formatDocument)
+}
+
+// formatDocument parses and prints the whole script
+func (f *Formatter) formatDocument(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+
+	src, err := io.ReadAll(read)
+	if err != nil {
+		return nil, errors.Errorf("failed to read shell script: %w", err)
+	}
 
+	langVar, err := dialect(cfg, src[:min(len(src), 250)])
+	if err != nil {
+		return nil, err
 	}
 
 	// Create a parser that keeps comments
 	parser := syntax.NewParser(syntax.KeepComments(true), syntax.Variant(langVar))
 
 	// Parse the source code
-	prog, err := parser.Parse(read, cfg.Raw()["filename"])
+	prog, err := parser.Parse(bytes.NewReader(src), cfg.Raw()["filename"])
 	if err != nil {
-		return nil, errors.Errorf("failed to parse shell script: %w", err)
+		return nil, errors.Errorf("failed to parse shell script: %w", diagnostic(src, err))
 	}
 
 	// Create a new printer
@@ -140,13 +187,54 @@ func (f *Formatter) Format(ctx context.Context, cfg format.Configuration, read i
 		//replace all leading 4 spaces with tabs
 		// the way the tab writer is configured inside syntax.NewPrinter() makes
 		// comment alignment way off unless we hack it like this
-		br, err := format.BruteForceIndentation(ctx, strings.Repeat(" ", 4), cfg, &buf)
+		out, err := tabIndent(buf.Bytes(), langVar)
 		if err != nil {
 			return nil, errors.Errorf("failed to apply configuration: %w", err)
 		}
 
-		return br, nil
+		return bytes.NewReader(out), nil
 	}
 
 	return bytes.NewReader(buf.Bytes()), nil
 }
+
+// span is a range of offsets, start and end excluded, whose lines are content and not indentation
+type span struct {
+	start uint
+	end   uint
+}
+
+// tabIndent replaces the groups of four spaces that indent the lines of the printed src with tabs,
+// except for the lines of heredocs and strings, whose spaces are part of them
+func tabIndent(src []byte, variant syntax.LangVariant) ([]byte, error) {
+	prog, err := syntax.NewParser(syntax.KeepComments(true), syntax.Variant(variant)).Parse(bytes.NewReader(src), "")
+	if err != nil {
+		return nil, errors.Errorf("failed to parse formatted shell script: %w", err)
+	}
+
+	spans := []span{}
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.Redirect:
+			if node.Hdoc != nil && node.Hdoc.Pos().IsValid() {
+				// the body starts a line, which is part of it
+				spans = append(spans, span{start: node.Hdoc.Pos().Offset() - 1, end: node.Hdoc.End().Offset()})
+			}
+		case *syntax.SglQuoted, *syntax.DblQuoted:
+			spans = append(spans, span{start: node.Pos().Offset(), end: node.End().Offset()})
+		}
+		return true
+	})
+
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	offset := uint(0)
+	for i, line := range lines {
+		if !slices.ContainsFunc(spans, func(s span) bool { return s.start < offset && offset < s.end }) {
+			tabs := (len(line) - len(bytes.TrimLeft(line, " "))) / 4
+			lines[i] = append(bytes.Repeat([]byte("\t"), tabs), line[tabs*4:]...)
+		}
+		offset += uint(len(line))
+	}
+
+	return bytes.Join(lines, nil), nil
+}
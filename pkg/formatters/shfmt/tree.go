@@ -0,0 +1,118 @@
+package shfmt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+var _ format.TreeProvider = (*Formatter)(nil)
+
+// Tree parses src with mvdan.cc/sh in the dialect Format would use, without its comments
+func (f *Formatter) Tree(ctx context.Context, cfg format.Configuration, src []byte) ([]format.Node, error) {
+	variant, err := dialect(cfg, src)
+	if err != nil {
+		return nil, err
+	}
+
+	prog, err := syntax.NewParser(syntax.Variant(variant)).Parse(bytes.NewReader(src), "")
+	if err != nil {
+		return nil, errors.Errorf("failed to parse shell script: %w", diagnostic(src, err))
+	}
+
+	// the literals of <<- heredocs, and whether they start a line
+	dashed := map[*syntax.Lit]bool{}
+
+	tree := &format.TreeBuilder{}
+	syntax.Walk(prog, func(node syntax.Node) bool {
+		if node == nil {
+			tree.Leave()
+			return true
+		}
+		if redirect, ok := node.(*syntax.Redirect); ok && redirect.Op == syntax.DashHdoc && redirect.Hdoc != nil {
+			for i, part := range redirect.Hdoc.Parts {
+				if lit, ok := part.(*syntax.Lit); ok {
+					dashed[lit] = i == 0
+				}
+			}
+		}
+		text := nodeText(node)
+		if lit, ok := node.(*syntax.Lit); ok {
+			if first, ok := dashed[lit]; ok {
+				text = stripHeredocTabs(lit.Value, first)
+			}
+		}
+		tree.Enter(strings.TrimPrefix(fmt.Sprintf("%T", node), "*syntax."), text, int(node.Pos().Line()))
+		return true
+	})
+
+	return tree.Nodes(), nil
+}
+
+// nodeText is what a node holds besides its children: words, operators and flags
+func nodeText(node syntax.Node) string {
+	switch node := node.(type) {
+	case *syntax.Lit:
+		return node.Value
+	case *syntax.SglQuoted:
+		if node.Dollar {
+			return "$" + node.Value
+		}
+		return node.Value
+	case *syntax.DblQuoted:
+		if node.Dollar {
+			return "$"
+		}
+	case *syntax.Stmt:
+		return fmt.Sprint(node.Negated, node.Background, node.Coprocess)
+	case *syntax.BinaryCmd:
+		return node.Op.String()
+	case *syntax.Redirect:
+		return node.Op.String()
+	case *syntax.BinaryArithm:
+		return node.Op.String()
+	case *syntax.UnaryArithm:
+		return fmt.Sprint(node.Op, node.Post)
+	case *syntax.BinaryTest:
+		return node.Op.String()
+	case *syntax.UnaryTest:
+		return node.Op.String()
+	case *syntax.ProcSubst:
+		return node.Op.String()
+	case *syntax.CaseItem:
+		return node.Op.String()
+	case *syntax.Assign:
+		return fmt.Sprint(node.Append, node.Naked)
+	case *syntax.ParamExp:
+		text := fmt.Sprint(node.Short, node.Excl, node.Length, node.Width)
+		if node.Exp != nil {
+			text += " " + node.Exp.Op.String()
+		}
+		if node.Repl != nil {
+			text += fmt.Sprint(" ", node.Repl.All)
+		}
+		return text
+	case *syntax.ForClause:
+		return fmt.Sprint(node.Select)
+	case *syntax.ArithmExp:
+		return fmt.Sprint(node.Unsigned)
+	}
+	return ""
+}
+
+// stripHeredocTabs removes the tabs that lead the lines of a <<- heredoc, which the shell drops and
+// formatting re-indents. first is set when s starts a line.
+func stripHeredocTabs(s string, first bool) string {
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		if i > 0 || first {
+			lines[i] = strings.TrimLeft(lines[i], "\t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -27,6 +27,9 @@ func NewSwiftCmdFormatter(opts ...cmdfmt.OptBasicExternalFormatterOptsSetter) fo
 	startopts := []cmdfmt.OptBasicExternalFormatterOptsSetter{
 		cmdfmt.WithIndent("  "),
 		cmdfmt.WithExecutable("swift-format"),
+		cmdfmt.WithVersionArgs([]string{"--version"}),
+		// swift-format is versioned 601.x for swift 6.1
+		cmdfmt.WithNativeVersion("601"),
 		cmdfmt.WithDockerImageName("swift"),
 		cmdfmt.WithDockerImageTag("6.1"),
 	}
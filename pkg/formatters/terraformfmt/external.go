@@ -15,6 +15,7 @@ func NewTerraformCmdFormatter(opts ...cmdfmt.OptBasicExternalFormatterOptsSetter
 	startopts := []cmdfmt.OptBasicExternalFormatterOptsSetter{
 		cmdfmt.WithIndent("  "),
 		cmdfmt.WithExecutable("terraform"),
+		cmdfmt.WithVersionArgs([]string{"version"}),
 		cmdfmt.WithDockerImageName("hashicorp/terraform"),
 		cmdfmt.WithDockerImageTag("latest"),
 	}
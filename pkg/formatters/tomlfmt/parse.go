@@ -0,0 +1,519 @@
+package tomlfmt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNewline
+	tokenComment
+	tokenBeginBracket
+	tokenEndBracket
+	tokenBeginBrace
+	tokenEndBrace
+	tokenEquals
+	tokenComma
+	tokenString
+	tokenBare
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+	pos  int
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// errorf is an error at the position of the lexer
+func (me *lexer) errorf(message string, args ...any) error {
+	return me.errorAt(me.pos, me.pos, message, args...)
+}
+
+// errorAt is an error about the bytes start to end of the source
+func (me *lexer) errorAt(start int, end int, message string, args ...any) error {
+	return format.Diagnostics{format.NewDiagnostic("toml", []byte(me.src), start, end, fmt.Sprintf(message, args...))}
+}
+
+func (me *lexer) next() (*token, error) {
+	for me.pos < len(me.src) && (me.src[me.pos] == ' ' || me.src[me.pos] == '\t' || me.src[me.pos] == '\r') {
+		me.pos++
+	}
+
+	tok := &token{line: me.line, pos: me.pos}
+
+	if me.pos >= len(me.src) {
+		tok.kind = tokenEOF
+		return tok, nil
+	}
+
+	start := me.pos
+	switch c := me.src[me.pos]; c {
+	case '\n':
+		tok.kind = tokenNewline
+		me.pos++
+		me.line++
+	case '#':
+		end := strings.IndexByte(me.src[me.pos:], '\n')
+		if end < 0 {
+			end = len(me.src) - me.pos
+		}
+		me.pos += end
+		tok.kind = tokenComment
+	case '[':
+		tok.kind = tokenBeginBracket
+		me.pos++
+	case ']':
+		tok.kind = tokenEndBracket
+		me.pos++
+	case '{':
+		tok.kind = tokenBeginBrace
+		me.pos++
+	case '}':
+		tok.kind = tokenEndBrace
+		me.pos++
+	case '=':
+		tok.kind = tokenEquals
+		me.pos++
+	case ',':
+		tok.kind = tokenComma
+		me.pos++
+	case '"', '\'':
+		if err := me.string(c); err != nil {
+			return nil, err
+		}
+		tok.kind = tokenString
+	default:
+		for me.pos < len(me.src) && !strings.ContainsRune(" \t\r\n#[]{}=,\"'", rune(me.src[me.pos])) {
+			me.pos++
+		}
+		tok.kind = tokenBare
+	}
+
+	tok.text = strings.TrimRight(me.src[start:me.pos], " \t\r")
+
+	return tok, nil
+}
+
+func (me *lexer) string(quote byte) error {
+	delim := strings.Repeat(string(quote), 3)
+
+	if strings.HasPrefix(me.src[me.pos:], delim) {
+		me.pos += 3
+		for me.pos < len(me.src) {
+			if quote == '"' && me.src[me.pos] == '\\' {
+				// skip the escaped character, which may be the newline of a line ending backslash
+				me.pos++
+				if me.pos < len(me.src) && me.src[me.pos] == '\n' {
+					me.line++
+				}
+				me.pos++
+				continue
+			}
+			if strings.HasPrefix(me.src[me.pos:], delim) {
+				me.pos += 3
+				// up to two quotes may directly precede the closing delimiter
+				for i := 0; i < 2 && me.pos < len(me.src) && me.src[me.pos] == quote; i++ {
+					me.pos++
+				}
+				return nil
+			}
+			if me.src[me.pos] == '\n' {
+				me.line++
+			}
+			me.pos++
+		}
+		return me.errorf("unterminated multi-line string")
+	}
+
+	me.pos++
+	for me.pos < len(me.src) {
+		switch me.src[me.pos] {
+		case quote:
+			me.pos++
+			return nil
+		case '\\':
+			if quote == '"' {
+				me.pos++
+			}
+		case '\n':
+			return me.errorf("unterminated string")
+		}
+		me.pos++
+	}
+	return me.errorf("unterminated string")
+}
+
+type valueKind int
+
+const (
+	valueScalar valueKind = iota
+	valueArray
+	valueInlineTable
+)
+
+type value struct {
+	kind valueKind
+	// text is the source text of a scalar, kept verbatim unless quotes are normalized
+	text string
+	// elements of an array, with the comments around them
+	elements []*element
+	// multiline is set when an array was written over several lines
+	multiline bool
+	// dangling are comments after the last array element
+	dangling []string
+	// entries of an inline table
+	entries []*entry
+}
+
+type element struct {
+	value    *value
+	leading  []string
+	trailing string
+}
+
+type entry struct {
+	key     []string
+	value   *value
+	comment string
+}
+
+type header struct {
+	array   bool
+	key     []string
+	comment string
+}
+
+type itemKind int
+
+const (
+	itemBlank itemKind = iota
+	itemComment
+	itemHeader
+	itemEntry
+)
+
+type item struct {
+	kind    itemKind
+	comment string
+	header  *header
+	entry   *entry
+}
+
+var (
+	localDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	localTime = regexp.MustCompile(`^\d{2}:\d{2}`)
+)
+
+type parser struct {
+	lex  *lexer
+	tok  *token
+	prev *token
+}
+
+func parse(src string) ([]*item, error) {
+	me := &parser{lex: &lexer{src: src, line: 1}}
+	if err := me.advance(); err != nil {
+		return nil, err
+	}
+
+	items := []*item{}
+	for me.tok.kind != tokenEOF {
+		var it *item
+		var err error
+
+		switch me.tok.kind {
+		case tokenNewline:
+			items = append(items, &item{kind: itemBlank})
+			if err := me.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		case tokenComment:
+			it = &item{kind: itemComment, comment: me.tok.text}
+			err = me.advance()
+		case tokenBeginBracket:
+			it, err = me.header()
+		case tokenBare, tokenString:
+			var e *entry
+			e, err = me.entry()
+			it = &item{kind: itemEntry, entry: e}
+		default:
+			err = me.unexpected()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := me.endOfLine(func(c string) {
+			switch it.kind {
+			case itemHeader:
+				it.header.comment = c
+			case itemEntry:
+				it.entry.comment = c
+			}
+		}); err != nil {
+			return nil, err
+		}
+
+		items = append(items, it)
+	}
+
+	return items, nil
+}
+
+// errorf is an error about the current token
+func (me *parser) errorf(message string, args ...any) error {
+	return me.lex.errorAt(me.tok.pos, me.tok.pos+len(me.tok.text), message, args...)
+}
+
+func (me *parser) advance() error {
+	tok, err := me.lex.next()
+	if err != nil {
+		return err
+	}
+	me.prev, me.tok = me.tok, tok
+	return nil
+}
+
+func (me *parser) unexpected() error {
+	if me.tok.kind == tokenEOF {
+		return me.errorf("unexpected end of input")
+	}
+	if me.tok.kind == tokenNewline {
+		return me.errorf("unexpected end of line")
+	}
+	return me.errorf("unexpected %q", me.tok.text)
+}
+
+// endOfLine consumes an optional comment and the newline that end a statement
+func (me *parser) endOfLine(comment func(string)) error {
+	if me.tok.kind == tokenComment {
+		comment(me.tok.text)
+		if err := me.advance(); err != nil {
+			return err
+		}
+	}
+
+	switch me.tok.kind {
+	case tokenEOF:
+		return nil
+	case tokenNewline:
+		return me.advance()
+	default:
+		return me.errorf("expected the end of the line, found %q", me.tok.text)
+	}
+}
+
+// adjacent reports whether the current token directly follows the previous one
+func (me *parser) adjacent() bool {
+	return me.prev != nil && me.tok.pos == me.prev.pos+len(me.prev.text)
+}
+
+func (me *parser) header() (*item, error) {
+	h := &header{}
+
+	if err := me.advance(); err != nil {
+		return nil, err
+	}
+	if me.tok.kind == tokenBeginBracket && me.adjacent() {
+		h.array = true
+		if err := me.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := me.key()
+	if err != nil {
+		return nil, err
+	}
+	h.key = key
+
+	if me.tok.kind != tokenEndBracket {
+		return nil, me.errorf("expected ']' after table name, found %q", me.tok.text)
+	}
+	if err := me.advance(); err != nil {
+		return nil, err
+	}
+	if h.array {
+		if me.tok.kind != tokenEndBracket || !me.adjacent() {
+			return nil, me.errorf("expected ']]' after array of tables name")
+		}
+		if err := me.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &item{kind: itemHeader, header: h}, nil
+}
+
+// key reads a possibly dotted key into its parts, dropping the whitespace around the dots
+func (me *parser) key() ([]string, error) {
+	parts := []string{""}
+	for me.tok.kind == tokenBare || me.tok.kind == tokenString {
+		if me.tok.kind == tokenString {
+			if strings.HasPrefix(me.tok.text, `"""`) || strings.HasPrefix(me.tok.text, "'''") {
+				return nil, me.errorf("multi-line strings cannot be keys")
+			}
+			parts[len(parts)-1] += me.tok.text
+		} else {
+			segments := strings.Split(me.tok.text, ".")
+			parts[len(parts)-1] += segments[0]
+			parts = append(parts, segments[1:]...)
+		}
+		if err := me.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return nil, me.errorf("invalid key %q", strings.Join(parts, "."))
+		}
+	}
+
+	return parts, nil
+}
+
+func (me *parser) entry() (*entry, error) {
+	key, err := me.key()
+	if err != nil {
+		return nil, err
+	}
+
+	if me.tok.kind != tokenEquals {
+		return nil, me.errorf("expected '=' after key %s, found %q", strings.Join(key, "."), me.tok.text)
+	}
+	if err := me.advance(); err != nil {
+		return nil, err
+	}
+
+	v, err := me.value()
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry{key: key, value: v}, nil
+}
+
+func (me *parser) value() (*value, error) {
+	switch me.tok.kind {
+	case tokenString:
+		v := &value{kind: valueScalar, text: me.tok.text}
+		return v, me.advance()
+	case tokenBare:
+		v := &value{kind: valueScalar, text: me.tok.text}
+		if err := me.advance(); err != nil {
+			return nil, err
+		}
+		// a local date time may separate the date and the time with a space
+		if localDate.MatchString(v.text) && me.tok.kind == tokenBare && me.tok.line == me.prev.line && localTime.MatchString(me.tok.text) {
+			v.text += " " + me.tok.text
+			if err := me.advance(); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case tokenBeginBracket:
+		return me.array()
+	case tokenBeginBrace:
+		return me.inlineTable()
+	default:
+		return nil, me.unexpected()
+	}
+}
+
+func (me *parser) array() (*value, error) {
+	v := &value{kind: valueArray}
+
+	if err := me.advance(); err != nil {
+		return nil, err
+	}
+
+	comma := true
+	var leading []string
+	for {
+		switch me.tok.kind {
+		case tokenNewline:
+			v.multiline = true
+			if err := me.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		case tokenComment:
+			leading = append(leading, me.tok.text)
+			if err := me.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		case tokenEndBracket:
+			v.dangling = leading
+			return v, me.advance()
+		}
+
+		if !comma {
+			return nil, me.errorf("expected ',' or ']' in array, found %q", me.tok.text)
+		}
+
+		elemValue, err := me.value()
+		if err != nil {
+			return nil, err
+		}
+		elem := &element{value: elemValue, leading: leading}
+		leading = nil
+		v.elements = append(v.elements, elem)
+
+		line := me.prev.line
+		comma = me.tok.kind == tokenComma
+		if comma {
+			if err := me.advance(); err != nil {
+				return nil, err
+			}
+		}
+		if me.tok.kind == tokenComment && me.tok.line == line {
+			elem.trailing = me.tok.text
+			if err := me.advance(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (me *parser) inlineTable() (*value, error) {
+	v := &value{kind: valueInlineTable}
+
+	if err := me.advance(); err != nil {
+		return nil, err
+	}
+
+	for me.tok.kind != tokenEndBrace {
+		if len(v.entries) > 0 {
+			if me.tok.kind != tokenComma {
+				return nil, me.errorf("expected ',' or '}' in inline table, found %q", me.tok.text)
+			}
+			if err := me.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		e, err := me.entry()
+		if err != nil {
+			return nil, err
+		}
+		v.entries = append(v.entries, e)
+	}
+
+	return v, me.advance()
+}
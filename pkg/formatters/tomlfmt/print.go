@@ -0,0 +1,322 @@
+package tomlfmt
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type printer struct {
+	buf    bytes.Buffer
+	opts   *options
+	indent string
+}
+
+// row is an entry being laid out, its key and value are aligned with the rows around it
+type row struct {
+	depth   int
+	key     string
+	value   string
+	comment string
+}
+
+func (me *printer) document(items []*item) {
+	items = collapseBlankLines(items)
+	depths := tableDepths(items)
+
+	if me.opts.sortKeys {
+		items, depths = sortEntries(items, depths)
+	}
+
+	rows := []*row{}
+	for i, it := range items {
+		if it.kind == itemEntry {
+			rows = append(rows, &row{
+				depth:   depths[i],
+				key:     me.key(it.entry.key),
+				value:   me.value(it.entry.value, depths[i]),
+				comment: it.entry.comment,
+			})
+			continue
+		}
+
+		me.rows(rows)
+		rows = rows[:0]
+
+		switch it.kind {
+		case itemBlank:
+			me.buf.WriteByte('\n')
+		case itemComment:
+			me.writeIndent(depths[i])
+			me.buf.WriteString(it.comment)
+			me.buf.WriteByte('\n')
+		case itemHeader:
+			me.writeIndent(depths[i])
+			open, close := "[", "]"
+			if it.header.array {
+				open, close = "[[", "]]"
+			}
+			me.buf.WriteString(open + me.key(it.header.key) + close)
+			if it.header.comment != "" {
+				me.buf.WriteString(" " + it.header.comment)
+			}
+			me.buf.WriteByte('\n')
+		}
+	}
+
+	me.rows(rows)
+}
+
+func (me *printer) writeIndent(depth int) {
+	for range depth {
+		me.buf.WriteString(me.indent)
+	}
+}
+
+// rows writes consecutive entries, aligning their '=' and their comments like hclfmt's formatCells.
+// A value over several lines ends the alignment chain, and is not part of a comment chain.
+func (me *printer) rows(rows []*row) {
+	lines := make([]string, len(rows))
+
+	chainStart := 0
+	for i, r := range rows {
+		if i < len(rows)-1 && !strings.Contains(r.value, "\n") {
+			continue
+		}
+		maxKey := 0
+		for _, r := range rows[chainStart : i+1] {
+			maxKey = max(maxKey, utf8.RuneCountInString(r.key))
+		}
+		for j, r := range rows[chainStart : i+1] {
+			lines[chainStart+j] = r.key + strings.Repeat(" ", maxKey-utf8.RuneCountInString(r.key)) + " = " + r.value
+		}
+		chainStart = i + 1
+	}
+
+	chainStart = -1
+	closeCommentChain := func(end int) {
+		maxColumns := 0
+		for _, line := range lines[chainStart:end] {
+			maxColumns = max(maxColumns, utf8.RuneCountInString(line))
+		}
+		for j := chainStart; j < end; j++ {
+			lines[j] += strings.Repeat(" ", maxColumns-utf8.RuneCountInString(lines[j])+1) + rows[j].comment
+		}
+		chainStart = -1
+	}
+	for i, r := range rows {
+		if r.comment == "" || strings.Contains(r.value, "\n") {
+			if chainStart != -1 {
+				closeCommentChain(i)
+			}
+			if r.comment != "" {
+				lines[i] += " " + r.comment
+			}
+			continue
+		}
+		if chainStart == -1 {
+			chainStart = i
+		}
+	}
+	if chainStart != -1 {
+		closeCommentChain(len(rows))
+	}
+
+	for i, r := range rows {
+		me.writeIndent(r.depth)
+		me.buf.WriteString(lines[i])
+		me.buf.WriteByte('\n')
+	}
+}
+
+func (me *printer) key(parts []string) string {
+	if !me.opts.normalizeQuotes {
+		return strings.Join(parts, ".")
+	}
+
+	normalized := make([]string, len(parts))
+	for i, part := range parts {
+		if unquoted := unquote(part); unquoted != part && bareKey.MatchString(unquoted) {
+			normalized[i] = unquoted
+		} else {
+			normalized[i] = me.string(part)
+		}
+	}
+	return strings.Join(normalized, ".")
+}
+
+// string turns a literal string into a basic string when normalizing quotes and nothing needs escaping
+func (me *printer) string(text string) string {
+	if !me.opts.normalizeQuotes || !strings.HasPrefix(text, "'") || strings.HasPrefix(text, "'''") {
+		return text
+	}
+
+	content := text[1 : len(text)-1]
+	if strings.ContainsFunc(content, func(r rune) bool { return r == '"' || r == '\\' || r < ' ' || r == 0x7f }) {
+		return text
+	}
+
+	return `"` + content + `"`
+}
+
+func (me *printer) value(v *value, depth int) string {
+	switch v.kind {
+	case valueInlineTable:
+		if len(v.entries) == 0 {
+			return "{}"
+		}
+		entries := make([]string, 0, len(v.entries))
+		for _, e := range v.entries {
+			entries = append(entries, me.key(e.key)+" = "+me.value(e.value, depth))
+		}
+		return "{ " + strings.Join(entries, ", ") + " }"
+	case valueArray:
+		return me.array(v, depth)
+	default:
+		return me.string(v.text)
+	}
+}
+
+// array keeps an array on one line, unless it was written over several lines, in which case every
+// element gets its own indented line and a trailing comma
+func (me *printer) array(v *value, depth int) string {
+	if !v.multiline {
+		values := make([]string, 0, len(v.elements))
+		for _, elem := range v.elements {
+			values = append(values, me.value(elem.value, depth))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+
+	indent := strings.Repeat(me.indent, depth+1)
+
+	var sb strings.Builder
+	sb.WriteString("[\n")
+	for _, elem := range v.elements {
+		for _, c := range elem.leading {
+			sb.WriteString(indent + c + "\n")
+		}
+		sb.WriteString(indent + me.value(elem.value, depth+1) + ",")
+		if elem.trailing != "" {
+			sb.WriteString(" " + elem.trailing)
+		}
+		sb.WriteString("\n")
+	}
+	for _, c := range v.dangling {
+		sb.WriteString(indent + c + "\n")
+	}
+	sb.WriteString(strings.Repeat(me.indent, depth) + "]")
+
+	return sb.String()
+}
+
+// collapseBlankLines drops blank lines at the start and end of the document and keeps at most one in a row
+func collapseBlankLines(items []*item) []*item {
+	collapsed := []*item{}
+	for _, it := range items {
+		if it.kind == itemBlank && (len(collapsed) == 0 || collapsed[len(collapsed)-1].kind == itemBlank) {
+			continue
+		}
+		collapsed = append(collapsed, it)
+	}
+	for len(collapsed) > 0 && collapsed[len(collapsed)-1].kind == itemBlank {
+		collapsed = collapsed[:len(collapsed)-1]
+	}
+	return collapsed
+}
+
+// tableDepths indents every table by the number of its parent tables that have their own header,
+// comments directly above a header are indented with it
+func tableDepths(items []*item) []int {
+	depths := make([]int, len(items))
+	declared := map[string]bool{}
+
+	depth := 0
+	for i, it := range items {
+		if it.kind == itemHeader {
+			parts := make([]string, len(it.header.key))
+			for j, part := range it.header.key {
+				parts[j] = unquote(part)
+			}
+			depth = 0
+			for j := 1; j < len(parts); j++ {
+				if declared[strings.Join(parts[:j], "\x00")] {
+					depth++
+				}
+			}
+			declared[strings.Join(parts, "\x00")] = true
+		}
+		depths[i] = depth
+	}
+
+	for i := len(items) - 1; i > 0; i-- {
+		if items[i-1].kind == itemComment && (items[i].kind == itemHeader || items[i].kind == itemComment) {
+			depths[i-1] = depths[i]
+		}
+	}
+
+	return depths
+}
+
+// sortEntries sorts the entries of every block of lines between headers and blank lines by key,
+// comments directly above an entry move with it
+func sortEntries(items []*item, depths []int) ([]*item, []int) {
+	type group struct {
+		items  []*item
+		depths []int
+		key    string
+	}
+
+	sortedItems := make([]*item, 0, len(items))
+	sortedDepths := make([]int, 0, len(depths))
+
+	groups := []*group{}
+	current := &group{}
+	flush := func() {
+		slices.SortStableFunc(groups, func(a, b *group) int {
+			return strings.Compare(a.key, b.key)
+		})
+		for _, g := range append(groups, current) {
+			sortedItems = append(sortedItems, g.items...)
+			sortedDepths = append(sortedDepths, g.depths...)
+		}
+		groups = groups[:0]
+		current = &group{}
+	}
+
+	for i, it := range items {
+		switch it.kind {
+		case itemComment:
+			current.items = append(current.items, it)
+			current.depths = append(current.depths, depths[i])
+		case itemEntry:
+			current.items = append(current.items, it)
+			current.depths = append(current.depths, depths[i])
+			parts := make([]string, len(it.entry.key))
+			for j, part := range it.entry.key {
+				parts[j] = unquote(part)
+			}
+			current.key = strings.Join(parts, ".")
+			groups = append(groups, current)
+			current = &group{}
+		default:
+			flush()
+			sortedItems = append(sortedItems, it)
+			sortedDepths = append(sortedDepths, depths[i])
+		}
+	}
+	flush()
+
+	return sortedItems, sortedDepths
+}
+
+func unquote(part string) string {
+	if len(part) >= 2 && (part[0] == '"' || part[0] == '\'') {
+		return part[1 : len(part)-1]
+	}
+	return part
+}
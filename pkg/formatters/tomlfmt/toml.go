@@ -0,0 +1,74 @@
+package tomlfmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+type Formatter struct {
+}
+
+var _ format.Provider = (*Formatter)(nil)
+
+func NewFormatter() *Formatter {
+	return &Formatter{}
+}
+
+func (me *Formatter) Targets() []string {
+	return []string{"*.toml"}
+}
+
+type options struct {
+	sortKeys bool
+	// normalizeQuotes turns literal strings into basic strings and quoted keys into bare keys where possible
+	normalizeQuotes bool
+}
+
+// Options are the editorconfig keys the toml formatter reads
+var Options = format.RegisterOptions("toml",
+	sortKeysOption,
+	normalizeQuotesOption,
+)
+
+var (
+	sortKeysOption        = &format.Option{Key: "toml_sort_keys", Type: format.OptionTypeBool, Default: "false", Doc: "sort keys within each block of keys"}
+	normalizeQuotesOption = &format.Option{Key: "toml_normalize_quotes", Type: format.OptionTypeBool, Default: "false", Doc: "prefer basic strings and bare keys where nothing needs escaping"}
+)
+
+func getOptions(cfg format.Configuration) *options {
+	return &options{
+		sortKeys:        sortKeysOption.Bool(cfg),
+		normalizeQuotes: normalizeQuotesOption.Bool(cfg),
+	}
+}
+
+func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	src, err := io.ReadAll(read)
+	if err != nil {
+		return nil, errors.Errorf("reading toml: %w", err)
+	}
+
+	opts := getOptions(cfg)
+
+	items, err := parse(strings.TrimPrefix(string(src), "\uFEFF"))
+	if err != nil {
+		return nil, errors.Errorf("parsing toml: %w", err)
+	}
+
+	p := &printer{
+		opts:   opts,
+		indent: strings.Repeat(" ", cfg.IndentSize()),
+	}
+	if cfg.UseTabs() {
+		p.indent = "\t"
+	}
+
+	p.document(items)
+
+	return bytes.NewReader(p.buf.Bytes()), nil
+}
@@ -0,0 +1,207 @@
+package tomlfmt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/diff"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/tomlfmt"
+)
+
+func formatTOML(ctx context.Context, cfg format.Configuration, src string) (string, error) {
+	reader, err := tomlfmt.NewFormatter().Format(ctx, cfg, bytes.NewReader([]byte(src)))
+	if err != nil {
+		return "", err
+	}
+
+	result, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		useTabs  bool
+		indent   int
+		raw      map[string]string
+		src      string
+		expected string
+	}{
+		{
+			name:    "align_assignments_and_comments",
+			useTabs: true,
+			indent:  4,
+			src: `[package]
+name="retab" # the name
+version = "0.1.0"   # the version
+edition = "2021"
+
+rust-version = "1.80"
+`,
+			expected: `[package]
+name    = "retab" # the name
+version = "0.1.0" # the version
+edition = "2021"
+
+rust-version = "1.80"
+`,
+		},
+		{
+			name:    "nested_tables_are_indented",
+			useTabs: true,
+			indent:  4,
+			src: `[tool.poetry]
+name = "x"
+
+# the deps
+[tool.poetry.dependencies]
+python = "^3.12"
+
+[[tool.poetry.source]]
+name = "pypi"
+
+[other.table]
+a = 1
+`,
+			expected: `[tool.poetry]
+name = "x"
+
+	# the deps
+	[tool.poetry.dependencies]
+	python = "^3.12"
+
+	[[tool.poetry.source]]
+	name = "pypi"
+
+[other.table]
+a = 1
+`,
+		},
+		{
+			name:    "multiline_arrays",
+			useTabs: false,
+			indent:  2,
+			src: `linters = [
+    "gofmt",  # format
+        # vet it
+    "govet"
+]
+short = [ 1,2,3 ]
+inline = {a=1,  b = [ "x" ]}
+`,
+			expected: `linters = [
+  "gofmt", # format
+  # vet it
+  "govet",
+]
+short  = [1, 2, 3]
+inline = { a = 1, b = ["x"] }
+`,
+		},
+		{
+			name:    "strings_and_dates_are_kept",
+			useTabs: true,
+			indent:  4,
+			src: `desc = """
+  keep
+    me"""
+path = 'C:\Users'
+when = 1979-05-27 07:32:00
+`,
+			expected: `desc = """
+  keep
+    me"""
+path = 'C:\Users'
+when = 1979-05-27 07:32:00
+`,
+		},
+		{
+			name:    "sort_keys_within_blocks",
+			useTabs: true,
+			indent:  4,
+			raw:     map[string]string{"toml_sort_keys": "true"},
+			src: `[deps]
+zeta = 1
+# about alpha
+alpha = 2
+
+gamma = 3
+beta = 4
+`,
+			expected: `[deps]
+# about alpha
+alpha = 2
+zeta  = 1
+
+beta  = 4
+gamma = 3
+`,
+		},
+		{
+			name:    "normalize_quotes",
+			useTabs: true,
+			indent:  4,
+			raw:     map[string]string{"toml_normalize_quotes": "true"},
+			src: `"bare-ok" = 'single'
+"needs quotes" = 'has "quotes"'
+'path' = 'C:\Users'
+`,
+			expected: `bare-ok        = "single"
+"needs quotes" = 'has "quotes"'
+path           = 'C:\Users'
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := map[string]string{}
+			for k, v := range tt.raw {
+				raw[k] = v
+			}
+
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(tt.useTabs).Maybe()
+			cfg.EXPECT().IndentSize().Return(tt.indent).Maybe()
+			cfg.EXPECT().Raw().Return(raw).Maybe()
+
+			formatted, err := formatTOML(t.Context(), cfg, tt.src)
+			require.NoError(t, err, "formatting should succeed")
+
+			diff.Require(t).Want(tt.expected).Got(formatted).Equals()
+
+			again, err := formatTOML(t.Context(), cfg, formatted)
+			require.NoError(t, err, "formatting the output should succeed")
+			diff.Require(t).Want(formatted).Got(again).Equals()
+		})
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{name: "missing_equals", src: "a 1\n"},
+		{name: "unterminated_string", src: "a = \"b\n"},
+		{name: "unterminated_array", src: "a = [1, 2\n"},
+		{name: "unclosed_header", src: "[a\n"},
+		{name: "two_values", src: "a = 1 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := formatTOML(t.Context(), format.NewBasicConfigurationProvider(true, 4), tt.src)
+			require.Error(t, err, "formatting invalid toml should fail")
+		})
+	}
+}
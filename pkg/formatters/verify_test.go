@@ -0,0 +1,124 @@
+package formatters_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/gen/mocks/pkg/formatmock"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/dockerfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/gofmt"
+	"github.com/walteh/retab/v2/pkg/formatters/hclfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/protofmt"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/yamlfmt"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider format.Provider
+		src      string
+		raw      map[string]string
+		// changed is the formatted src with one value changed
+		changed func(formatted string) string
+		wantErr string
+	}{
+		{
+			name:     "hcl",
+			provider: hclfmt.NewFormatter(),
+			src:      "a {\n  yy  = [1,2]\n  x     =     \"one\"\n  t = <<EOT\n    b\n    EOT\n}\n",
+			changed:  func(s string) string { return strings.Replace(s, "one", "two", 1) },
+			wantErr:  `LiteralValueExpr "one" at line 3 of the input became LiteralValueExpr "two"`,
+		},
+		{
+			name:     "proto",
+			provider: protofmt.NewFormatter(),
+			src:      "syntax = \"proto3\";\nimport \"b.proto\";\npackage a;\nimport \"a.proto\";\nmessage A {\n  int32   a   = 1;;\n}\n",
+			changed:  func(s string) string { return strings.Replace(s, "= 1", "= 2", 1) },
+			wantErr:  `UintLiteralNode "1" at line 6 of the input became UintLiteralNode "2"`,
+		},
+		{
+			name:     "yaml",
+			provider: yamlfmt.NewFormatter(),
+			src:      "a:\n  - b:    1\n  - c: |\n      x\n      y\n",
+			changed:  func(s string) string { return strings.Replace(s, "1", "true", 1) },
+			wantErr:  `Scalar "!!int 1" at line 2 of the input became Scalar "!!bool true"`,
+		},
+		{
+			name:     "yaml_block_scalar_reindented",
+			provider: yamlfmt.NewFormatter(),
+			src:      "a:\n  - c: |\n      x\n        y\n",
+			changed:  func(s string) string { return strings.Replace(s, "  y", "y", 1) },
+			wantErr:  `Scalar "!!str x\n  y\n" at line 2 of the input became Scalar "!!str x\ny\n"`,
+		},
+		{
+			name:     "yaml_embedded_shell",
+			provider: yamlfmt.NewFormatter(),
+			src:      "run: |\n  if true;then\n  echo   a\n  fi\nx:    1\n",
+			raw:      map[string]string{"yaml_shell_paths": "run"},
+			changed:  func(s string) string { return strings.Replace(s, "echo a", "echo b", 1) },
+			wantErr:  `Lit "a" at line 3 of the input became Lit "b"`,
+		},
+		{
+			name:     "shell",
+			provider: shfmt.NewFormatter(),
+			src:      "if true;then\necho   a|cat\ncat <<-EOF\n\tbody\nEOF\nfi\n",
+			changed:  func(s string) string { return strings.Replace(s, "|", "||", 1) },
+			wantErr:  `BinaryCmd "|" at line 2 of the input became BinaryCmd "||"`,
+		},
+		{
+			name:     "shell_heredoc_reindented",
+			provider: shfmt.NewFormatter(),
+			src:      "if true;then\ncat <<EOF\n  a\n    b\nEOF\nfi\n",
+			changed:  func(s string) string { return strings.Replace(s, "    b", "  b", 1) },
+			wantErr:  `Lit "  a\n    b\n" at line 3 of the input became Lit "  a\n  b\n"`,
+		},
+		{
+			name:     "dockerfile",
+			provider: dockerfmt.NewFormatter(),
+			src:      "from alpine\nrun   echo   a \\\n  && echo b\n",
+			changed:  func(s string) string { return strings.Replace(s, "alpine", "debian", 1) },
+			wantErr:  `Argument "alpine" at line 1 of the input became Argument "debian"`,
+		},
+		{
+			name:     "go",
+			provider: gofmt.NewFormatter(),
+			src:      "package a\n\nimport (\n\"os\"\n\"fmt\"\n)\n\nfunc f() {\nx :=   0X1\nfmt.Println(x, os.Args)\n}\n",
+			changed:  func(s string) string { return strings.Replace(s, ":=", "=", 1) },
+			wantErr:  `AssignStmt ":=" at line 9 of the input became AssignStmt "="`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(true).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+			raw := tt.raw
+			if raw == nil {
+				raw = map[string]string{}
+			}
+			cfg.EXPECT().Raw().Return(raw).Maybe()
+
+			r, err := tt.provider.Format(ctx, cfg, strings.NewReader(tt.src))
+			require.NoError(t, err, "formatting should succeed")
+
+			formatted, err := io.ReadAll(r)
+			require.NoError(t, err, "reading the output should succeed")
+			require.NotEqual(t, tt.src, string(formatted), "the source should need formatting")
+
+			require.NoError(t, format.VerifyEquivalent(ctx, tt.provider, cfg, []byte(tt.src), formatted), "formatting should keep the syntax tree")
+			require.NoError(t, format.VerifyIdempotent(ctx, tt.provider, cfg, formatted), "formatting should be idempotent")
+
+			err = format.VerifyEquivalent(ctx, tt.provider, cfg, []byte(tt.src), []byte(tt.changed(string(formatted))))
+			require.Error(t, err, "a changed value should fail verification")
+			assert.Contains(t, err.Error(), tt.wantErr, "the error should point at the changed node")
+		})
+	}
+}
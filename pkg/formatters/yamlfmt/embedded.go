@@ -0,0 +1,216 @@
+package yamlfmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
+	"github.com/walteh/yaml"
+	"gitlab.com/tozd/go/errors"
+)
+
+// ShellSchemas are the presets for yaml_shell_schema, key paths of block scalars that hold shell scripts.
+// A path element of * matches any key or sequence index, ** matches any number of elements.
+var ShellSchemas = map[string][]string{
+	"github-actions": {
+		"jobs.*.steps.*.run",
+		"runs.steps.*.run",
+	},
+	"taskfile": {
+		"tasks.*.cmds.*",
+		"tasks.*.cmds.*.cmd",
+		"tasks.*.cmd",
+		"tasks.*.status.*",
+		"tasks.*.preconditions.*",
+		"tasks.*.preconditions.*.sh",
+		"**.vars.*.sh",
+	},
+	"gitlab-ci": {
+		"*.script",
+		"*.script.*",
+		"*.before_script",
+		"*.before_script.*",
+		"*.after_script",
+		"*.after_script.*",
+		"before_script.*",
+		"after_script.*",
+		"default.before_script.*",
+		"default.after_script.*",
+	},
+	"docker-compose": {
+		"services.*.command",
+	},
+}
+
+var (
+	shellSchemaOption = &format.Option{Key: "yaml_shell_schema", Type: format.OptionTypeList, Values: slices.Sorted(maps.Keys(ShellSchemas)), Doc: "presets of key paths whose block scalars are formatted as shell"}
+	shellPathsOption  = &format.Option{Key: "yaml_shell_paths", Type: format.OptionTypeList, Doc: "key paths whose block scalars are formatted as shell, * matches one element and ** any number"}
+)
+
+// shellPaths reads yaml_shell_schema (comma separated presets) and yaml_shell_paths (comma separated
+// key paths), embedded shell is only formatted when one of them is set
+func shellPaths(cfg format.Configuration) [][]string {
+	paths := []string{}
+	for _, schema := range shellSchemaOption.List(cfg) {
+		paths = append(paths, ShellSchemas[schema]...)
+	}
+
+	paths = append(paths, shellPathsOption.List(cfg)...)
+
+	split := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		split = append(split, strings.Split(path, "."))
+	}
+
+	return split
+}
+
+func matchPath(pattern []string, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPath(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 || (pattern[0] != "*" && pattern[0] != path[0]) {
+		return false
+	}
+	return matchPath(pattern[1:], path[1:])
+}
+
+// shellScalar is a literal block scalar holding a script, by line numbers of the formatted yaml
+type shellScalar struct {
+	path []string
+	// indicator is the 1-based line of the '|'
+	indicator int
+	value     string
+}
+
+// formatEmbeddedShell formats the literal block scalars found at paths with the shfmt provider and
+// writes them back at their original indentation, like dockerfmt does for RUN instructions.
+// Scripts that do not parse are left as they are.
+func formatEmbeddedShell(ctx context.Context, cfg format.Configuration, paths [][]string, src []byte) ([]byte, error) {
+	scalars := []*shellScalar{}
+
+	dec := yaml.NewDecoder(bytes.NewReader(src))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Errorf("decoding yaml: %w", err)
+		}
+		collectShellScalars(&doc, []string{}, paths, &scalars)
+	}
+
+	lines := strings.Split(string(src), "\n")
+
+	// replace from the bottom up so earlier line numbers stay valid
+	for i := len(scalars) - 1; i >= 0; i-- {
+		lines = replaceBlockScalar(ctx, cfg, lines, scalars[i])
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+func collectShellScalars(node *yaml.Node, path []string, paths [][]string, out *[]*shellScalar) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectShellScalars(child, path, paths, out)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			collectShellScalars(node.Content[i+1], append(path[:len(path):len(path)], node.Content[i].Value), paths, out)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			collectShellScalars(child, append(path[:len(path):len(path)], strconv.Itoa(i)), paths, out)
+		}
+	case yaml.ScalarNode:
+		if isShellScalar(node, path, paths) {
+			*out = append(*out, &shellScalar{path: path, indicator: node.Line, value: node.Value})
+		}
+	}
+}
+
+// isShellScalar reports whether node, found at path, is a literal block scalar formatted as shell
+func isShellScalar(node *yaml.Node, path []string, paths [][]string) bool {
+	if node.Kind != yaml.ScalarNode || node.Style&yaml.LiteralStyle == 0 {
+		return false
+	}
+	for _, pattern := range paths {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func replaceBlockScalar(ctx context.Context, cfg format.Configuration, lines []string, scalar *shellScalar) []string {
+	header := blockScalarHeader.FindStringSubmatch(lines[scalar.indicator-1])
+	// an explicit indentation indicator (|2) fixes the indentation, leave those alone
+	if header == nil || strings.ContainsAny(header[2], "123456789") {
+		return lines
+	}
+
+	start := scalar.indicator
+	indent := ""
+	for i := start; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "" {
+			indent = lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " "))]
+			break
+		}
+	}
+	if indent == "" {
+		return lines
+	}
+
+	// the block ends before the first non-empty line that is indented less, trailing blank lines are
+	// kept as they are because they belong to the chomping of the scalar
+	end := start
+	for i := start; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if !strings.HasPrefix(lines[i], indent) {
+			break
+		}
+		end = i + 1
+	}
+
+	logger := zerolog.Ctx(ctx).With().Str("key", strings.Join(scalar.path, ".")).Int("line", scalar.indicator).Logger()
+
+	r, err := shfmt.NewFormatter().Format(ctx, cfg, strings.NewReader(scalar.value))
+	if err != nil {
+		logger.Warn().Err(err).Msg("leaving embedded shell unformatted")
+		return lines
+	}
+	formatted, err := io.ReadAll(r)
+	if err != nil {
+		logger.Warn().Err(err).Msg("leaving embedded shell unformatted")
+		return lines
+	}
+
+	body := strings.Split(strings.TrimRight(string(formatted), "\n"), "\n")
+	for i, line := range body {
+		if line != "" {
+			body[i] = indent + line
+		}
+	}
+
+	return append(lines[:start:start], append(body, lines[end:]...)...)
+}
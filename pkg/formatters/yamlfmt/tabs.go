@@ -0,0 +1,165 @@
+package yamlfmt
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+// yaml_tabs decides what happens when the configuration asks for tabs, which yaml does not allow
+// for indentation
+const (
+	// TabsSpaces indents with four spaces instead
+	TabsSpaces = "spaces"
+	// TabsError fails the format
+	TabsError = "error"
+	// TabsVisual indents with tabs that ExpandTabs turns back into spaces for yaml tooling
+	TabsVisual = "visual"
+)
+
+var tabsOption = &format.Option{
+	Key:     "yaml_tabs",
+	Type:    format.OptionTypeEnum,
+	Default: TabsSpaces,
+	Values:  []string{TabsSpaces, TabsError, TabsVisual},
+	Doc:     "what indent_style = tab means for yaml: indent with spaces, fail, or write visual tabs",
+}
+
+// blockScalarHeader matches the end of a line that opens a literal or folded block scalar, the | or
+// > with its indentation and chomping indicators followed by an optional comment
+var blockScalarHeader = regexp.MustCompile(`(?:^|\s)([|>])([1-9][+-]?|[+-][1-9]?)?(?:\s+#.*)?\s*$`)
+
+func opensBlockScalar(line []byte) bool {
+	trimmed := bytes.TrimLeft(line, " \t")
+	return !bytes.HasPrefix(trimmed, []byte("#")) && blockScalarHeader.Match(trimmed)
+}
+
+func isBlank(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
+
+// leading counts the tabs that lead line and the spaces right after them
+func leading(line []byte) (tabs int, spaces int) {
+	tabs = len(line) - len(bytes.TrimLeft(line, "\t"))
+	spaces = len(line) - tabs - len(bytes.TrimLeft(line[tabs:], " "))
+	return tabs, spaces
+}
+
+// ExpandTabs replaces every tab that leads a line with width spaces. In the body of a block scalar
+// only the tabs of the block's indentation are replaced, the tabs after them are content.
+func ExpandTabs(src []byte, width int) []byte {
+	lines := bytes.Split(src, []byte("\n"))
+
+	// header is the indentation of the line that opened the block scalar we are in, -1 outside of
+	// one, and body the tabs and spaces that indent its first line, -1 before it
+	header, bodyTabs, bodySpaces := -1, -1, -1
+	for i, line := range lines {
+		tabs, spaces := leading(line)
+
+		if header >= 0 {
+			if bodyTabs < 0 && !isBlank(line) {
+				if tabs*width+spaces > header {
+					bodyTabs, bodySpaces = tabs, spaces
+				} else {
+					header = -1
+				}
+			}
+			if header >= 0 && (isBlank(line) || tabs > bodyTabs || (tabs == bodyTabs && spaces >= bodySpaces)) {
+				tabs = min(tabs, max(bodyTabs, 0))
+				lines[i] = append(bytes.Repeat([]byte(" "), tabs*width), line[tabs:]...)
+				continue
+			}
+			header = -1
+		}
+
+		if tabs > 0 {
+			lines[i] = append(bytes.Repeat([]byte(" "), tabs*width), line[tabs:]...)
+		}
+		if opensBlockScalar(lines[i]) {
+			header, bodyTabs, bodySpaces = len(lines[i])-len(bytes.TrimLeft(lines[i], " ")), -1, -1
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// CollapseSpaces replaces every run of width spaces that leads a line with a tab, the spaces left
+// over are kept after the tabs. Lines whose leading spaces are followed by a tab are left alone
+// because ExpandTabs could not tell the two apart. In the body of a block scalar only the spaces
+// of the block's indentation are collapsed, like ExpandTabs only expands those.
+func CollapseSpaces(src []byte, width int) []byte {
+	lines := bytes.Split(src, []byte("\n"))
+
+	// header is the indentation of the line that opened the block scalar we are in, -1 outside of
+	// one, and body the indentation of its first line, -1 before it
+	header, body := -1, -1
+	for i, line := range lines {
+		rest := bytes.TrimLeft(line, " ")
+		spaces := len(line) - len(rest)
+
+		if header >= 0 {
+			if body < 0 && !isBlank(line) {
+				if spaces > header {
+					body = spaces
+				} else {
+					header = -1
+				}
+			}
+			if header >= 0 && (isBlank(line) || spaces >= body) {
+				if body >= 0 && spaces >= body {
+					lines[i] = append(bytes.Repeat([]byte("\t"), body/width), line[body-body%width:]...)
+				}
+				continue
+			}
+			header = -1
+		}
+
+		if opensBlockScalar(line) {
+			header, body = spaces, -1
+		}
+		if spaces < width || bytes.HasPrefix(rest, []byte("\t")) {
+			continue
+		}
+		lines[i] = append(append(bytes.Repeat([]byte("\t"), spaces/width), bytes.Repeat([]byte(" "), spaces%width)...), rest...)
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// ToVisualTabs collapses the indentation of space indented yaml into tabs, and fails when
+// expanding the result would not give back src
+func ToVisualTabs(src []byte, width int) ([]byte, error) {
+	out := CollapseSpaces(src, width)
+
+	back := bytes.Split(ExpandTabs(out, width), []byte("\n"))
+	for i, line := range bytes.Split(src, []byte("\n")) {
+		if i >= len(back) || !bytes.Equal(line, back[i]) {
+			return nil, errors.Errorf("yaml_tabs = visual: line %d does not convert back to the same spaces", i+1)
+		}
+	}
+
+	return out, nil
+}
+
+// spacesConfiguration is cfg indenting with indent spaces, for the scripts embedded in yaml that
+// asks for tabs
+type spacesConfiguration struct {
+	format.Configuration
+	indent int
+}
+
+func (me *spacesConfiguration) UseTabs() bool {
+	return false
+}
+
+func (me *spacesConfiguration) IndentSize() int {
+	return me.indent
+}
+
+func (me *spacesConfiguration) Raw() map[string]string {
+	raw := me.Configuration.Raw()
+	raw["indent_style"] = "space"
+	raw["indent_size"] = strconv.Itoa(me.indent)
+	return raw
+}
@@ -0,0 +1,90 @@
+package yamlfmt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
+	"github.com/walteh/yaml"
+	"gitlab.com/tozd/go/errors"
+)
+
+var _ format.TreeProvider = (*Formatter)(nil)
+
+var kinds = map[yaml.Kind]string{
+	yaml.DocumentNode: "Document",
+	yaml.SequenceNode: "Sequence",
+	yaml.MappingNode:  "Mapping",
+	yaml.ScalarNode:   "Scalar",
+	yaml.AliasNode:    "Alias",
+}
+
+// Tree decodes the yaml node tree of every document of src. Scalars are compared by their tag and
+// value, not the style they are written in, except the scripts formatted as shell, which are
+// compared by their shell tree.
+func (me *Formatter) Tree(ctx context.Context, cfg format.Configuration, src []byte) ([]format.Node, error) {
+	orig := src
+	if cfg.UseTabs() && tabsOption.String(cfg) == TabsVisual {
+		src = ExpandTabs(src, VisualWidth(cfg))
+	}
+
+	tree := &format.TreeBuilder{}
+	paths := shellPaths(cfg)
+
+	dec := yaml.NewDecoder(bytes.NewReader(src))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Errorf("failed to parse yaml: %w", diagnostic(orig, err))
+		}
+		walkNode(ctx, cfg, tree, &doc, []string{}, paths)
+	}
+
+	return tree.Nodes(), nil
+}
+
+// walkNode adds node, found at the key path path, to tree
+func walkNode(ctx context.Context, cfg format.Configuration, tree *format.TreeBuilder, node *yaml.Node, path []string, paths [][]string) {
+	text := ""
+	var script []format.Node
+	switch node.Kind {
+	case yaml.ScalarNode:
+		text = node.ShortTag() + " " + node.Value
+		if isShellScalar(node, path, paths) {
+			// scripts that do not parse are left unformatted, so their text is compared
+			if nodes, err := shfmt.NewFormatter().Tree(ctx, cfg, []byte(node.Value)); err == nil {
+				text, script = node.ShortTag()+" shell", nodes
+			}
+		}
+	case yaml.AliasNode:
+		text = "*" + node.Value
+	}
+	if node.Anchor != "" {
+		text = "&" + node.Anchor + " " + text
+	}
+
+	tree.Enter(kinds[node.Kind], text, node.Line)
+	tree.Embed(script, node.Line+1)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkNode(ctx, cfg, tree, node.Content[i], path, paths)
+			walkNode(ctx, cfg, tree, node.Content[i+1], append(path[:len(path):len(path)], node.Content[i].Value), paths)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			walkNode(ctx, cfg, tree, child, append(path[:len(path):len(path)], strconv.Itoa(i)), paths)
+		}
+	default:
+		for _, child := range node.Content {
+			walkNode(ctx, cfg, tree, child, path, paths)
+		}
+	}
+	tree.Leave()
+}
@@ -4,11 +4,11 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"regexp"
 	"strconv"
 
 	"github.com/google/yamlfmt"
 	"github.com/google/yamlfmt/formatters/basic"
-	"github.com/mitchellh/mapstructure"
 	"github.com/walteh/retab/v2/pkg/format"
 	"gitlab.com/tozd/go/errors"
 )
@@ -18,6 +18,9 @@ type Formatter struct {
 
 var _ format.Provider = (*Formatter)(nil)
 
+// directives move with the block they are in, since the indentation of yaml is its structure
+var directives = format.HashDirectives.WithReindent()
+
 func NewFormatter() *Formatter {
 	return &Formatter{}
 }
@@ -27,17 +30,33 @@ func (me *Formatter) Targets() []string {
 }
 
 func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
+	return directives.Format(ctx, cfg, read, me.formatDocument)
+}
+
+// formatDocument runs yamlfmt over the whole file
+func (me *Formatter) formatDocument(ctx context.Context, cfg format.Configuration, read io.Reader) (io.Reader, error) {
 
 	reads, err := io.ReadAll(read)
 	if err != nil {
 		return nil, err
 	}
 
-	formatter, err := getFormatter(cfg)
-	if err != nil {
-		return nil, err
+	src := reads
+	shellPaths := shellPaths(cfg)
+
+	strategy := tabsOption.String(cfg)
+	visual := cfg.UseTabs() && strategy == TabsVisual
+	if cfg.UseTabs() && strategy == TabsError {
+		return nil, errors.Errorf("yaml does not allow tabs for indentation, set yaml_tabs to %s or %s", TabsSpaces, TabsVisual)
 	}
 
+	if visual {
+		// files written with visual tabs are read as the spaces they stand for
+		reads = ExpandTabs(reads, VisualWidth(cfg))
+	}
+
+	formatter := getFormatter(cfg, visual)
+
 	// engine, err := getEngine(formatter)
 	// if err != nil {
 	// 	return nil, err
@@ -45,51 +64,117 @@ func (me *Formatter) Format(ctx context.Context, cfg format.Configuration, read
 
 	out, err := formatter.Format(reads)
 	if err != nil {
-		return nil, err
+		return nil, diagnostic(src, err)
+	}
+
+	if len(shellPaths) > 0 {
+		shellCfg := cfg
+		if cfg.UseTabs() {
+			// the yaml around the scripts is indented with spaces, so are the scripts. With visual
+			// tabs only the indentation of their block becomes tabs, the scripts keep their spaces.
+			shellCfg = &spacesConfiguration{Configuration: cfg, indent: formatter.Config.Indent}
+		}
+		out, err = formatEmbeddedShell(ctx, shellCfg, shellPaths, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if visual {
+		out, err = ToVisualTabs(out, VisualWidth(cfg))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return bytes.NewReader(out), nil
 
 }
 
-func getFormatter(cfg format.Configuration) (*basic.BasicFormatter, error) {
-	def := basic.DefaultConfig()
+// errorLine matches the errors of the yaml parser, which only know the line they are about
+var errorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
 
-	if raw := cfg.Raw(); raw != nil {
-		if maxLineLength, ok := raw["max_line_length"]; ok {
-			if val, err := strconv.Atoi(maxLineLength); err == nil {
-				def.LineLength = val
-				delete(raw, "max_line_length")
-			}
-		}
-		if padComments, ok := raw["pad_line_comments"]; ok {
-			if val, err := strconv.Atoi(padComments); err == nil {
-				def.PadLineComments = val
-				delete(raw, "pad_line_comments")
-			}
-		}
-		err := mapstructure.Decode(raw, &def)
-		if err != nil {
-			return nil, errors.Errorf("decoding raw editor config: %w", err)
-		}
+// diagnostic converts the syntax errors of the yaml parser, pointing at the start of the line they
+// are about, other errors are returned as they are
+func diagnostic(src []byte, err error) error {
+	m := errorLine.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(m[1])
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	if line < 1 || line > len(lines) {
+		return err
 	}
 
+	offset := 0
+	for _, text := range lines[:line-1] {
+		offset += len(text)
+	}
+	offset += len(lines[line-1]) - len(bytes.TrimLeft(lines[line-1], " \t"))
+
+	return format.Diagnostics{format.NewDiagnostic("yaml", src, offset, offset, m[2])}
+}
+
+// VisualWidth is the number of spaces a tab stands for with yaml_tabs = visual
+func VisualWidth(cfg format.Configuration) int {
+	return max(cfg.IndentSize(), 2)
+}
+
+// Options are the editorconfig keys the yaml formatter reads
+var Options = format.RegisterOptions("yaml",
+	maxLineLengthOption,
+	padLineCommentsOption,
+	includeDocumentStartOption,
+	disallowAnchorsOption,
+	dropMergeTagOption,
+	stripDirectivesOption,
+	shellSchemaOption,
+	shellPathsOption,
+	tabsOption,
+)
+
+var (
+	maxLineLengthOption        = &format.Option{Key: "max_line_length", Type: format.OptionTypeInt, Default: "off", Values: []string{"off"}, Doc: "fold long flow scalars at this length, off for no limit"}
+	padLineCommentsOption      = &format.Option{Key: "pad_line_comments", Type: format.OptionTypeInt, Default: "1", Doc: "the number of spaces before line comments"}
+	includeDocumentStartOption = &format.Option{Key: "include_document_start", Type: format.OptionTypeBool, Default: "false", Doc: "start every document with ---"}
+	disallowAnchorsOption      = &format.Option{Key: "disallow_anchors", Type: format.OptionTypeBool, Default: "false", Doc: "fail on anchors and aliases"}
+	dropMergeTagOption         = &format.Option{Key: "drop_merge_tag", Type: format.OptionTypeBool, Default: "false", Doc: "remove explicit !!merge tags"}
+	stripDirectivesOption      = &format.Option{Key: "strip_directives", Type: format.OptionTypeBool, Default: "false", Doc: "remove %YAML and %TAG directives"}
+)
+
+func getFormatter(cfg format.Configuration, visual bool) *basic.BasicFormatter {
+	def := basic.DefaultConfig()
+
+	def.LineLength = maxLineLengthOption.Int(cfg)
+	def.PadLineComments = padLineCommentsOption.Int(cfg)
+	def.IncludeDocumentStart = includeDocumentStartOption.Bool(cfg)
+	def.DisallowAnchors = disallowAnchorsOption.Bool(cfg)
+	def.DropMergeTag = dropMergeTagOption.Bool(cfg)
+	def.StripDirectives = stripDirectivesOption.Bool(cfg)
+
 	// Convert editor config settings to YAML formatter settings
 	def.Indent = cfg.IndentSize()
-	def.TrimTrailingWhitespace = true         // Always trim trailing whitespace
+	def.TrimTrailingWhitespace = false        // trimTrailingWhitespace does it instead
 	def.EOFNewline = true                     // Always ensure newline at EOF
 	def.LineEnding = yamlfmt.LineBreakStyleLF // Always use LF line breaks
 	def.ScanFoldedAsLiteral = false
 	def.IndentRootArray = true
 
 	// Handle indentation style
-	if cfg.UseTabs() {
-		// problem 843124 with yaml: tabs are not supported
+	def.ArrayIndent = def.Indent - 2
+	switch {
+	case visual:
+		// yaml does not allow tabs, so indent with spaces that become tabs afterwards, with the
+		// dashes of sequences on a tab stop
+		def.Indent = VisualWidth(cfg)
+		def.ArrayIndent = def.Indent
+	case cfg.UseTabs():
+		// yaml_tabs = spaces
 		def.Indent = 4
+		def.ArrayIndent = def.Indent - 2
 	}
 
-	def.ArrayIndent = def.Indent - 2
-
 	if def.ArrayIndent <= 0 {
 		def.IndentlessArrays = true
 	}
@@ -101,8 +186,21 @@ func getFormatter(cfg format.Configuration) (*basic.BasicFormatter, error) {
 	f := basic.BasicFormatter{
 		Config:       def,
 		YAMLFeatures: basic.ConfigureYAMLFeaturesFromConfig(def),
-		Features:     basic.ConfigureFeaturesFromConfig(def),
+		Features:     append(basic.ConfigureFeaturesFromConfig(def), trimTrailingWhitespace),
 	}
 
-	return &f, nil
+	return &f
+}
+
+// trimTrailingWhitespace trims the spaces that end lines, like yamlfmt's trim_trailing_whitespace
+// without dropping the last line break, which a block scalar at the end of the file keeps
+var trimTrailingWhitespace = yamlfmt.Feature{
+	Name: "Trim Trailing Whitespace",
+	BeforeAction: func(ctx context.Context, content []byte) (context.Context, []byte, error) {
+		lines := bytes.Split(content, []byte("\n"))
+		for i, line := range lines {
+			lines[i] = bytes.TrimRight(bytes.TrimSuffix(line, []byte("\r")), " ")
+		}
+		return ctx, bytes.Join(lines, []byte("\n")), nil
+	},
 }
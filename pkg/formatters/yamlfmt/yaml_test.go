@@ -60,3 +60,324 @@ cmds:
 
 	diff.Require(t).Want(expected).Got(actual).Equals()
 }
+
+func TestEmbeddedShell(t *testing.T) {
+	tests := []struct {
+		name     string
+		tabs     bool
+		raw      map[string]string
+		src      string
+		expected string
+	}{
+		{
+			name: "disabled_by_default",
+			raw:  map[string]string{},
+			src: `jobs:
+    build:
+        steps:
+          - run: |
+                echo   hi
+name: ci
+`,
+			expected: `jobs:
+    build:
+        steps:
+          - run: |
+                echo   hi
+name: ci
+`,
+		},
+		{
+			name: "github_actions",
+			raw:  map[string]string{"yaml_shell_schema": "github-actions"},
+			src: `jobs:
+  build:
+    steps:
+      - run: |
+          if [ -f x ]; then
+          echo   hi
+          fi
+      - run: echo   single
+      - with:
+          run: |
+            echo   not a step
+name: ci
+`,
+			expected: `jobs:
+    build:
+        steps:
+          - run: |
+                if [ -f x ]; then
+                    echo hi
+                fi
+          - run: echo   single
+          - with:
+                run: |
+                    echo   not a step
+name: ci
+`,
+		},
+		{
+			name: "taskfile_and_custom_paths",
+			raw:  map[string]string{"yaml_shell_schema": "taskfile", "yaml_shell_paths": "scripts.*"},
+			src: `tasks:
+    build:
+        cmds:
+          - |
+            go   build ./...
+          - cmd: |
+                go   vet ./...
+scripts:
+    lint: |
+        golangci-lint   run
+version: "3"
+`,
+			expected: `tasks:
+    build:
+        cmds:
+          - |
+            go build ./...
+          - cmd: |
+                go vet ./...
+scripts:
+    lint: |
+        golangci-lint run
+version: "3"
+`,
+		},
+		{
+			name: "digits_in_the_header_comment_are_not_an_indicator",
+			raw:  map[string]string{"yaml_shell_schema": "taskfile"},
+			src: `tasks:
+    build:
+        cmds:
+          - | # step 2
+            if true;then echo hi;fi
+version: "3"
+`,
+			expected: `tasks:
+    build:
+        cmds:
+          - | # step 2
+            if true; then echo hi; fi
+version: "3"
+`,
+		},
+		{
+			name: "explicit_indentation_indicator_is_kept",
+			raw:  map[string]string{"yaml_shell_schema": "taskfile"},
+			src: `tasks:
+    build:
+        cmds:
+          - |2 # step 2
+              if true;then echo hi;fi
+version: "3"
+`,
+			expected: `tasks:
+    build:
+        cmds:
+          - |4 # step 2
+              if true;then echo hi;fi
+version: "3"
+`,
+		},
+		{
+			name: "tabs_indent_scripts_with_spaces",
+			tabs: true,
+			raw:  map[string]string{"yaml_shell_schema": "github-actions"},
+			src: `jobs:
+  build:
+    steps:
+      - run: |
+          if [ -f x ]; then
+          echo   hi
+          fi
+name: ci
+`,
+			expected: `jobs:
+    build:
+        steps:
+          - run: |
+                if [ -f x ]; then
+                    echo hi
+                fi
+name: ci
+`,
+		},
+		{
+			name: "visual_tabs_only_indent_the_block_of_scripts",
+			tabs: true,
+			raw:  map[string]string{"yaml_shell_schema": "github-actions", "yaml_tabs": "visual"},
+			src: `jobs:
+  build:
+    steps:
+      - run: |
+          if [ -f x ]; then
+          echo   hi
+          fi
+name: ci
+`,
+			expected: "jobs:\n\tbuild:\n\t\tsteps:\n\t\t\t- run: |\n\t\t\t\tif [ -f x ]; then\n\t\t\t\t    echo hi\n\t\t\t\tfi\nname: ci\n",
+		},
+		{
+			name: "invalid_shell_is_kept",
+			raw:  map[string]string{"yaml_shell_schema": "docker-compose"},
+			src: `services:
+    app:
+        command: |
+            if then (
+name: app
+`,
+			expected: `services:
+    app:
+        command: |
+            if then (
+name: app
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(tt.tabs).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+			cfg.EXPECT().Raw().RunAndReturn(func() map[string]string {
+				raw := map[string]string{}
+				for k, v := range tt.raw {
+					raw[k] = v
+				}
+				return raw
+			}).Maybe()
+
+			actual, err := formatYaml(t.Context(), cfg, []byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diff.Require(t).Want(tt.expected).Got(actual).Equals()
+		})
+	}
+}
+
+func TestInvalidOptionsUseDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]string
+	}{
+		{name: "unknown_schema", raw: map[string]string{"yaml_shell_schema": "jenkins"}},
+		{name: "pad_line_comments_not_a_number", raw: map[string]string{"pad_line_comments": "two"}},
+		{name: "bool_not_a_bool", raw: map[string]string{"include_document_start": "yes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(false).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+			cfg.EXPECT().Raw().Return(tt.raw).Maybe()
+
+			actual, err := formatYaml(t.Context(), cfg, []byte("a:   1   # c\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diff.Require(t).Want("a: 1 # c\n").Got(actual).Equals()
+		})
+	}
+}
+
+func TestTabs(t *testing.T) {
+	src := "a:\n  b:\n  - c: 1\n    d: |\n      x\n          y\ne: 2\n"
+
+	tests := []struct {
+		name     string
+		raw      map[string]string
+		src      string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "spaces_by_default",
+			src:      src,
+			expected: "a:\n    b:\n      - c: 1\n        d: |\n            x\n                y\ne: 2\n",
+		},
+		{
+			name:     "visual",
+			raw:      map[string]string{"yaml_tabs": "visual"},
+			src:      src,
+			expected: "a:\n\tb:\n\t\t- c: 1\n\t\t  d: |\n\t\t\tx\n\t\t\t    y\ne: 2\n",
+		},
+		{
+			name:     "visual_reads_tabs",
+			raw:      map[string]string{"yaml_tabs": "visual"},
+			src:      "a:\n\tb:\n\t\t- c: 1\n\t\t  d: |\n\t\t\tx\n\t\t\t\ty\ne: 2\n",
+			expected: "a:\n\tb:\n\t\t- c: 1\n\t\t  d: |\n\t\t\tx\n\t\t\t\ty\ne: 2\n",
+		},
+		{
+			name:    "error",
+			raw:     map[string]string{"yaml_tabs": "error"},
+			src:     src,
+			wantErr: true,
+		},
+		{
+			name:     "unknown_strategy_uses_spaces",
+			raw:      map[string]string{"yaml_tabs": "tabs"},
+			src:      src,
+			expected: "a:\n    b:\n      - c: 1\n        d: |\n            x\n                y\ne: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := formatmock.NewMockConfiguration(t)
+			cfg.EXPECT().UseTabs().Return(true).Maybe()
+			cfg.EXPECT().IndentSize().Return(4).Maybe()
+			cfg.EXPECT().Raw().RunAndReturn(func() map[string]string {
+				raw := map[string]string{}
+				for k, v := range tt.raw {
+					raw[k] = v
+				}
+				return raw
+			}).Maybe()
+
+			actual, err := formatYaml(t.Context(), cfg, []byte(tt.src))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("formatting should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diff.Require(t).Want(tt.expected).Got(actual).Equals()
+		})
+	}
+}
+
+func TestVisualTabsRoundTrip(t *testing.T) {
+	spaces := []byte("a:\n    b: 1\n      # c\n    \td: |\n")
+
+	tabs, err := yamlfmt.ToVisualTabs(spaces, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff.Require(t).Want("a:\n\tb: 1\n\t  # c\n    \td: |\n").Got(string(tabs)).Equals()
+	diff.Require(t).Want(string(spaces)).Got(string(yamlfmt.ExpandTabs(tabs, 4))).Equals()
+
+	// the tab that leads the second line of the scalar is content, not indentation
+	spaces = []byte("a:\n    b: |\n        x\n        \ty\n    c: 1\n")
+
+	tabs, err = yamlfmt.ToVisualTabs(spaces, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff.Require(t).Want("a:\n\tb: |\n\t\tx\n\t\t\ty\n\tc: 1\n").Got(string(tabs)).Equals()
+	diff.Require(t).Want(string(spaces)).Got(string(yamlfmt.ExpandTabs(tabs, 4))).Equals()
+
+	if _, err := yamlfmt.ToVisualTabs([]byte("a: >\n\tb\n"), 4); err == nil {
+		t.Fatal("a line that starts with a tab cannot round trip")
+	}
+}
@@ -0,0 +1,212 @@
+// Package git resolves the files and lines retab formats from a git repository. It shells out to
+// the git binary, so it behaves like git does for the user, hooks and worktrees included.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+// emptyTree is the hash of the empty tree, what a repository without commits is compared to
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// Selection is the changes whose files are formatted: the staged ones, or the ones between a ref
+// and the working tree
+type Selection struct {
+	// Staged compares the index to HEAD
+	Staged bool
+	// Since is the ref the working tree is compared to, HEAD when it is empty
+	Since string
+}
+
+// Repo is a git working tree
+type Repo struct {
+	root string
+}
+
+// Open finds the repository dir is in
+func Open(ctx context.Context, dir string) (*Repo, error) {
+	out, err := run(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, errors.Errorf("finding git repository: %w", err)
+	}
+	return &Repo{root: strings.TrimSpace(string(out))}, nil
+}
+
+// Root is the absolute path of the working tree
+func (me *Repo) Root() string {
+	return me.root
+}
+
+// Files lists the absolute paths of the files the selection added, copied, modified or renamed,
+// and of the untracked files unless only staged changes are selected
+func (me *Repo) Files(ctx context.Context, sel Selection) ([]string, error) {
+	args, err := me.diffArgs(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := me.run(ctx, append(args, "--name-only", "--diff-filter=ACMR", "-z")...)
+	if err != nil {
+		return nil, errors.Errorf("listing changed files: %w", err)
+	}
+	names := splitNull(out)
+
+	if !sel.Staged {
+		out, err := me.run(ctx, "ls-files", "--others", "--exclude-standard", "-z")
+		if err != nil {
+			return nil, errors.Errorf("listing untracked files: %w", err)
+		}
+		names = append(names, splitNull(out)...)
+	}
+
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		files = append(files, filepath.Join(me.root, filepath.FromSlash(name)))
+	}
+	return files, nil
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// ChangedLines returns the lines of path the selection added or modified, as they are numbered in
+// the new version. Lines that were only deleted leave nothing to format, and every line of an
+// untracked file is changed.
+func (me *Repo) ChangedLines(ctx context.Context, sel Selection, path string) ([]format.LineRange, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Errorf("resolving path: %w", err)
+	}
+
+	var out []byte
+	if !sel.Staged {
+		out, err = me.run(ctx, "ls-files", "--others", "--exclude-standard", "--", path)
+		if err != nil {
+			return nil, errors.Errorf("checking if '%s' is tracked: %w", path, err)
+		}
+		if len(bytes.TrimSpace(out)) > 0 {
+			return []format.LineRange{{Start: 1, End: math.MaxInt}}, nil
+		}
+	}
+
+	args, err := me.diffArgs(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err = me.run(ctx, append(args, "--unified=0", "--no-color", "--no-ext-diff", "--", path)...)
+	if err != nil {
+		return nil, errors.Errorf("diffing '%s': %w", path, err)
+	}
+
+	ranges := []format.LineRange{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		m := hunkHeader.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		if count == 0 {
+			continue
+		}
+		ranges = append(ranges, format.LineRange{Start: start, End: start + count - 1})
+	}
+
+	return ranges, nil
+}
+
+// HasUnstagedChanges reports whether the working tree copy of path differs from the index
+func (me *Repo) HasUnstagedChanges(ctx context.Context, path string) (bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false, errors.Errorf("resolving path: %w", err)
+	}
+
+	out, err := me.run(ctx, "diff", "--name-only", "--", path)
+	if err != nil {
+		return false, errors.Errorf("diffing '%s': %w", path, err)
+	}
+	return len(bytes.TrimSpace(out)) > 0, nil
+}
+
+// Add stages paths
+func (me *Repo) Add(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := []string{"add", "--"}
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return errors.Errorf("resolving path: %w", err)
+		}
+		args = append(args, path)
+	}
+	if _, err := me.run(ctx, args...); err != nil {
+		return errors.Errorf("staging files: %w", err)
+	}
+	return nil
+}
+
+func (me *Repo) diffArgs(ctx context.Context, sel Selection) ([]string, error) {
+	if sel.Staged {
+		return []string{"diff", "--cached"}, nil
+	}
+
+	if sel.Since != "" {
+		return []string{"diff", sel.Since}, nil
+	}
+
+	// a repository without commits has no HEAD, everything in it is new
+	if _, err := me.run(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return []string{"diff", emptyTree}, nil
+	}
+	return []string{"diff", "HEAD"}, nil
+}
+
+func (me *Repo) run(ctx context.Context, args ...string) ([]byte, error) {
+	return run(ctx, me.root, args...)
+}
+
+func run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.Errorf("git %s: %s: %w", args[0], msg, err)
+		}
+		return nil, errors.Errorf("git %s: %w", args[0], err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func splitNull(out []byte) []string {
+	names := []string{}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
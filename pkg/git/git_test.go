@@ -0,0 +1,124 @@
+package git_test
+
+import (
+	"context"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/git"
+)
+
+// newRepo creates a repository with one commit of files
+func newRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "-q")
+	gitCmd(t, dir, "config", "user.email", "retab@example.com")
+	gitCmd(t, dir, "config", "user.name", "retab")
+	writeFiles(t, dir, files)
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "init")
+
+	return dir
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v should succeed: %s", args, out)
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755), "creating dir should succeed")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644), "writing %s should succeed", name)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := newRepo(t, map[string]string{
+		"a.hcl":     "a = 1\n",
+		"b.hcl":     "b = 1\n",
+		"sub/c.hcl": "c = 1\n",
+	})
+
+	writeFiles(t, dir, map[string]string{
+		"a.hcl":     "a = 2\n",
+		"sub/c.hcl": "c = 2\n",
+		"new.hcl":   "new = 1\n",
+	})
+	gitCmd(t, dir, "add", "a.hcl")
+
+	repo, err := git.Open(ctx, filepath.Join(dir, "sub"))
+	require.NoError(t, err, "opening the repository from a subdirectory should succeed")
+
+	staged, err := repo.Files(ctx, git.Selection{Staged: true})
+	require.NoError(t, err, "listing staged files should succeed")
+	assert.Equal(t, []string{filepath.Join(repo.Root(), "a.hcl")}, staged, "only a.hcl should be staged")
+
+	changed, err := repo.Files(ctx, git.Selection{})
+	require.NoError(t, err, "listing changed files should succeed")
+	assert.ElementsMatch(t, []string{
+		filepath.Join(repo.Root(), "a.hcl"),
+		filepath.Join(repo.Root(), "sub/c.hcl"),
+		filepath.Join(repo.Root(), "new.hcl"),
+	}, changed, "changed files should include untracked ones")
+
+	partial, err := repo.HasUnstagedChanges(ctx, filepath.Join(dir, "sub/c.hcl"))
+	require.NoError(t, err, "checking unstaged changes should succeed")
+	assert.True(t, partial, "sub/c.hcl should have unstaged changes")
+
+	partial, err = repo.HasUnstagedChanges(ctx, filepath.Join(dir, "a.hcl"))
+	require.NoError(t, err, "checking unstaged changes should succeed")
+	assert.False(t, partial, "a.hcl should be fully staged")
+}
+
+func TestChangedLines(t *testing.T) {
+	ctx := context.Background()
+	dir := newRepo(t, map[string]string{
+		"a.hcl": "a = 1\nb = 2\nc = 3\nd = 4\ne = 5\n",
+	})
+
+	writeFiles(t, dir, map[string]string{
+		"a.hcl":   "a = 1\nB = 2\nc = 3\ne = 5\nf = 6\ng = 7\n",
+		"new.hcl": "new = 1\n",
+	})
+
+	repo, err := git.Open(ctx, dir)
+	require.NoError(t, err, "opening the repository should succeed")
+
+	ranges, err := repo.ChangedLines(ctx, git.Selection{}, filepath.Join(dir, "a.hcl"))
+	require.NoError(t, err, "diffing a.hcl should succeed")
+	assert.Equal(t, []format.LineRange{{Start: 2, End: 2}, {Start: 5, End: 6}}, ranges, "the deleted line should leave no range")
+
+	ranges, err = repo.ChangedLines(ctx, git.Selection{}, filepath.Join(dir, "new.hcl"))
+	require.NoError(t, err, "diffing new.hcl should succeed")
+	assert.Equal(t, []format.LineRange{{Start: 1, End: math.MaxInt}}, ranges, "every line of an untracked file should be changed")
+
+	gitCmd(t, dir, "add", "a.hcl")
+	ranges, err = repo.ChangedLines(ctx, git.Selection{Staged: true}, filepath.Join(dir, "a.hcl"))
+	require.NoError(t, err, "diffing staged a.hcl should succeed")
+	assert.Equal(t, []format.LineRange{{Start: 2, End: 2}, {Start: 5, End: 6}}, ranges, "staged ranges should match")
+
+	ranges, err = repo.ChangedLines(ctx, git.Selection{Since: "HEAD"}, filepath.Join(dir, "a.hcl"))
+	require.NoError(t, err, "diffing since HEAD should succeed")
+	assert.Equal(t, []format.LineRange{{Start: 2, End: 2}, {Start: 5, End: 6}}, ranges, "ranges since HEAD should match")
+}
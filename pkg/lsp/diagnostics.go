@@ -0,0 +1,41 @@
+package lsp
+
+import (
+	"github.com/walteh/retab/v2/pkg/format"
+	"gitlab.com/tozd/go/errors"
+)
+
+const diagnosticSource = "retab"
+
+// diagnosticsFromError converts the diagnostics of the native providers into lsp diagnostics.
+// It returns nil when the error carries none.
+func diagnosticsFromError(text string, err error) []Diagnostic {
+	var diags format.Diagnostics
+	if !errors.As(err, &diags) {
+		return nil
+	}
+
+	out := []Diagnostic{}
+	for _, diag := range diags {
+		severity := diagnosticSeverityError
+		if diag.Severity == format.SeverityWarning {
+			severity = diagnosticSeverityWarning
+		}
+		out = append(out, Diagnostic{
+			Range: Range{
+				Start: positionForLineColumn(text, diag.Line, diag.Column),
+				End:   positionForLineColumn(text, max(diag.EndLine, diag.Line), max(diag.EndColumn, diag.Column)),
+			},
+			Severity: severity,
+			Source:   diagnosticSource,
+			Message:  diag.Message,
+		})
+	}
+	return out
+}
+
+// positionForLineColumn converts a one based line and byte column into an lsp position
+func positionForLineColumn(text string, line int, column int) Position {
+	lineStart := offsetForPosition(text, Position{Line: line - 1})
+	return positionForOffset(text, min(lineStart+column-1, len(text)))
+}
@@ -0,0 +1,119 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// splitLines splits text into lines that keep their trailing newline
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// utf16Len returns the length of s in utf-16 code units, which is how lsp counts characters
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// positionForOffset converts a byte offset in text into an lsp position
+func positionForOffset(text string, offset int) Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	before := text[:offset]
+	line := strings.Count(before, "\n")
+	lineStart := strings.LastIndex(before, "\n") + 1
+
+	return Position{Line: line, Character: utf16Len(text[lineStart:offset])}
+}
+
+// offsetForPosition converts an lsp position into a byte offset in text, clamping
+// positions past the end of a line or of the document
+func offsetForPosition(text string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+
+	chars := 0
+	for offset < len(text) && text[offset] != '\n' && chars < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		chars += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+
+	return offset
+}
+
+// lineEdit is a replacement of whole original lines [startLine, endLine) with text
+type lineEdit struct {
+	startLine int
+	endLine   int
+	text      string
+}
+
+// computeLineEdits returns the smallest set of whole-line replacements that turn before into after
+func computeLineEdits(before string, after string) []lineEdit {
+	a := splitLines(before)
+	b := splitLines(after)
+
+	edits := []lineEdit{}
+	matcher := difflib.NewMatcherWithJunk(a, b, false, nil)
+	for _, op := range matcher.GetOpCodes() {
+		if op.Tag == 'e' {
+			continue
+		}
+		edits = append(edits, lineEdit{
+			startLine: op.I1,
+			endLine:   op.I2,
+			text:      strings.Join(b[op.J1:op.J2], ""),
+		})
+	}
+
+	return edits
+}
+
+// toTextEdits converts line edits against text into lsp text edits
+func toTextEdits(text string, edits []lineEdit) []TextEdit {
+	lines := splitLines(text)
+
+	lineOffset := func(line int) int {
+		offset := 0
+		for i := 0; i < line && i < len(lines); i++ {
+			offset += len(lines[i])
+		}
+		return offset
+	}
+
+	out := make([]TextEdit, 0, len(edits))
+	for _, edit := range edits {
+		out = append(out, TextEdit{
+			Range: Range{
+				Start: positionForOffset(text, lineOffset(edit.startLine)),
+				End:   positionForOffset(text, lineOffset(edit.endLine)),
+			},
+			NewText: edit.text,
+		})
+	}
+
+	return out
+}
@@ -0,0 +1,129 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// standard json-rpc 2.0 error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// message is any incoming request, notification or response
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// the spec requires exactly one of result or error, and a null result must still be sent,
+// so responses are split into two shapes instead of using omitempty
+
+type resultResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  any              `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   *responseError   `json:"error"`
+}
+
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// isNotification reports whether the message expects no response
+func (m *message) isNotification() bool {
+	return m.ID == nil
+}
+
+// readMessage reads a single base protocol message: a header block terminated by an empty
+// line, followed by exactly Content-Length bytes of json
+func readMessage(r *bufio.Reader) (*message, error) {
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if err != nil {
+		return nil, errors.Errorf("parsing content length: %w", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, errors.Errorf("reading message body: %w", err)
+	}
+
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, &responseError{Code: codeParseError, Message: err.Error()}
+	}
+
+	return msg, nil
+}
+
+type messageWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (me *messageWriter) write(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Errorf("marshalling message: %w", err)
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if _, err := fmt.Fprintf(me.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return errors.Errorf("writing message header: %w", err)
+	}
+
+	if _, err := me.w.Write(body); err != nil {
+		return errors.Errorf("writing message body: %w", err)
+	}
+
+	return nil
+}
+
+func (me *messageWriter) result(id *json.RawMessage, result any) error {
+	return me.write(&resultResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (me *messageWriter) error(id *json.RawMessage, err *responseError) error {
+	return me.write(&errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+func (me *messageWriter) notify(method string, params any) error {
+	return me.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
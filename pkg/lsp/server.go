@@ -0,0 +1,478 @@
+// Package lsp implements a language server that exposes the retab formatters to any
+// editor speaking the language server protocol over stdio.
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/retab/v2/pkg/editorconfig"
+	"github.com/walteh/retab/v2/pkg/format"
+	"github.com/walteh/retab/v2/pkg/formatters"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
+	"gitlab.com/tozd/go/errors"
+)
+
+type document struct {
+	uri        string
+	languageID string
+	version    int
+	text       string
+}
+
+type Server struct {
+	formatters *formatters.AutoFormatProvider
+	version    string
+
+	// editorconfig is shared by all requests so every directory is read once
+	editorconfig *editorconfig.EditorConfigConfigurationProvider
+
+	documents   map[string]*document
+	documentsMu sync.Mutex
+
+	shutdown bool
+	out      *messageWriter
+}
+
+func NewServer(fmts *formatters.AutoFormatProvider, version string) *Server {
+	return &Server{
+		formatters:   fmts,
+		version:      version,
+		editorconfig: editorconfig.NewHierarchicalConfigurationProvider(context.Background()),
+		documents:    map[string]*document{},
+	}
+}
+
+// errExitWithoutShutdown is returned when the client sends exit before shutdown, the spec
+// asks the server to exit with a non-zero code in that case
+var errExitWithoutShutdown = errors.New("exit received before shutdown")
+
+// Serve reads requests from r and writes responses to w until the client sends exit or r is closed.
+func (me *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	me.out = &messageWriter{w: w}
+	reader := bufio.NewReader(r)
+
+	for {
+		msg, err := readMessage(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var rpcErr *responseError
+			if errors.As(err, &rpcErr) {
+				if err := me.out.error(nil, rpcErr); err != nil {
+					return err
+				}
+				continue
+			}
+			return errors.Errorf("reading message: %w", err)
+		}
+
+		if msg.Method == "exit" {
+			if !me.shutdown {
+				return errExitWithoutShutdown
+			}
+			return nil
+		}
+
+		// after shutdown the spec only allows exit, requests fail and notifications are dropped
+		if me.shutdown {
+			if msg.isNotification() {
+				continue
+			}
+			if err := me.out.error(msg.ID, &responseError{Code: codeInvalidRequest, Message: "server is shut down: " + msg.Method}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := me.handle(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (me *Server) handle(ctx context.Context, msg *message) error {
+	ctx = zerolog.Ctx(ctx).With().Str("method", msg.Method).Logger().WithContext(ctx)
+
+	result, rpcErr := me.dispatch(ctx, msg)
+
+	if msg.isNotification() {
+		if rpcErr != nil {
+			zerolog.Ctx(ctx).Warn().Err(rpcErr).Msg("handling notification")
+		}
+		return nil
+	}
+
+	if rpcErr != nil {
+		return me.out.error(msg.ID, rpcErr)
+	}
+
+	return me.out.result(msg.ID, result)
+}
+
+func (me *Server) dispatch(ctx context.Context, msg *message) (any, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		return me.initialize(), nil
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration":
+		return nil, nil
+	case "shutdown":
+		me.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc := &document{
+			uri:        params.TextDocument.URI,
+			languageID: params.TextDocument.LanguageID,
+			version:    params.TextDocument.Version,
+			text:       params.TextDocument.Text,
+		}
+		me.setDocument(doc)
+		me.publishDiagnostics(ctx, doc)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc, err := me.getDocument(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) > 0 {
+			me.updateDocument(doc, params.TextDocument.Version, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		var params didSaveTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc, err := me.getDocument(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		if params.Text != nil {
+			me.updateDocument(doc, doc.version, *params.Text)
+		}
+		me.publishDiagnostics(ctx, doc)
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		me.documentsMu.Lock()
+		delete(me.documents, params.TextDocument.URI)
+		me.documentsMu.Unlock()
+		me.notifyDiagnostics(ctx, params.TextDocument.URI, nil, []Diagnostic{})
+		return nil, nil
+	case "textDocument/formatting":
+		var params documentFormattingParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return me.formatting(ctx, params.TextDocument.URI, params.Options, nil)
+	case "textDocument/rangeFormatting":
+		var params documentRangeFormattingParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return me.formatting(ctx, params.TextDocument.URI, params.Options, &params.Range)
+	case "textDocument/onTypeFormatting":
+		var params documentOnTypeFormattingParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		// only touch the line that was just finished and the one the cursor is on
+		rng := Range{Start: Position{Line: max(params.Position.Line-1, 0)}, End: params.Position}
+		return me.formatting(ctx, params.TextDocument.URI, params.Options, &rng)
+	default:
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + msg.Method}
+	}
+}
+
+func (me *Server) initialize() *initializeResult {
+	return &initializeResult{
+		Capabilities: serverCapabilities{
+			TextDocumentSync:                textDocumentSyncFull,
+			DocumentFormattingProvider:      true,
+			DocumentRangeFormattingProvider: true,
+			DocumentOnTypeFormattingProvider: &documentOnTypeFormattingOptions{
+				FirstTriggerCharacter: "}",
+				MoreTriggerCharacter:  []string{"\n", ";"},
+			},
+		},
+		ServerInfo: serverInfo{
+			Name:    "retab",
+			Version: me.version,
+		},
+	}
+}
+
+func unmarshalParams(msg *message, v any) *responseError {
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (me *Server) setDocument(doc *document) {
+	me.documentsMu.Lock()
+	defer me.documentsMu.Unlock()
+	me.documents[doc.uri] = doc
+}
+
+func (me *Server) updateDocument(doc *document, version int, text string) {
+	me.documentsMu.Lock()
+	defer me.documentsMu.Unlock()
+	doc.text = text
+	doc.version = version
+}
+
+func (me *Server) getDocument(uri string) (*document, *responseError) {
+	me.documentsMu.Lock()
+	defer me.documentsMu.Unlock()
+	doc, ok := me.documents[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "document is not open: " + uri}
+	}
+	return doc, nil
+}
+
+// formatting formats the whole document and returns the edits, or only formats the syntactic units
+// around rng when it is set
+func (me *Server) formatting(ctx context.Context, uri string, opts FormattingOptions, rng *Range) ([]TextEdit, *responseError) {
+	doc, rpcErr := me.getDocument(uri)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	me.documentsMu.Lock()
+	text := doc.text
+	me.documentsMu.Unlock()
+
+	var edits []TextEdit
+	var err error
+	if rng != nil {
+		edits, err = me.formatRange(ctx, doc, text, &opts, *rng)
+	} else {
+		var formatted string
+		if formatted, err = me.format(ctx, doc, text, &opts); err == nil {
+			edits = toTextEdits(text, computeLineEdits(text, formatted))
+		}
+	}
+	if err != nil {
+		diags := diagnosticsFromError(text, err)
+		if diags != nil {
+			// the diagnostics explain the failure better than an error popup would
+			me.notifyDiagnostics(ctx, uri, &doc.version, diags)
+			return nil, nil
+		}
+		return nil, &responseError{Code: codeInternalError, Message: err.Error()}
+	}
+
+	me.notifyDiagnostics(ctx, uri, &doc.version, []Diagnostic{})
+
+	return edits, nil
+}
+
+// publishDiagnostics runs the formatter only to surface its parse errors. Formatters that run an
+// external binary are skipped, opening or saving a file should not start a container.
+func (me *Server) publishDiagnostics(ctx context.Context, doc *document) {
+	me.documentsMu.Lock()
+	text := doc.text
+	me.documentsMu.Unlock()
+
+	if fmtr, err := me.provider(ctx, doc, filenameFromURI(doc.uri), text); err == nil && isExternal(fmtr) {
+		return
+	}
+
+	diags := []Diagnostic{}
+	if _, err := me.format(ctx, doc, text, nil); err != nil {
+		if found := diagnosticsFromError(text, err); found != nil {
+			diags = found
+		} else {
+			zerolog.Ctx(ctx).Debug().Err(err).Str("uri", doc.uri).Msg("formatting failed without a position")
+		}
+	}
+
+	me.notifyDiagnostics(ctx, doc.uri, &doc.version, diags)
+}
+
+func (me *Server) notifyDiagnostics(ctx context.Context, uri string, version *int, diags []Diagnostic) {
+	err := me.out.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         uri,
+		Version:     version,
+		Diagnostics: diags,
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("uri", uri).Msg("publishing diagnostics")
+	}
+}
+
+func (me *Server) format(ctx context.Context, doc *document, text string, opts *FormattingOptions) (string, error) {
+	filename := filenameFromURI(doc.uri)
+
+	fmtr, err := me.provider(ctx, doc, filename, text)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := format.Format(ctx, fmtr, &fallbackConfigurationProvider{editorconfig: me.editorconfig, opts: opts}, filename, strings.NewReader(text))
+	if err != nil {
+		return "", err
+	}
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return "", errors.Errorf("reading formatted content: %w", err)
+	}
+
+	return string(out), nil
+}
+
+// formatRange formats the lines of rng, a range that ends at the start of a line leaves that line out
+func (me *Server) formatRange(ctx context.Context, doc *document, text string, opts *FormattingOptions, rng Range) ([]TextEdit, error) {
+	filename := filenameFromURI(doc.uri)
+
+	fmtr, err := me.provider(ctx, doc, filename, text)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := (&fallbackConfigurationProvider{editorconfig: me.editorconfig, opts: opts}).GetConfigurationForFileType(ctx, filename)
+	if err != nil {
+		return nil, errors.Errorf("failed to get editorconfig: %w", err)
+	}
+
+	lines := format.LineRange{Start: rng.Start.Line + 1, End: rng.End.Line + 1}
+	if rng.End.Character == 0 && rng.End.Line > rng.Start.Line {
+		lines.End--
+	}
+
+	edits, err := format.FormatRanges(ctx, fmtr, cfg, []byte(text), []format.LineRange{lines})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]TextEdit, 0, len(edits))
+	for _, edit := range edits {
+		out = append(out, TextEdit{
+			Range: Range{
+				Start: positionForOffset(text, edit.Start),
+				End:   positionForOffset(text, edit.End),
+			},
+			NewText: string(edit.Text),
+		})
+	}
+
+	return out, nil
+}
+
+// provider picks the formatter from the lsp language id first, then falls back to the
+// same filename and content detection the cli uses
+func (me *Server) provider(ctx context.Context, doc *document, filename string, text string) (format.Provider, error) {
+	if fmtr, ok := me.formatters.GetFormatterByLangID(ctx, doc.languageID); ok {
+		return fmtr, nil
+	}
+
+	return me.formatters.GetFormatter(ctx, "auto", filename, bytes.NewReader([]byte(text)))
+}
+
+// isExternal reports whether fmtr formats by running a native binary or a container
+func isExternal(fmtr format.Provider) bool {
+	if lazy, ok := fmtr.(*format.LazyFormatProvider); ok {
+		fmtr = lazy.Provider()
+	}
+	_, ok := fmtr.(cmdfmt.RuntimeResolver)
+	return ok
+}
+
+// fallbackConfigurationProvider resolves .editorconfig files next to the document, and falls
+// back to the editor's own options when no section of them sets the indentation of the document
+type fallbackConfigurationProvider struct {
+	editorconfig *editorconfig.EditorConfigConfigurationProvider
+	opts         *FormattingOptions
+}
+
+func (me *fallbackConfigurationProvider) GetConfigurationForFileType(ctx context.Context, filename string) (format.Configuration, error) {
+	cfg, err := me.editorconfig.GetConfigurationForFileType(ctx, filename)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("path", filename).Msg("resolving editorconfig, using editor options")
+		if me.opts != nil && me.opts.TabSize > 0 {
+			return format.NewBasicConfigurationProvider(!me.opts.InsertSpaces, me.opts.TabSize), nil
+		}
+		return format.NewDefaultConfigurationProvider().GetConfigurationForFileType(ctx, filename)
+	}
+
+	if me.opts == nil || me.opts.TabSize <= 0 || me.setsIndentation(ctx, filename) {
+		return cfg, nil
+	}
+
+	return &editorConfiguration{Configuration: cfg, opts: me.opts}, nil
+}
+
+// setsIndentation reports whether a matching .editorconfig section sets the indent of filename,
+// the provider falls back to its defaults otherwise and those should not win over the editor
+func (me *fallbackConfigurationProvider) setsIndentation(ctx context.Context, filename string) bool {
+	sources, err := me.editorconfig.Sources(ctx, filename)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("path", filename).Msg("explaining editorconfig, using editor options")
+		return false
+	}
+
+	for _, src := range sources {
+		switch src.Key {
+		case "indent_style", "indent_size", "tab_width":
+			return true
+		}
+	}
+	return false
+}
+
+// editorConfiguration is an editorconfig configuration with the indentation of the editor
+type editorConfiguration struct {
+	format.Configuration
+	opts *FormattingOptions
+}
+
+func (me *editorConfiguration) UseTabs() bool {
+	return !me.opts.InsertSpaces
+}
+
+func (me *editorConfiguration) IndentSize() int {
+	return me.opts.TabSize
+}
+
+func (me *editorConfiguration) Raw() map[string]string {
+	raw := me.Configuration.Raw()
+	if me.opts.InsertSpaces {
+		raw["indent_style"] = "space"
+	} else {
+		raw["indent_style"] = "tab"
+	}
+	raw["indent_size"] = strconv.Itoa(me.opts.TabSize)
+	return raw
+}
+
+func filenameFromURI(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
@@ -0,0 +1,313 @@
+package lsp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/retab/v2/pkg/formatters"
+	"github.com/walteh/retab/v2/pkg/formatters/cmdfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/dartfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/hclfmt"
+	"github.com/walteh/retab/v2/pkg/formatters/protofmt"
+	"github.com/walteh/retab/v2/pkg/formatters/shfmt"
+	"github.com/walteh/retab/v2/pkg/lsp"
+)
+
+type testClient struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+
+	server := lsp.NewServer(&formatters.AutoFormatProvider{
+		HCLFmt:   hclfmt.NewFormatter(),
+		ProtoFmt: protofmt.NewFormatter(),
+		ShFmt:    shfmt.NewFormatter(),
+		// never runs, the executable does not exist
+		DartFmt: dartfmt.NewDartCmdFormatter(cmdfmt.WithExecutable("retab-test-missing-dart")),
+	}, "test")
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	client := &testClient{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan error, 1)}
+
+	go func() {
+		client.done <- server.Serve(context.Background(), inR, outW)
+		outW.Close()
+	}()
+
+	t.Cleanup(func() {
+		inW.Close()
+	})
+
+	return client
+}
+
+func (me *testClient) send(msg map[string]any) {
+	me.t.Helper()
+
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	require.NoError(me.t, err, "marshalling request should succeed")
+
+	_, err = fmt.Fprintf(me.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	require.NoError(me.t, err, "writing request should succeed")
+}
+
+func (me *testClient) receive() map[string]any {
+	me.t.Helper()
+
+	headers, err := textproto.NewReader(me.out).ReadMIMEHeader()
+	require.NoError(me.t, err, "reading response headers should succeed")
+
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	require.NoError(me.t, err, "content length should be a number")
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(me.out, body)
+	require.NoError(me.t, err, "reading response body should succeed")
+
+	msg := map[string]any{}
+	require.NoError(me.t, json.Unmarshal(body, &msg), "response should be json")
+	return msg
+}
+
+// request sends a request and returns its response, collecting any notifications sent before it
+func (me *testClient) request(method string, params any) (map[string]any, []map[string]any) {
+	me.t.Helper()
+
+	me.nextID++
+	me.send(map[string]any{"id": me.nextID, "method": method, "params": params})
+
+	notifications := []map[string]any{}
+	for {
+		msg := me.receive()
+		if _, ok := msg["id"]; ok {
+			return msg, notifications
+		}
+		notifications = append(notifications, msg)
+	}
+}
+
+func (me *testClient) notify(method string, params any) {
+	me.t.Helper()
+	me.send(map[string]any{"method": method, "params": params})
+}
+
+func (me *testClient) open(uri string, languageID string, text string) map[string]any {
+	me.t.Helper()
+	me.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": languageID, "version": 1, "text": text},
+	})
+	// every open publishes diagnostics, unless the formatter is external
+	return me.receive()
+}
+
+func TestInitialize(t *testing.T) {
+	client := newTestClient(t)
+
+	resp, _ := client.request("initialize", map[string]any{})
+	require.Nil(t, resp["error"], "initialize should succeed")
+
+	caps := resp["result"].(map[string]any)["capabilities"].(map[string]any)
+	assert.Equal(t, true, caps["documentFormattingProvider"], "formatting should be advertised")
+	assert.Equal(t, true, caps["documentRangeFormattingProvider"], "range formatting should be advertised")
+	assert.NotNil(t, caps["documentOnTypeFormattingProvider"], "on type formatting should be advertised")
+
+	resp, _ = client.request("shutdown", nil)
+	assert.Contains(t, resp, "result", "shutdown should return a null result")
+
+	resp, _ = client.request("textDocument/formatting", map[string]any{
+		"textDocument": map[string]any{"uri": "file:///tmp/retab-lsp/a.hcl"},
+		"options":      map[string]any{"tabSize": 4, "insertSpaces": false},
+	})
+	require.NotNil(t, resp["error"], "requests after shutdown should fail")
+	assert.Equal(t, float64(-32600), resp["error"].(map[string]any)["code"], "requests after shutdown should be invalid requests")
+
+	client.notify("exit", nil)
+	require.NoError(t, <-client.done, "exit after shutdown should stop cleanly")
+}
+
+func TestFormatting(t *testing.T) {
+	client := newTestClient(t)
+	client.request("initialize", map[string]any{})
+
+	diag := client.open("file:///tmp/retab-lsp/main.hcl", "hcl", "a {\n  b = 1\n  cc = 2\n}\n")
+	assert.Equal(t, "textDocument/publishDiagnostics", diag["method"], "open should publish diagnostics")
+	assert.Empty(t, diag["params"].(map[string]any)["diagnostics"], "valid documents have no diagnostics")
+
+	resp, _ := client.request("textDocument/formatting", map[string]any{
+		"textDocument": map[string]any{"uri": "file:///tmp/retab-lsp/main.hcl"},
+		"options":      map[string]any{"tabSize": 4, "insertSpaces": false},
+	})
+	require.Nil(t, resp["error"], "formatting should succeed")
+
+	edits := resp["result"].([]any)
+	require.Len(t, edits, 1, "the two indented lines should be replaced in one edit")
+
+	edit := edits[0].(map[string]any)
+	assert.Equal(t, "\tb  = 1\n\tcc = 2\n", edit["newText"], "the edit should contain the formatted lines")
+	assert.Equal(t, map[string]any{
+		"start": map[string]any{"line": float64(1), "character": float64(0)},
+		"end":   map[string]any{"line": float64(3), "character": float64(0)},
+	}, edit["range"], "the edit should cover only the changed lines")
+}
+
+func TestFormattingOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		editorconfig string
+		want         string
+	}{
+		{
+			name: "editor_options_without_editorconfig",
+			want: "  b  = 1\n  cc = 2\n",
+		},
+		{
+			name:         "editor_options_when_no_section_sets_the_indent",
+			editorconfig: "root = true\n\n[*.go]\nindent_style = tab\n",
+			want:         "  b  = 1\n  cc = 2\n",
+		},
+		{
+			name:         "editorconfig_wins",
+			editorconfig: "root = true\n\n[*]\nindent_style = tab\n",
+			want:         "\tb  = 1\n\tcc = 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.editorconfig != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte(tt.editorconfig), 0o644), "writing the editorconfig should succeed")
+			}
+			uri := "file://" + filepath.ToSlash(filepath.Join(dir, "main.hcl"))
+
+			client := newTestClient(t)
+			client.request("initialize", map[string]any{})
+			client.open(uri, "hcl", "a {\n    b = 1\n    cc = 2\n}\n")
+
+			resp, _ := client.request("textDocument/formatting", map[string]any{
+				"textDocument": map[string]any{"uri": uri},
+				"options":      map[string]any{"tabSize": 2, "insertSpaces": true},
+			})
+			require.Nil(t, resp["error"], "formatting should succeed")
+
+			edits := resp["result"].([]any)
+			require.Len(t, edits, 1, "the two indented lines should be replaced in one edit")
+			assert.Equal(t, tt.want, edits[0].(map[string]any)["newText"], "the indent should come from the editorconfig, or the editor when it sets none")
+		})
+	}
+}
+
+func TestRangeFormatting(t *testing.T) {
+	client := newTestClient(t)
+	client.request("initialize", map[string]any{})
+
+	client.open("file:///tmp/retab-lsp/run.sh", "shellscript", "if true; then\necho a\nfi\n\nif true; then\necho b\nfi\n")
+
+	resp, _ := client.request("textDocument/rangeFormatting", map[string]any{
+		"textDocument": map[string]any{"uri": "file:///tmp/retab-lsp/run.sh"},
+		"range": map[string]any{
+			"start": map[string]any{"line": 4, "character": 0},
+			"end":   map[string]any{"line": 6, "character": 2},
+		},
+		"options": map[string]any{"tabSize": 4, "insertSpaces": false},
+	})
+	require.Nil(t, resp["error"], "range formatting should succeed")
+
+	edits := resp["result"].([]any)
+	require.Len(t, edits, 1, "only the edit inside the range should be returned")
+	assert.Equal(t, "if true; then\n\techo b\nfi\n", edits[0].(map[string]any)["newText"], "the whole second statement should be formatted")
+	assert.Equal(t, map[string]any{
+		"start": map[string]any{"line": float64(4), "character": float64(0)},
+		"end":   map[string]any{"line": float64(7), "character": float64(0)},
+	}, edits[0].(map[string]any)["range"], "the edit should cover the statement around the range")
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name       string
+		uri        string
+		languageID string
+		text       string
+		line       float64
+	}{
+		{
+			name:       "hcl",
+			uri:        "file:///tmp/retab-lsp/bad.hcl",
+			languageID: "hcl",
+			text:       "a {\n  b = \n}\n",
+			line:       1,
+		},
+		{
+			name:       "proto",
+			uri:        "file:///tmp/retab-lsp/bad.proto",
+			languageID: "proto",
+			text:       "syntax = \"proto3\";\n\nmessage A {\n  int32 a = ;\n}\n",
+			line:       3,
+		},
+		{
+			name:       "shell",
+			uri:        "file:///tmp/retab-lsp/bad.sh",
+			languageID: "shellscript",
+			text:       "echo a\nif true; then\n",
+			line:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t)
+			client.request("initialize", map[string]any{})
+
+			diag := client.open(tt.uri, tt.languageID, tt.text)
+			params := diag["params"].(map[string]any)
+			assert.Equal(t, tt.uri, params["uri"], "diagnostics should be for the opened document")
+
+			diags := params["diagnostics"].([]any)
+			require.NotEmpty(t, diags, "parse errors should be reported")
+
+			first := diags[0].(map[string]any)
+			start := first["range"].(map[string]any)["start"].(map[string]any)
+			assert.Equal(t, tt.line, start["line"], "the diagnostic should point at the broken line")
+			assert.Equal(t, float64(1), first["severity"], "parse errors are errors")
+
+			resp, notifications := client.request("textDocument/formatting", map[string]any{
+				"textDocument": map[string]any{"uri": tt.uri},
+				"options":      map[string]any{"tabSize": 4, "insertSpaces": false},
+			})
+			assert.Nil(t, resp["error"], "formatting a broken document should not return an error")
+			assert.Nil(t, resp["result"], "formatting a broken document should not return edits")
+			assert.Len(t, notifications, 1, "formatting a broken document should republish diagnostics")
+		})
+	}
+}
+
+func TestDiagnosticsSkipExternalFormatters(t *testing.T) {
+	client := newTestClient(t)
+	client.request("initialize", map[string]any{})
+
+	client.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": "file:///tmp/retab-lsp/a.dart", "languageId": "dart", "version": 1, "text": "void main() {\n}\n"},
+	})
+
+	_, notifications := client.request("shutdown", nil)
+	assert.Empty(t, notifications, "opening a document of an external formatter should not run it for diagnostics")
+}